@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/alienvault_passivedns"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[alienvault_passivedns.PassiveDnsResp]{
-		CacheProvider: cache.NewFileCache[alienvault_passivedns.PassiveDnsResp](core.CommandAlienvaultPassivednsCacheDir, core.YEAR),
+		CacheProvider: cache.NewProvider[alienvault_passivedns.PassiveDnsResp](ctx, core.CommandAlienvaultPassivedns, core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc:       core.ParseUrlHostName,
 		RunFunc:       alienvault_passivedns.Get,
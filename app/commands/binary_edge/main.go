@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/binary_edge"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[binary_edge.BinaryEdgeResponse]{
-		CacheProvider: cache.NewDefaultFileCache[binary_edge.BinaryEdgeResponse]("binary_edge", core.YEAR),
+		CacheProvider: cache.NewProvider[binary_edge.BinaryEdgeResponse](ctx, "binary_edge", core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc:       core.ParseUrlHostName,
 		RunFunc:       binary_edge.Run,
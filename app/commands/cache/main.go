@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/cache"
+)
+
+const cacheRoot = "cache"
+
+const usage = `Usage: cache <command> [flags] [args]
+
+Commands:
+  stats                    keys, snapshots and bytes per service
+  show <service> <key>     latest payload of the key and its history
+  purge                    remove snapshots by age, service or key glob
+  export                   write services into a tarball with a manifest
+  import <file>            merge a tarball written by export into the cache
+`
+
+func main() {
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "stats":
+		stats(args[1:])
+	case "show":
+		show(args[1:])
+	case "purge":
+		purge(args[1:])
+	case "export":
+		export(args[1:])
+	case "import":
+		importArchive(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// selectServices returns the comma separated services or every service in the cache
+func selectServices(list string) []string {
+	if list != "" {
+		return strings.Split(list, ",")
+	}
+	return core.Fatal1Err(cache.Services(cacheRoot))
+}
+
+// parseAge accepts time.ParseDuration values and a number of days like "30d"
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q: %w", value, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func stats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	serviceFlag := fs.String("service", "", "Comma separated services, empty shows every service")
+	jsonFlag := fs.Bool("json", false, "Output stats as JSON lines")
+	core.FatalErr(fs.Parse(args))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if !*jsonFlag {
+		fmt.Fprintln(tw, "service\tkeys\tsnapshots\tfailures\tbytes\t")
+	}
+
+	var total cache.ServiceStats
+	for _, service := range selectServices(*serviceFlag) {
+		s, err := cache.NewFileCache[any](filepath.Join(cacheRoot, service), 0).Stats(service)
+		if err != nil {
+			core.Logger.Errorf("Failed to read stats of %s: %v", service, err)
+			continue
+		}
+
+		total.Keys += s.Keys
+		total.Snapshots += s.Snapshots
+		total.Failures += s.Failures
+		total.Bytes += s.Bytes
+
+		if *jsonFlag {
+			fmt.Println(string(core.Fatal1Err(json.Marshal(s))))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t\n", s.Service, s.Keys, s.Snapshots, s.Failures, s.Bytes)
+	}
+
+	if !*jsonFlag {
+		fmt.Fprintf(tw, "total\t%d\t%d\t%d\t%d\t\n", total.Keys, total.Snapshots, total.Failures, total.Bytes)
+		core.FatalErr(tw.Flush())
+	}
+}
+
+func show(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	rawFlag := fs.Bool("raw", false, "Print the payload without indentation")
+	historyFlag := fs.Bool("history", true, "Print the snapshot history to stderr")
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() != 2 {
+		core.Logger.Fatal("Usage: cache show [flags] <service> <key>")
+	}
+	service, key := fs.Arg(0), fs.Arg(1)
+
+	fc := cache.NewFileCache[json.RawMessage](filepath.Join(cacheRoot, service), 0)
+	records := core.Fatal1Err(fc.Records(key))
+	failure, failed, err := fc.GetFailure(key)
+	if err != nil {
+		core.Logger.Fatal(err)
+	}
+
+	if failed && *historyFlag {
+		fmt.Fprintf(os.Stderr, "last failure: %s class=%s http_status=%d attempts=%d error=%s\n",
+			failure.FailedAt.Format(time.RFC3339), failure.ErrorClass, failure.HTTPStatus, failure.Attempts, failure.Error)
+	}
+
+	if len(records) == 0 {
+		core.Logger.Fatalf("No snapshots of %s in %s", key, service)
+	}
+
+	if *historyFlag {
+		tw := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "timestamp\tstatus\tbytes\trun_id\tcommand")
+		for _, record := range records {
+			meta, err := record.ReadMeta()
+			if err != nil {
+				core.Logger.Warnf("Failed to read meta of %s: %v", record.FilePath, err)
+			}
+
+			var size int64
+			if info, err := os.Stat(record.FilePath); err == nil {
+				size = info.Size()
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", record.Ts.Format(time.RFC3339), meta.Status, size, meta.RunId, meta.Command)
+		}
+		core.FatalErr(tw.Flush())
+	}
+
+	data := core.Fatal1Err(records[0].ReadRaw())
+	if !*rawFlag {
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "  "); err == nil {
+			data = out.Bytes()
+		}
+	}
+
+	fmt.Println(string(data))
+}
+
+func purge(args []string) {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	serviceFlag := fs.String("service", "", "Comma separated services, empty purges every service")
+	olderThanFlag := fs.String("older-than", "", "Remove snapshots older than this age (e.g. 720h, 30d)")
+	keyFlag := fs.String("key", "", "Remove every snapshot of the keys matching this glob")
+	dryRunFlag := fs.Bool("dry-run", false, "Only print what would be removed")
+	core.FatalErr(fs.Parse(args))
+
+	if *serviceFlag == "" && *olderThanFlag == "" && *keyFlag == "" {
+		core.Logger.Fatal("Refusing to purge the whole cache, pass -service, -older-than or -key")
+	}
+
+	var olderThan time.Duration
+	if *olderThanFlag != "" {
+		olderThan = core.Fatal1Err(parseAge(*olderThanFlag))
+		if olderThan <= 0 {
+			core.Logger.Fatal("-older-than must be positive")
+		}
+	}
+
+	for _, service := range selectServices(*serviceFlag) {
+		dir := filepath.Join(cacheRoot, service)
+
+		// Only a service was given, drop it entirely
+		if *olderThanFlag == "" && *keyFlag == "" {
+			core.Logger.Infof("Removing %s", dir)
+			if !*dryRunFlag {
+				core.FatalErr(os.RemoveAll(dir))
+			}
+			continue
+		}
+
+		if *keyFlag != "" {
+			fc := cache.NewFileCache[any](dir, 0)
+			keys, err := fc.MatchKeys(*keyFlag)
+			if err != nil {
+				core.Logger.Fatal(err)
+			}
+
+			for _, key := range keys {
+				fmt.Printf("%s\t%s\n", service, key)
+			}
+			core.Logger.Infof("Removing %d keys of %s", len(keys), service)
+
+			if !*dryRunFlag {
+				if err := fc.RemoveKeys(keys); err != nil {
+					core.Logger.Errorf("Failed to purge keys of %s: %v", service, err)
+				}
+			}
+		}
+
+		if olderThan != 0 {
+			fc := cache.NewFileCache[any](dir, olderThan)
+			if *dryRunFlag {
+				count := 0
+				for _, key := range core.Fatal1Err(fc.Keys()) {
+					for _, record := range core.Fatal1Err(fc.Records(key)) {
+						if time.Since(record.Ts) > olderThan {
+							count++
+						}
+					}
+				}
+				core.Logger.Infof("Would remove %d snapshots of %s", count, service)
+				continue
+			}
+
+			if err := fc.CleanExpired(); err != nil {
+				core.Logger.Errorf("Failed to clean %s: %v", service, err)
+			}
+		}
+	}
+}
+
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	serviceFlag := fs.String("service", "", "Comma separated services, empty exports every service")
+	outputFlag := fs.String("o", "cache.tar.gz", "Archive to write")
+	core.FatalErr(fs.Parse(args))
+
+	f := core.Fatal1Err(os.Create(*outputFlag))
+	defer core.Closer(f.Close)()
+
+	manifest := core.Fatal1Err(cache.Export(f, cacheRoot, selectServices(*serviceFlag)))
+	for _, s := range manifest.Services {
+		core.Logger.Infof("Exported %s: %d keys, %d snapshots", s.Service, s.Keys, s.Snapshots)
+	}
+}
+
+func importArchive(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() != 1 {
+		core.Logger.Fatal("Usage: cache import <file>")
+	}
+
+	f := core.Fatal1Err(os.Open(fs.Arg(0)))
+	defer core.Closer(f.Close)()
+
+	manifest, written, err := cache.Import(f, cacheRoot)
+	if err != nil {
+		core.Logger.Fatal(err)
+	}
+
+	core.Logger.Infof("Imported %d snapshots of %d services exported from %s at %s",
+		written, len(manifest.Services), manifest.Host, manifest.CreatedAt.Format(time.RFC3339))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
+	"github.com/mgorunuch/microb/app/engine/registry"
+)
+
+var serviceFlag = flag.String("service", "", "Cached service to diff, empty diffs every service")
+var sinceFlag = flag.String("since", "", "Compare against the latest snapshot taken on or before this date (YYYY-MM-DD) instead of the previous one")
+var kindFlag = flag.String("kind", "", "Only output changes of this kind (subdomain, certificate, url)")
+var jsonFlag = flag.Bool("json", false, "Output changes as JSON lines")
+
+type Change struct {
+	Service string    `json:"service"`
+	Key     string    `json:"key"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	core.FindingChange
+}
+
+// baseline picks the snapshot the latest one is compared against
+func baseline(snapshots []registry.Snapshot, since time.Time) (registry.Snapshot, bool) {
+	if since.IsZero() {
+		if len(snapshots) < 2 {
+			return registry.Snapshot{}, false
+		}
+		return snapshots[1], true
+	}
+
+	for _, snapshot := range snapshots[1:] {
+		if !snapshot.Ts.After(since) {
+			return snapshot, true
+		}
+	}
+
+	return registry.Snapshot{}, false
+}
+
+func output(change Change) {
+	if *kindFlag != "" && change.Kind != *kindFlag {
+		return
+	}
+
+	if *jsonFlag {
+		data, err := json.Marshal(change)
+		if err != nil {
+			core.Logger.Error(err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	sign := "+"
+	if change.Removed {
+		sign = "-"
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\t%s\n", sign, change.Service, change.Key, change.Kind, change.Value)
+}
+
+func diffKey(engine registry.Engine, key string, since time.Time) error {
+	snapshots, err := engine.Snapshots(key)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	previous, ok := baseline(snapshots, since)
+	if !ok {
+		core.Logger.Debugf("No snapshot to compare against for %s/%s", engine.Name(), key)
+		return nil
+	}
+
+	currentFindings, err := snapshots[0].Findings()
+	if err != nil {
+		return fmt.Errorf("failed to read latest snapshot of %s: %w", key, err)
+	}
+
+	previousFindings, err := previous.Findings()
+	if err != nil {
+		return fmt.Errorf("failed to read previous snapshot of %s: %w", key, err)
+	}
+
+	for _, change := range core.DiffFindings(previousFindings, currentFindings) {
+		output(Change{
+			Service:       engine.Name(),
+			Key:           key,
+			From:          previous.Ts,
+			To:            snapshots[0].Ts,
+			FindingChange: change,
+		})
+	}
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	// Snapshots are read from the same backend the engine commands write to
+	if cache.CACHE_BACKEND() == cache.BackendPostgres {
+		defer postgres.Init(ctx)()
+	}
+
+	var since time.Time
+	if *sinceFlag != "" {
+		since = core.Fatal1Err(time.ParseInLocation("2006-01-02", *sinceFlag, time.Local))
+		// Include every snapshot taken during that day
+		since = since.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	services := registry.Names()
+	if *serviceFlag != "" {
+		services = []string{*serviceFlag}
+	}
+
+	for _, service := range services {
+		engine := core.Fatal1Err(registry.Get(service))
+
+		keys, err := engine.Keys()
+		if err != nil {
+			core.Logger.Errorf("Failed to list keys of %s: %v", service, err)
+			continue
+		}
+
+		for _, key := range keys {
+			if err := diffKey(engine, key, since); err != nil {
+				core.Logger.Errorf("Failed to diff %s/%s: %v", service, key, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/cache"
+)
+
+var serviceFlag = flag.String("service", "", "Service to migrate, empty migrates every service")
+var keepFlag = flag.Bool("keep", false, "Keep the legacy files after migrating them")
+
+func main() {
+	core.Init()
+
+	services := []string{*serviceFlag}
+	if *serviceFlag == "" {
+		services = nil
+		dirs := core.Fatal1Err(os.ReadDir("cache"))
+		for _, dir := range dirs {
+			if dir.IsDir() {
+				services = append(services, dir.Name())
+			}
+		}
+	}
+
+	for _, service := range services {
+		migrated, err := cache.MigrateLegacyLayout(filepath.Join("cache", service), *keepFlag)
+		if err != nil {
+			core.Logger.Errorf("Failed to migrate %s after %d snapshots: %v", service, migrated, err)
+			continue
+		}
+
+		core.Logger.Infof("Migrated %d snapshots of %s", migrated, service)
+	}
+}
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"time"
+
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/certspotter"
-	"time"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[[]certspotter.Issuance]{
-		CacheProvider: cache.NewDefaultFileCache[[]certspotter.Issuance]("certspotter", core.YEAR),
+		CacheProvider: cache.NewProvider[[]certspotter.Issuance](ctx, "certspotter", core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc:       core.ParseUrlHostName,
 		RunFunc:       certspotter.Get,
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/jackc/pgx/v5"
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/chrome"
+	"github.com/mgorunuch/microb/app/core/fingerprint"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+var reasonFlag = flag.String("reason", "crawl", "Reason for visiting URLs")
+var tabsFlag = flag.Int("tabs", 4, "Number of tabs crawling in parallel")
+var timeoutFlag = flag.Duration("timeout", 30*time.Second, "Maximum time spent on one page")
+var waitFlag = flag.String("wait", "load", "When the page is captured: load, network-idle or selector")
+var selectorFlag = flag.String("selector", "", "CSS selector waited for with -wait selector")
+var idleQuietFlag = flag.Duration("idle-quiet", 500*time.Millisecond, "How long no request may run for the network to count as idle")
+var idleMaxFlag = flag.Duration("idle-max", 10*time.Second, "Capture pages that keep the network busy after this long")
+var skipWithinFlag = flag.Duration("skip-within", 24*time.Hour, "Skip URLs visited more recently than this, 0 visits every URL")
+var storeLinksFlag = flag.Bool("store-links", true, "Store the links of the rendered DOM and link them to the visit")
+var captureNetworkFlag = flag.Bool("capture-network", true, "Record the requests of each page into visit_requests")
+var captureBodiesFlag = flag.Bool("capture-bodies", false, "Record response bodies too, except images, fonts and media")
+var maxBodySizeFlag = flag.Int64("max-body-size", 1<<20, "Largest response body recorded in bytes")
+var screenshotsFlag = flag.Bool("screenshots", true, "Capture viewport and full page screenshots of each page")
+var fingerprintFlag = flag.Bool("fingerprint", true, "Detect the technologies of each page and store them per host")
+
+// Resolved by the browser, so relative links come back absolute
+const linksScript = `Array.from(
+	document.querySelectorAll('a[href], area[href], link[href], iframe[src], frame[src], form[action]'),
+	el => el.href || el.src || el.action
+)`
+
+var pool *chrome.TabPool
+
+type page struct {
+	Title      string
+	Html       string
+	FinalUrl   string
+	StatusCode int
+	Links      []string
+	Requests   []chrome.NetworkEntry
+	Viewport   []byte
+	FullPage   []byte
+	// Headers, Cookies and Globals are only captured with -fingerprint
+	Headers map[string]string
+	Cookies map[string]string
+	Globals map[string]string
+}
+
+func waitAction(idle *chrome.NetworkIdle) chromedp.Action {
+	switch *waitFlag {
+	case "network-idle":
+		return idle.Wait(*idleQuietFlag, *idleMaxFlag)
+	case "selector":
+		return chromedp.WaitReady(*selectorFlag, chromedp.ByQuery)
+	default:
+		// Navigate already waits for the load event
+		return chromedp.ActionFunc(func(context.Context) error { return nil })
+	}
+}
+
+func capture(tab *chrome.Context, url string) (*page, error) {
+	idle := chrome.WatchNetwork(tab)
+
+	var recorder *chrome.NetworkRecorder
+	if *captureNetworkFlag {
+		recorder = chrome.RecordNetwork(tab)
+	}
+
+	result := &page{}
+	err := runCapture(tab, url, idle, recorder, result)
+
+	// Requests of pages that failed half way are still worth keeping
+	if recorder != nil {
+		result.Requests = recorder.Entries()
+	}
+
+	return result, err
+}
+
+func runCapture(tab *chrome.Context, url string, idle *chrome.NetworkIdle, recorder *chrome.NetworkRecorder, result *page) error {
+	response, err := tab.RunResponse(chromedp.Navigate(url))
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", url, err)
+	}
+
+	result.FinalUrl = response.URL
+	result.StatusCode = int(response.Status)
+	result.Headers = make(map[string]string, len(response.Headers))
+	for name, value := range response.Headers {
+		result.Headers[name] = fmt.Sprint(value)
+	}
+
+	actions := []chromedp.Action{
+		waitAction(idle),
+		chromedp.Title(&result.Title),
+		chromedp.OuterHTML("html", &result.Html, chromedp.ByQuery),
+		chromedp.Evaluate(linksScript, &result.Links),
+	}
+	if *screenshotsFlag {
+		actions = append(actions,
+			chromedp.CaptureScreenshot(&result.Viewport),
+			chromedp.FullScreenshot(&result.FullPage, 100),
+		)
+	}
+	if *fingerprintFlag {
+		actions = append(actions,
+			chromedp.Evaluate(fingerprint.Default().GlobalsScript(), &result.Globals),
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				cookies, err := network.GetCookies().Do(ctx)
+				if err != nil {
+					return err
+				}
+				result.Cookies = make(map[string]string, len(cookies))
+				for _, cookie := range cookies {
+					result.Cookies[cookie.Name] = cookie.Value
+				}
+				return nil
+			}),
+		)
+	}
+	if recorder != nil && *captureBodiesFlag {
+		actions = append(actions, recorder.FetchBodies(*maxBodySizeFlag))
+	}
+
+	if err := tab.Run(actions...); err != nil {
+		return fmt.Errorf("failed to capture %s: %w", url, err)
+	}
+
+	return nil
+}
+
+func crawl(ctx context.Context, url string) (string, error) {
+	urlModel, err := postgres.UrlRepo.UpsertByRaw(ctx, url)
+	if err != nil {
+		return url, fmt.Errorf("failed to upsert URL %s: %w", url, err)
+	}
+
+	if *skipWithinFlag > 0 {
+		lastVisit, err := postgres.ChromeVisitRepo.GetLastVisitAfter(ctx, urlModel.Id, *skipWithinFlag)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return url, fmt.Errorf("failed to check last visit of %s: %w", url, err)
+		}
+
+		if lastVisit != nil {
+			core.Logger.Debugf("Skipping URL %s - already visited on %s", url, lastVisit.OpenedAt)
+			return url, nil
+		}
+	}
+
+	visit := &postgres.ChromeVisitModel{
+		UrlId:     urlModel.Id,
+		OpenedAt:  time.Now(),
+		Success:   true,
+		Reason:    *reasonFlag,
+		RunId:     postgres.CurrentRunId(),
+		CreatedAt: time.Now(),
+	}
+
+	var result *page
+	crawlErr := pool.Do(*timeoutFlag, func(tab *chrome.Context) error {
+		captured, err := capture(tab, url)
+		result = captured
+		return err
+	})
+
+	if result != nil && result.FinalUrl != "" {
+		visit.Title = result.Title
+		visit.FinalUrl = &result.FinalUrl
+		visit.StatusCode = &result.StatusCode
+	}
+
+	// Failed visits are stored too, so they show up next to the successful ones
+	if crawlErr != nil {
+		visit.Success = false
+		visit.ErrorMsg = crawlErr.Error()
+	} else if err := visit.SetHtml(ctx, result.Html); err != nil {
+		return url, fmt.Errorf("failed to store HTML of %s: %w", url, err)
+	}
+
+	if err := postgres.ChromeVisitRepo.Create(ctx, visit); err != nil {
+		return url, fmt.Errorf("failed to save visit of %s: %w", url, err)
+	}
+
+	if result != nil {
+		if err := postgres.StoreVisitRequests(ctx, visit.Id, chrome.VisitRequests(result.Requests)); err != nil {
+			core.Logger.Errorf("Failed to store requests of %s: %v", url, err)
+		}
+	}
+
+	if crawlErr != nil {
+		return url, crawlErr
+	}
+
+	if *storeLinksFlag {
+		storeLinks(ctx, visit.Id, append(result.Links, result.FinalUrl))
+	}
+
+	storeScreenshots(ctx, visit.Id, map[string][]byte{
+		postgres.ScreenshotViewport: result.Viewport,
+		postgres.ScreenshotFullPage: result.FullPage,
+	})
+
+	if *fingerprintFlag {
+		storeTechnologies(ctx, visit.Id, urlModel.Hostname, result)
+	}
+
+	core.Logger.Infof("Crawled %s - %d %s", url, result.StatusCode, visit.Title)
+	return url, nil
+}
+
+func storeLinks(ctx context.Context, visitId string, links []string) {
+	models := make([]postgres.UrlModel, 0, len(links))
+	for _, link := range links {
+		if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+			continue
+		}
+
+		// Checked quietly, most pages link out of scope
+		if ok, _ := core.Scope.Check(link); !ok {
+			continue
+		}
+
+		model := postgres.UrlModel{Raw: link, Flags: []string{}, CreatedAt: time.Now()}
+		if err := model.CalcFromRaw(ctx); err != nil {
+			core.Logger.Debugf("Skipping link %s: %v", link, err)
+			continue
+		}
+		models = append(models, model)
+	}
+
+	if len(models) == 0 {
+		return
+	}
+
+	urls, err := postgres.StoreUrls(ctx, models, visitId)
+	if err != nil {
+		core.Logger.Errorf("Failed to store links of visit %s: %v", visitId, err)
+		return
+	}
+
+	core.Logger.Debugf("Stored %d links of visit %s", len(urls), visitId)
+}
+
+func storeScreenshots(ctx context.Context, visitId string, screenshots map[string][]byte) {
+	for kind, data := range screenshots {
+		if len(data) == 0 {
+			continue
+		}
+		screenshot, err := chrome.SaveScreenshot(visitId, kind, data)
+		if err == nil {
+			err = postgres.StoreVisitScreenshot(ctx, screenshot)
+		}
+		if err != nil {
+			core.Logger.Errorf("Failed to store screenshot: %v", err)
+		}
+	}
+}
+
+// storeTechnologies fingerprints the page under the host it ended up on
+// after redirects
+func storeTechnologies(ctx context.Context, visitId, hostname string, result *page) {
+	if u, err := url.Parse(result.FinalUrl); err == nil && u.Hostname() != "" {
+		hostname = strings.ToLower(u.Hostname())
+	}
+
+	fingerprintPage := &fingerprint.Page{
+		Url:     result.FinalUrl,
+		Headers: result.Headers,
+		Cookies: result.Cookies,
+		Html:    result.Html,
+		Globals: result.Globals,
+	}
+	// Scripts added at runtime don't show up in the captured HTML
+	for _, request := range result.Requests {
+		if request.ResourceType == string(network.ResourceTypeScript) {
+			fingerprintPage.ScriptSrc = append(fingerprintPage.ScriptSrc, request.Url)
+		}
+	}
+
+	detections := fingerprint.Default().Analyze(fingerprintPage)
+	err := postgres.StoreTechnologies(ctx, hostname, result.FinalUrl, postgres.TechnologySourceVisit, &visitId, detections)
+	if err != nil {
+		core.Logger.Errorf("Failed to store technologies: %v", err)
+		return
+	}
+
+	core.Logger.Debugf("Detected %d technologies on %s", len(detections), result.FinalUrl)
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	switch *waitFlag {
+	case "load", "network-idle":
+	case "selector":
+		if *selectorFlag == "" {
+			fmt.Fprintln(os.Stderr, "Error: -wait selector requires -selector")
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -wait %q, use load, network-idle or selector\n", *waitFlag)
+		os.Exit(2)
+	}
+
+	if *tabsFlag < 1 {
+		fmt.Fprintln(os.Stderr, "Error: -tabs must be at least 1")
+		os.Exit(2)
+	}
+
+	defer postgres.Init(ctx)()
+
+	controller := chrome.NewHeadless()
+	defer controller.Close()
+
+	var err error
+	pool, err = chrome.NewTabPool(controller, *tabsFlag)
+	if err != nil {
+		core.Logger.Fatal(err)
+	}
+	defer pool.Close()
+
+	core.ProcessLines(core.SimpleConfig[string]{
+		Ctx:          ctx,
+		ThreadsCount: *tabsFlag,
+		KeyFunc: func(_ context.Context, line string) (string, error) {
+			url := strings.TrimSpace(line)
+			if url == "" {
+				return "", fmt.Errorf("empty line: %w", core.ErrSkip)
+			}
+			return url, nil
+		},
+		RunFunc: crawl,
+		Unique:  true,
+		// The tab pool paces the crawl
+		SleepTime: time.Microsecond,
+	})
+
+	core.Logger.Info("All URLs crawled")
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core/chrome"
+)
+
+// The names chromedp looks up on PATH
+var chromeNames = []string{"headless_shell", "headless-shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "google-chrome-beta", "google-chrome-unstable"}
+
+func requireChrome(t *testing.T) {
+	t.Helper()
+	for _, name := range chromeNames {
+		if _, err := exec.LookPath(name); err == nil {
+			return
+		}
+	}
+	t.Skip("chrome is not installed")
+}
+
+const lateScript = `<script>
+	setTimeout(() => fetch('/slow').then(() => {
+		const el = document.createElement('div');
+		el.id = 'late';
+		document.body.appendChild(el);
+	}), 50);
+</script>`
+
+func testServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Final</title></head><body><a href="/next">next</a></body></html>`)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<html><head><title>Missing</title></head><body></body></html>`)
+	})
+	mux.HandleFunc("/late", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Late</title></head><body>`+lateScript+`</body></html>`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testPool(t *testing.T, tabs int) *chrome.TabPool {
+	controller := chrome.NewHeadless()
+	t.Cleanup(controller.Close)
+
+	pool, err := chrome.NewTabPool(controller, tabs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func setFlag[T any](t *testing.T, flag *T, value T) {
+	previous := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = previous })
+}
+
+func capturePage(t *testing.T, pool *chrome.TabPool, timeout time.Duration, url string) (*page, error) {
+	var result *page
+	err := pool.Do(timeout, func(tab *chrome.Context) error {
+		var err error
+		result, err = capture(tab, url)
+		return err
+	})
+	return result, err
+}
+
+func TestCaptureFollowsRedirects(t *testing.T) {
+	requireChrome(t)
+	setFlag(t, screenshotsFlag, false)
+	setFlag(t, fingerprintFlag, false)
+
+	server := testServer(t)
+	pool := testPool(t, 1)
+
+	tests := []struct {
+		path       string
+		finalPath  string
+		statusCode int
+		title      string
+	}{
+		{"/start", "/final", http.StatusOK, "Final"},
+		{"/final", "/final", http.StatusOK, "Final"},
+		{"/missing", "/missing", http.StatusNotFound, "Missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			result, err := capturePage(t, pool, 10*time.Second, server.URL+tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.FinalUrl != server.URL+tt.finalPath {
+				t.Errorf("FinalUrl = %q, want %q", result.FinalUrl, server.URL+tt.finalPath)
+			}
+			if result.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", result.StatusCode, tt.statusCode)
+			}
+			if result.Title != tt.title {
+				t.Errorf("Title = %q, want %q", result.Title, tt.title)
+			}
+		})
+	}
+
+	t.Run("records the redirect", func(t *testing.T) {
+		setFlag(t, captureNetworkFlag, true)
+
+		result, err := capturePage(t, pool, 10*time.Second, server.URL+"/start")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Requests) < 2 {
+			t.Fatalf("recorded %d requests, want the redirect and the final page", len(result.Requests))
+		}
+		redirect := result.Requests[0]
+		if redirect.Status != http.StatusFound || redirect.RedirectUrl != server.URL+"/final" {
+			t.Errorf("first request = %d to %q, want a 302 to /final", redirect.Status, redirect.RedirectUrl)
+		}
+	})
+
+	t.Run("resolves links", func(t *testing.T) {
+		result, err := capturePage(t, pool, 10*time.Second, server.URL+"/final")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Links) != 1 || result.Links[0] != server.URL+"/next" {
+			t.Errorf("Links = %v, want [%s/next]", result.Links, server.URL)
+		}
+	})
+}
+
+func TestCaptureWaitStrategies(t *testing.T) {
+	requireChrome(t)
+	setFlag(t, screenshotsFlag, false)
+	setFlag(t, fingerprintFlag, false)
+
+	server := testServer(t)
+	pool := testPool(t, 1)
+
+	tests := []struct {
+		wait     string
+		selector string
+		wantLate bool
+	}{
+		// The element is added after the load event
+		{"load", "", false},
+		{"network-idle", "", true},
+		{"selector", "#late", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wait, func(t *testing.T) {
+			setFlag(t, waitFlag, tt.wait)
+			setFlag(t, selectorFlag, tt.selector)
+			setFlag(t, idleQuietFlag, 200*time.Millisecond)
+			setFlag(t, idleMaxFlag, 5*time.Second)
+
+			result, err := capturePage(t, pool, 10*time.Second, server.URL+"/late")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if late := strings.Contains(result.Html, `id="late"`); late != tt.wantLate {
+				t.Errorf("captured the late element = %v, want %v", late, tt.wantLate)
+			}
+		})
+	}
+}
+
+func TestTabReplacedAfterTimeout(t *testing.T) {
+	requireChrome(t)
+	setFlag(t, screenshotsFlag, false)
+	setFlag(t, fingerprintFlag, false)
+
+	server := testServer(t)
+	pool := testPool(t, 1)
+
+	if _, err := capturePage(t, pool, 500*time.Millisecond, server.URL+"/hang"); err == nil {
+		t.Fatal("capturing a hanging page did not time out")
+	}
+
+	// The only tab timed out, the page after it must get a working one
+	result, err := capturePage(t, pool, 10*time.Second, server.URL+"/final")
+	if err != nil {
+		t.Fatalf("page after the timeout failed: %v", err)
+	}
+	if result.Title != "Final" {
+		t.Errorf("Title = %q, want Final", result.Title)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -23,19 +24,18 @@ func main() {
 
 	id := scanner.Text()
 
-	var html string
-	err := postgres.Pool.QueryRow(context.Background(), `
-		select html 
-		from chrome_visits 
-		where id = $1
-	`, id).Scan(&html)
-
-	if err == pgx.ErrNoRows {
+	visit, err := postgres.ChromeVisitRepo.GetById(context.Background(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
 		core.Logger.Fatal("visit not found")
 	}
 	if err != nil {
 		core.Logger.Fatal(err)
 	}
 
+	html, err := visit.LoadHtml(context.Background())
+	if err != nil {
+		core.Logger.Fatal(err)
+	}
+
 	fmt.Print(html)
 }
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
+	"time"
+
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/commoncrawl"
-	"time"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[[]commoncrawl.CrawlData]{
-		CacheProvider: cache.NewDefaultFileCache[[]commoncrawl.CrawlData]("commoncrawl", core.YEAR),
+		CacheProvider: cache.NewProvider[[]commoncrawl.CrawlData](ctx, "commoncrawl", core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc:       core.ParseUrlHostName,
 		RunFunc:       commoncrawl.Get,
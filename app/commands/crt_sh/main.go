@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/crt_sh"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[[]crt_sh.CertData]{
-		CacheProvider: cache.NewDefaultFileCache[[]crt_sh.CertData]("crt_sh", core.YEAR),
+		CacheProvider: cache.NewProvider[[]crt_sh.CertData](ctx, "crt_sh", core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc:       core.ParseUrlHostName,
 		RunFunc:       crt_sh.Get,
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const usage = `Usage: endpoints <command> [flags]
+
+Commands:
+  index                    add stored urls to the endpoint inventory
+  list                     endpoints per host with their parameters
+`
+
+// Params are loaded for this many endpoints at a time while listing
+const listPageSize = 500
+
+type Param struct {
+	Name     string   `json:"name"`
+	UrlCount int      `json:"url_count"`
+	Examples []string `json:"examples"`
+}
+
+type Endpoint struct {
+	Hostname     string  `json:"hostname"`
+	Port         string  `json:"port,omitempty"`
+	PathTemplate string  `json:"path_template"`
+	UrlCount     int     `json:"url_count"`
+	Params       []Param `json:"params,omitempty"`
+}
+
+func main() {
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var command func(ctx context.Context, args []string)
+	switch args[0] {
+	case "index":
+		command = index
+	case "list":
+		command = list
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	defer postgres.Init(ctx)()
+
+	command(ctx, args[1:])
+}
+
+func index(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	batchSize := fs.Int("batch-size", 5000, "Number of urls indexed per transaction")
+	core.FatalErr(fs.Parse(args))
+
+	total := 0
+	after := ""
+	for {
+		ids := core.Fatal1Err(postgres.ListUnindexedUrlIds(ctx, after, *batchSize))
+		if len(ids) == 0 {
+			break
+		}
+
+		indexed := core.Fatal1Err(postgres.IndexUrls(ctx, ids))
+		total += indexed
+		after = ids[len(ids)-1]
+		core.Logger.Debugf("Indexed %d urls", total)
+	}
+
+	core.Logger.Infof("Indexed %d urls", total)
+}
+
+func list(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	host := fs.String("host", "", "Only list endpoints of this hostname")
+	tech := fs.String("tech", "", "Only list endpoints of hosts running this technology")
+	minUrls := fs.Int("min-urls", 0, "Only list endpoints seen in at least this many urls")
+	param := fs.String("param", "", "Only list endpoints that take this parameter")
+	jsonOutput := fs.Bool("json", false, "Output endpoints as JSON lines")
+	core.FatalErr(fs.Parse(args))
+
+	lastHost := ""
+	output := func(endpoint Endpoint) {
+		if *param != "" && !hasParam(endpoint, *param) {
+			return
+		}
+
+		if *jsonOutput {
+			data, err := json.Marshal(endpoint)
+			if err != nil {
+				core.Logger.Error(err)
+				return
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		hostPort := endpoint.Hostname
+		if endpoint.Port != "" {
+			hostPort += ":" + endpoint.Port
+		}
+		if hostPort != lastHost {
+			fmt.Println(hostPort)
+			lastHost = hostPort
+		}
+
+		names := make([]string, len(endpoint.Params))
+		for i, p := range endpoint.Params {
+			names[i] = p.Name
+		}
+		fmt.Printf("  %s\t%d\t%s\n", endpoint.PathTemplate, endpoint.UrlCount, strings.Join(names, ","))
+	}
+
+	var page []postgres.EndpointModel
+	flush := func() error {
+		if len(page) == 0 {
+			return nil
+		}
+
+		ids := make([]int, len(page))
+		for i, endpoint := range page {
+			ids[i] = endpoint.Id
+		}
+
+		params, err := postgres.EndpointParamRepo.ListByEndpointIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		byEndpoint := make(map[int][]Param)
+		for _, p := range params {
+			byEndpoint[p.EndpointId] = append(byEndpoint[p.EndpointId], Param{
+				Name:     p.Name,
+				UrlCount: p.UrlCount,
+				Examples: p.Examples,
+			})
+		}
+
+		for _, endpoint := range page {
+			output(Endpoint{
+				Hostname:     endpoint.Hostname,
+				Port:         endpoint.Port,
+				PathTemplate: endpoint.PathTemplate,
+				UrlCount:     endpoint.UrlCount,
+				Params:       byEndpoint[endpoint.Id],
+			})
+		}
+
+		page = page[:0]
+		return nil
+	}
+
+	err := postgres.EndpointRepo.StreamByHost(ctx, *host, *tech, *minUrls, func(endpoint *postgres.EndpointModel) error {
+		page = append(page, *endpoint)
+		if len(page) >= listPageSize {
+			return flush()
+		}
+		return nil
+	})
+	core.FatalErr(err)
+	core.FatalErr(flush())
+}
+
+func hasParam(endpoint Endpoint, name string) bool {
+	for _, p := range endpoint.Params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,33 +2,72 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 
 	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/domain"
+	"github.com/mgorunuch/microb/app/core/postgres"
 )
 
 type DomainData struct {
 	Domain string
 }
 
+func (d *DomainData) ScopeTarget() string {
+	return d.Domain
+}
+
 var uniqueFlag = flag.Bool("unique", true, "Only output unique domains")
+var registrableFlag = flag.Bool("registrable", false, "Output the registrable domain (eTLD+1) instead of the hostname")
+var subdomainOnlyFlag = flag.Bool("subdomain-only", false, "Only output hostnames below their registrable domain")
+var levelFlag = flag.Int("level", 0, "Output the hostname cut to N labels above the public suffix, 1 is the registrable domain")
 
-func extractDomain(ctx context.Context, url string) (*DomainData, error) {
-	domain, err := core.ParseUrlHostName(ctx, url)
+// extractDomain returns the domain printed for the input, it is also the
+// key used to drop duplicates
+func extractDomain(_ context.Context, url string) (string, error) {
+	d, err := domain.Parse(url)
+	if errors.Is(err, domain.ErrIP) || errors.Is(err, domain.ErrPublicSuffix) {
+		return "", fmt.Errorf("%w: %v", core.ErrSkip, err)
+	}
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	if *subdomainOnlyFlag && !d.IsSubdomain() {
+		return "", fmt.Errorf("%w: %s is not a subdomain", core.ErrSkip, d.Name)
+	}
+
+	switch {
+	case *registrableFlag:
+		return d.Registrable, nil
+	case *levelFlag > 0:
+		level, err := d.Level(*levelFlag)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", core.ErrSkip, err)
+		}
+		return level, nil
+	default:
+		return domain.StripWWW(d.Name), nil
 	}
-	return &DomainData{Domain: domain}, nil
 }
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
+	if *registrableFlag && *levelFlag > 0 {
+		core.Logger.Fatal("-registrable and -level can't be combined")
+	}
+
 	core.ProcessLines(core.SimpleConfig[*DomainData]{
 		ThreadsCount: 1,
-		KeyFunc:      core.ParseUrlHostName,
-		RunFunc: func(ctx context.Context, url string) (*DomainData, error) {
-			return extractDomain(ctx, url)
+		KeyFunc:      extractDomain,
+		RunFunc: func(_ context.Context, domain string) (*DomainData, error) {
+			return &DomainData{Domain: domain}, nil
 		},
 		OutputFunc: func(data *DomainData) {
 			fmt.Println(data.Domain)
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/fingerprint"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const usage = `Usage: fingerprint <command> [flags]
+
+Commands:
+  visits [flags]       detect technologies in the stored chrome visits
+  probe [flags]        fetch the hosts or URLs read from stdin and detect technologies
+  list [flags]         print the detected technologies per host
+  signatures           print the effective signature database as JSON
+
+visits flags:
+  -host, -since, -limit   only the visits of a host, on or after a date, or the latest ones
+
+probe flags:
+  -timeout, -threads, -max-body-size, -json
+
+list flags:
+  -tech, -category, -host, -min-confidence   filter the technologies
+  -hosts                                     print the matching hostnames only
+  -json                                      one JSON line per technology
+`
+
+// detectVisit fingerprints a stored visit from its HTML and recorded
+// requests, JS globals are only known to live crawls
+func detectVisit(ctx context.Context, engine *fingerprint.Engine, visit *postgres.VisitBody) (string, string, []fingerprint.Detection, error) {
+	html, err := postgres.BlobStore().Get(ctx, visit.HtmlHash)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to read HTML of visit %s: %w", visit.VisitId, err)
+	}
+
+	requests, err := postgres.VisitRequestRepo.ListByVisitId(ctx, visit.VisitId)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	page := &fingerprint.Page{Url: visit.Url, Html: string(html)}
+	for _, request := range requests {
+		switch {
+		case request.ResourceType == string(network.ResourceTypeDocument) && page.Headers == nil && request.Status > 0 && request.RedirectUrl == "":
+			// The first document without a redirect is the page itself
+			page.Url = request.Url
+			page.Headers = request.ResponseHeaders
+			for name, value := range request.ResponseHeaders {
+				if strings.EqualFold(name, "set-cookie") {
+					page.Cookies = fingerprint.ParseSetCookie(value)
+				}
+			}
+		case request.ResourceType == string(network.ResourceTypeScript):
+			page.ScriptSrc = append(page.ScriptSrc, request.Url)
+		}
+	}
+
+	u, err := url.Parse(page.Url)
+	if err != nil || u.Hostname() == "" {
+		return "", "", nil, fmt.Errorf("failed to get hostname of %s: %w", page.Url, core.ErrSkip)
+	}
+
+	return strings.ToLower(u.Hostname()), page.Url, engine.Analyze(page), nil
+}
+
+func visits(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("visits", flag.ExitOnError)
+	host := fs.String("host", "", "Only visits of this hostname")
+	since := fs.String("since", "", "Only visits opened on or after this date (YYYY-MM-DD)")
+	limit := fs.Uint64("limit", 0, "Maximum number of visits, 0 for no limit")
+	core.FatalErr(fs.Parse(args))
+
+	filter := postgres.VisitSearchFilter{Hostname: *host, Limit: *limit}
+	if *since != "" {
+		filter.Since = core.Fatal1Err(time.ParseInLocation("2006-01-02", *since, time.Local))
+	}
+
+	engine := fingerprint.Default()
+
+	count, detected := 0, 0
+	err := postgres.ChromeVisitRepo.StreamVisitBodies(ctx, filter, func(visit *postgres.VisitBody) error {
+		hostname, pageUrl, detections, err := detectVisit(ctx, engine, visit)
+		if err != nil {
+			core.Logger.Warnf("Skipping visit %s: %v", visit.VisitId, err)
+			return nil
+		}
+
+		err = postgres.StoreTechnologies(ctx, hostname, pageUrl, postgres.TechnologySourceVisit, &visit.VisitId, detections)
+		if err != nil {
+			return err
+		}
+
+		count++
+		detected += len(detections)
+		core.Logger.Debugf("Detected %d technologies in visit %s", len(detections), visit.VisitId)
+		return nil
+	})
+	core.FatalErr(err)
+
+	core.Logger.Infof("Detected %d technologies in %d visits", detected, count)
+}
+
+type probeResult struct {
+	Url          string                  `json:"url"`
+	Hostname     string                  `json:"hostname"`
+	Status       int                     `json:"status"`
+	Technologies []fingerprint.Detection `json:"technologies"`
+}
+
+type prober struct {
+	client      *http.Client
+	engine      *fingerprint.Engine
+	maxBodySize int64
+}
+
+// fetch requests the URL and fingerprints the response after redirects
+func (p *prober) fetch(ctx context.Context, rawUrl string) (*probeResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rawUrl, err)
+	}
+
+	page := &fingerprint.Page{
+		Url:     resp.Request.URL.String(),
+		Headers: make(map[string]string, len(resp.Header)),
+		Cookies: map[string]string{},
+		Html:    string(body),
+	}
+	for name, values := range resp.Header {
+		page.Headers[name] = strings.Join(values, "\n")
+	}
+	for _, cookie := range resp.Cookies() {
+		page.Cookies[cookie.Name] = cookie.Value
+	}
+
+	return &probeResult{
+		Url:          page.Url,
+		Hostname:     strings.ToLower(resp.Request.URL.Hostname()),
+		Status:       resp.StatusCode,
+		Technologies: p.engine.Analyze(page),
+	}, nil
+}
+
+// probe tries https first for inputs without a scheme
+func (p *prober) probe(ctx context.Context, input string) (*probeResult, error) {
+	if strings.Contains(input, "://") {
+		return p.fetch(ctx, input)
+	}
+
+	result, err := p.fetch(ctx, "https://"+input)
+	if err == nil {
+		return result, nil
+	}
+	core.Logger.Debugf("Falling back to http for %s: %v", input, err)
+
+	return p.fetch(ctx, "http://"+input)
+}
+
+func probe(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 15*time.Second, "Maximum time spent on one request")
+	threads := fs.Int("threads", 10, "Number of hosts probed in parallel")
+	maxBodySize := fs.Int64("max-body-size", 2<<20, "Bytes of the response body analyzed")
+	jsonFlag := fs.Bool("json", false, "Output results as JSON lines")
+	core.FatalErr(fs.Parse(args))
+
+	p := &prober{
+		client: &http.Client{
+			Timeout: *timeout,
+			// Certificates of recon targets are often self-signed or expired
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		engine:      fingerprint.Default(),
+		maxBodySize: *maxBodySize,
+	}
+
+	core.ProcessLines(core.SimpleConfig[*probeResult]{
+		Ctx:          ctx,
+		ThreadsCount: *threads,
+		KeyFunc: func(_ context.Context, line string) (string, error) {
+			input := strings.TrimSpace(line)
+			if input == "" {
+				return "", fmt.Errorf("empty line: %w", core.ErrSkip)
+			}
+			return input, nil
+		},
+		RunFunc: func(ctx context.Context, input string) (*probeResult, error) {
+			result, err := p.probe(ctx, input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to probe %s: %w", input, err)
+			}
+
+			err = postgres.StoreTechnologies(ctx, result.Hostname, result.Url, postgres.TechnologySourceProbe, nil, result.Technologies)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		},
+		OutputFunc: func(result *probeResult) {
+			if *jsonFlag {
+				fmt.Println(string(core.Fatal1Err(json.Marshal(result))))
+				return
+			}
+			for _, detection := range result.Technologies {
+				fmt.Printf("%s\t%s\t%s\t%d\n", result.Hostname, detection.Name, detection.Version, detection.Confidence)
+			}
+		},
+		Unique: true,
+	})
+}
+
+func list(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	tech := fs.String("tech", "", "Only this technology, e.g. WordPress")
+	category := fs.String("category", "", "Only technologies of this category, e.g. cms, cdn or waf")
+	host := fs.String("host", "", "Only technologies of this hostname")
+	minConfidence := fs.Int("min-confidence", 0, "Only detections at least this confident")
+	hostsFlag := fs.Bool("hosts", false, "Print the matching hostnames only")
+	jsonFlag := fs.Bool("json", false, "Output technologies as JSON lines")
+	core.FatalErr(fs.Parse(args))
+
+	filter := postgres.TechnologyFilter{
+		Name:          *tech,
+		Category:      *category,
+		Hostname:      *host,
+		MinConfidence: *minConfidence,
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !*jsonFlag && !*hostsFlag {
+		fmt.Fprintln(tw, "HOST\tNAME\tVERSION\tCONFIDENCE\tCATEGORIES\tSOURCE\tLAST SEEN")
+	}
+
+	lastHost := ""
+	err := postgres.TechnologyRepo.StreamByFilter(ctx, filter, func(technology *postgres.TechnologyModel) error {
+		switch {
+		case *hostsFlag:
+			// Rows come ordered by host
+			if technology.Hostname != lastHost {
+				fmt.Println(technology.Hostname)
+				lastHost = technology.Hostname
+			}
+		case *jsonFlag:
+			fmt.Println(string(core.Fatal1Err(json.Marshal(technology))))
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				technology.Hostname, technology.Name, technology.Version, technology.Confidence,
+				strings.Join(technology.Categories, ","), technology.Source, technology.LastSeen.Format(time.DateTime))
+		}
+		return nil
+	})
+	core.FatalErr(err)
+	core.FatalErr(tw.Flush())
+}
+
+func signatures() {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	core.FatalErr(encoder.Encode(fingerprint.Signatures()))
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "visits", "probe", "list":
+	case "signatures":
+		signatures()
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	defer postgres.Init(ctx)()
+
+	switch args[0] {
+	case "visits":
+		visits(ctx, args[1:])
+	case "probe":
+		probe(ctx, args[1:])
+	case "list":
+		list(ctx, args[1:])
+	}
+}
@@ -5,13 +5,18 @@ import (
 
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/google_custom_search"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[google_custom_search.GoogleCustomSearchResponse]{
-		CacheProvider: cache.NewDefaultFileCache[google_custom_search.GoogleCustomSearchResponse]("google_custom_search", core.YEAR),
+		CacheProvider: cache.NewProvider[google_custom_search.GoogleCustomSearchResponse](ctx, "google_custom_search", core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc: func(_ context.Context, s string) (string, error) {
 			return s, nil
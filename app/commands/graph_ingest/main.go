@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/graph"
+	"github.com/mgorunuch/microb/app/core/neo4j"
+	"github.com/mgorunuch/microb/app/core/postgres"
+	"github.com/mgorunuch/microb/app/engine/alienvault_passivedns"
+	"github.com/mgorunuch/microb/app/engine/certspotter"
+	"github.com/mgorunuch/microb/app/engine/commoncrawl"
+	"github.com/mgorunuch/microb/app/engine/crt_sh"
+	"github.com/mgorunuch/microb/app/engine/google_custom_search"
+	"github.com/mgorunuch/microb/app/engine/registry"
+)
+
+var serviceFlag = flag.String("service", "", "Cached service to ingest into the graph, or technologies to ingest the fingerprinted technologies")
+
+const (
+	serviceTechnologies = "technologies"
+
+	technologiesBatchSize = 500
+)
+
+func parseCrtshTime(value string) time.Time {
+	ts, err := time.Parse("2006-01-02T15:04:05.999999999", value)
+	if err != nil {
+		return time.Time{}
+	}
+	return ts
+}
+
+// runBatch attributes the batch to the run that cached the data, snapshots
+// without a recorded run fall back to the current one
+func runBatch(meta cache.SnapshotMeta) *graph.Batch {
+	if meta.RunId == "" || meta.Command == "" {
+		return graph.NewCurrentRunBatch()
+	}
+
+	startedAt := meta.StartedAt
+	if startedAt.IsZero() {
+		startedAt = meta.CreatedAt
+	}
+	return graph.NewRunBatch(meta.Command, meta.RunId, startedAt)
+}
+
+func ingest[T any](ctx context.Context, service string, convert func(batch *graph.Batch, snapshot cache.Snapshot[T], data T)) error {
+	history, err := registry.History[T](service)
+	if err != nil {
+		return err
+	}
+
+	keys, err := history.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		snapshots, err := history.Snapshots(key)
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range snapshots {
+			data, err := snapshot.Read()
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", key, err)
+			}
+
+			meta, err := snapshot.ReadMeta()
+			if err != nil {
+				return fmt.Errorf("failed to read meta of %s: %w", key, err)
+			}
+
+			batch := runBatch(meta)
+			convert(batch, snapshot, data)
+
+			if err := graph.Store.Write(ctx, batch); err != nil {
+				return fmt.Errorf("failed to write %s: %w", key, err)
+			}
+
+			core.Logger.Infof("Ingested %s/%s: %d nodes, %d relationships", service, key, len(batch.Nodes), len(batch.Relationships))
+		}
+	}
+
+	return nil
+}
+
+// ingestTechnologies reads the detected technologies from postgres instead
+// of the file cache
+func ingestTechnologies(ctx context.Context) error {
+	if postgres.Pool == nil {
+		return fmt.Errorf("technologies are read from postgres, set POSTGRES_PASSWORD")
+	}
+
+	var technologies []graph.Technology
+	flush := func() error {
+		if len(technologies) == 0 {
+			return nil
+		}
+
+		batch := graph.NewCurrentRunBatch()
+		batch.AddTechnologies(technologies)
+		if err := graph.Store.Write(ctx, batch); err != nil {
+			return fmt.Errorf("failed to write technologies: %w", err)
+		}
+
+		core.Logger.Infof("Ingested %d technologies: %d nodes, %d relationships", len(technologies), len(batch.Nodes), len(batch.Relationships))
+		technologies = technologies[:0]
+		return nil
+	}
+
+	err := postgres.TechnologyRepo.StreamByFilter(ctx, postgres.TechnologyFilter{}, func(technology *postgres.TechnologyModel) error {
+		technologies = append(technologies, graph.Technology{
+			Hostname:   technology.Hostname,
+			Name:       technology.Name,
+			Version:    technology.Version,
+			Categories: technology.Categories,
+			Confidence: technology.Confidence,
+			Source:     technology.Source,
+			FirstSeen:  technology.FirstSeen,
+			LastSeen:   technology.LastSeen,
+		})
+		if len(technologies) >= technologiesBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+func run(ctx context.Context, service string) error {
+	switch service {
+	case core.CommandCrtSh:
+		return ingest(ctx, service, func(batch *graph.Batch, _ cache.Snapshot[[]crt_sh.CertData], data []crt_sh.CertData) {
+			certs := make([]neo4j.CrtshCert, len(data))
+			for i, cert := range data {
+				certs[i] = neo4j.CrtshCert{
+					ID:             cert.ID,
+					IssuerCAID:     cert.IssuerCaID,
+					IssuerName:     cert.IssuerName,
+					CommonName:     cert.CommonName,
+					NameValue:      cert.NameValue,
+					SerialNumber:   cert.SerialNumber,
+					EntryTimestamp: parseCrtshTime(cert.EntryTimestamp),
+					NotBefore:      parseCrtshTime(cert.NotBefore),
+					NotAfter:       parseCrtshTime(cert.NotAfter),
+				}
+			}
+			batch.AddCrtshRecords(certs)
+		})
+	case core.CommandCertspotter:
+		return ingest(ctx, service, func(batch *graph.Batch, _ cache.Snapshot[[]certspotter.Issuance], data []certspotter.Issuance) {
+			certs := make([]neo4j.CertspotterCert, len(data))
+			for i, cert := range data {
+				certs[i] = neo4j.CertspotterCert(cert)
+			}
+			batch.AddCertspotterRecords(certs)
+		})
+	case core.CommandWebArchive:
+		return ingest(ctx, service, func(batch *graph.Batch, snapshot cache.Snapshot[[]string], data []string) {
+			var urls []neo4j.WebArchiveURL
+			for _, raw := range data {
+				u, err := neo4j.ParseWebArchiveURL(raw, snapshot.Ts)
+				if err != nil {
+					core.Logger.Debugf("Skipping invalid URL %s: %v", raw, err)
+					continue
+				}
+				urls = append(urls, *u)
+			}
+			batch.AddWebArchiveRecords(urls)
+		})
+	case core.CommandGoogleSearch:
+		return ingest(ctx, service, func(batch *graph.Batch, snapshot cache.Snapshot[google_custom_search.GoogleCustomSearchResponse], data google_custom_search.GoogleCustomSearchResponse) {
+			results := make([]neo4j.GoogleSearchResult, len(data.Items))
+			for i, item := range data.Items {
+				results[i] = neo4j.GoogleSearchResult{
+					Title:       item.Title,
+					Link:        item.Link,
+					Snippet:     item.Snippet,
+					DisplayLink: item.DisplayLink,
+					Timestamp:   snapshot.Ts,
+				}
+			}
+			batch.AddGoogleSearchRecords(results)
+		})
+	case core.CommandCommonCrawl:
+		return ingest(ctx, service, func(batch *graph.Batch, _ cache.Snapshot[[]commoncrawl.CrawlData], data []commoncrawl.CrawlData) {
+			webpages := make([]neo4j.CommonCrawlWebpage, len(data))
+			for i, page := range data {
+				ts, _ := time.Parse("20060102150405", page.Timestamp)
+				webpages[i] = neo4j.CommonCrawlWebpage{
+					Urlkey:       page.Urlkey,
+					Timestamp:    ts,
+					URL:          page.Url,
+					Mime:         page.Mime,
+					MimeDetected: page.MimeDetected,
+					Status:       page.Status,
+					Digest:       page.Digest,
+					Length:       page.Length,
+					Offset:       page.Offset,
+					Filename:     page.Filename,
+					Languages:    page.Languages,
+					Encoding:     page.Encoding,
+				}
+			}
+			batch.AddCommonCrawlRecords(webpages)
+		})
+	case core.CommandAlienvaultPassivedns:
+		return ingest(ctx, service, func(batch *graph.Batch, snapshot cache.Snapshot[alienvault_passivedns.PassiveDnsResp], data alienvault_passivedns.PassiveDnsResp) {
+			records := make([]neo4j.DnsRecord, len(data.PassiveDns))
+			for i, record := range data.PassiveDns {
+				records[i] = neo4j.DnsRecord{
+					Hostname:   record.Hostname,
+					Address:    record.Address,
+					RecordType: record.RecordType,
+					AssetType:  record.AssetType,
+					Timestamp:  snapshot.Ts,
+				}
+			}
+			batch.AddDnsRecords(records)
+		})
+	case serviceTechnologies:
+		return ingestTechnologies(ctx)
+	default:
+		return fmt.Errorf("unsupported service: %s", service)
+	}
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	if *serviceFlag == "" {
+		core.Logger.Fatal("-service flag is required")
+	}
+
+	defer graph.Init(ctx)()
+
+	if err := run(ctx, *serviceFlag); err != nil {
+		core.Logger.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/graph"
+)
+
+var labelFlag = flag.String("label", graph.LabelDnsName, "Label of the input nodes")
+var relFlag = flag.String("rel", "", "Relationship type to follow, empty follows all")
+var targetFlag = flag.String("target", "", "Only output related nodes with this label")
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+	defer graph.Init(ctx)()
+
+	keyProps, ok := graph.KeyProps[*labelFlag]
+	if !ok || len(keyProps) != 1 {
+		core.Logger.Fatalf("Label %s can not be pivoted from a single value", *labelFlag)
+	}
+
+	core.ProcessLines(core.SimpleConfig[[]graph.Node]{
+		Ctx:          ctx,
+		ThreadsCount: 1,
+		KeyFunc: func(_ context.Context, s string) (string, error) {
+			return strings.TrimSpace(s), nil
+		},
+		RunFunc: func(ctx context.Context, value string) ([]graph.Node, error) {
+			var related []graph.Node
+			for _, ref := range graph.ParseRefs(*labelFlag, value) {
+				nodes, err := graph.Store.Related(ctx, ref, *relFlag)
+				if err != nil {
+					return nil, err
+				}
+				related = append(related, nodes...)
+			}
+			return related, nil
+		},
+		OutputFunc: func(nodes []graph.Node) {
+			for _, node := range nodes {
+				if *targetFlag != "" && node.Label != *targetFlag {
+					continue
+				}
+
+				names := node.KeyNames()
+				if len(names) == 1 {
+					fmt.Println(node.Key[names[0]])
+					continue
+				}
+
+				data, err := json.Marshal(node.Key)
+				if err != nil {
+					core.Logger.Error(err)
+					continue
+				}
+				fmt.Println(string(data))
+			}
+		},
+		Unique: true,
+	})
+}
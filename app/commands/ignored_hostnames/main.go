@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/domain"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const usage = `Usage: ignored_hostnames <command> [flags] [args]
+
+Commands:
+  add [-reason r] <hostname>...     ignore the hostnames and their subdomains
+  remove <hostname>...              stop ignoring the hostnames
+  list [-json]                      print every ignored hostname
+  import [-reason r]                add "hostname [reason]" lines read from stdin
+`
+
+func normalize(hostname string) (string, error) {
+	name, err := domain.Normalize(hostname)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname %q: %w", hostname, err)
+	}
+	return name, nil
+}
+
+func add(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	reasonFlag := fs.String("reason", "", "Why the hostnames are ignored")
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() == 0 {
+		core.Logger.Fatal("Usage: ignored_hostnames add [-reason r] <hostname>...")
+	}
+
+	for _, hostname := range fs.Args() {
+		name, err := normalize(hostname)
+		if err != nil {
+			core.Logger.Error(err)
+			continue
+		}
+
+		if _, err := postgres.IgnoredHostnameRepo.Upsert(ctx, name, *reasonFlag); err != nil {
+			core.Logger.Errorf("Failed to ignore %s: %v", name, err)
+			continue
+		}
+
+		core.Logger.Infof("Ignoring %s", name)
+	}
+}
+
+func remove(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("remove", flag.ExitOnError)
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() == 0 {
+		core.Logger.Fatal("Usage: ignored_hostnames remove <hostname>...")
+	}
+
+	for _, hostname := range fs.Args() {
+		name, err := normalize(hostname)
+		if err != nil {
+			core.Logger.Error(err)
+			continue
+		}
+
+		removed, err := postgres.IgnoredHostnameRepo.DeleteByHostname(ctx, name)
+		if err != nil {
+			core.Logger.Errorf("Failed to remove %s: %v", name, err)
+			continue
+		}
+
+		if !removed {
+			core.Logger.Warnf("%s was not ignored", name)
+			continue
+		}
+
+		core.Logger.Infof("No longer ignoring %s", name)
+	}
+}
+
+type listEntry struct {
+	Hostname  string    `json:"hostname"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func list(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Output entries as JSON lines")
+	core.FatalErr(fs.Parse(args))
+
+	hostnames := core.Fatal1Err(postgres.IgnoredHostnameRepo.ListAll(ctx))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, hostname := range hostnames {
+		if *jsonFlag {
+			entry := listEntry{Hostname: hostname.Hostname, Reason: hostname.Reason, CreatedAt: hostname.CreatedAt}
+			fmt.Println(string(core.Fatal1Err(json.Marshal(entry))))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", hostname.Hostname, hostname.Reason, hostname.CreatedAt.Format(time.RFC3339))
+	}
+	core.FatalErr(tw.Flush())
+}
+
+func importHostnames(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	reasonFlag := fs.String("reason", "", "Reason for lines that don't carry their own")
+	core.FatalErr(fs.Parse(args))
+
+	imported := 0
+	core.ReadAllLines(func(line string) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			return
+		}
+
+		hostname, reason, _ := strings.Cut(line, " ")
+		reason = strings.TrimSpace(reason)
+		if reason == "" {
+			reason = *reasonFlag
+		}
+
+		name, err := normalize(hostname)
+		if err != nil {
+			core.Logger.Error(err)
+			return
+		}
+
+		if _, err := postgres.IgnoredHostnameRepo.Upsert(ctx, name, reason); err != nil {
+			core.Logger.Errorf("Failed to ignore %s: %v", name, err)
+			return
+		}
+		imported++
+	})
+
+	core.Logger.Infof("Imported %d ignored hostnames", imported)
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	defer postgres.Init(ctx)()
+
+	switch args[0] {
+	case "add":
+		add(ctx, args[1:])
+	case "remove":
+		remove(ctx, args[1:])
+	case "list":
+		list(ctx, args[1:])
+	case "import":
+		importHostnames(ctx, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"sync"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/mgorunuch/microb/app/core/cache"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -18,12 +18,11 @@ import (
 )
 
 type APICacheManager struct {
-	client          *mongo.Client
-	cacheCollection *mongo.Collection
-	httpClient      *http.Client
-	rateLimiter     *rate.Limiter
-	logger          *zap.SugaredLogger
-	cacheExpiry     time.Duration
+	client      *mongo.Client
+	cache       *cache.MongoCache[*APIResponse]
+	httpClient  *http.Client
+	rateLimiter *rate.Limiter
+	logger      *zap.SugaredLogger
 }
 
 type APIResponse struct {
@@ -31,13 +30,6 @@ type APIResponse struct {
 	Data   interface{} `json:"data"`
 }
 
-type CacheEntry struct {
-	ScoreID   string      `bson:"score_id"`
-	Data      interface{} `bson:"data"`
-	IsValid   bool        `bson:"is_valid"`
-	Timestamp time.Time   `bson:"timestamp"`
-}
-
 type ScoreIDResult struct {
 	ScoreID string
 	Result  interface{}
@@ -120,52 +112,14 @@ func NewAPICacheManager(ctx context.Context, connectionString, dbName string, ca
 	// Get collection
 	collection := client.Database(dbName).Collection("api_cache")
 
-	// Check existing indexes
-	cursor, err := collection.Indexes().List(ctx)
+	apiCache, err := cache.NewMongoCache[*APIResponse](ctx, cache.MongoCacheOpts{
+		Collection:    collection,
+		ExpirationTTL: time.Duration(cacheExpiryHours) * time.Hour,
+		KeyField:      "score_id",
+	})
 	if err != nil {
-		logger.Error("Failed to list indexes", "error", err)
-		return nil, fmt.Errorf("failed to list indexes: %v", err)
-	}
-	defer cursor.Close(ctx)
-
-	var existingIndexes []bson.M
-	if err = cursor.All(ctx, &existingIndexes); err != nil {
-		logger.Error("Failed to read indexes", "error", err)
-		return nil, fmt.Errorf("failed to read indexes: %v", err)
-	}
-
-	// Create map of existing index names
-	existingIndexNames := make(map[string]bool)
-	for _, idx := range existingIndexes {
-		if name, ok := idx["name"].(string); ok {
-			existingIndexNames[name] = true
-			logger.Debug("Found existing index", "name", name)
-		}
-	}
-
-	// Create only missing indexes
-	if !existingIndexNames["score_id_1"] {
-		logger.Info("Creating score_id index")
-		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-			Keys:    bson.D{{Key: "score_id", Value: 1}},
-			Options: options.Index().SetUnique(true),
-		})
-		if err != nil {
-			logger.Error("Failed to create score_id index", "error", err)
-			return nil, fmt.Errorf("failed to create score_id index: %v", err)
-		}
-	}
-
-	if !existingIndexNames["timestamp_1"] {
-		logger.Info("Creating timestamp index")
-		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-			Keys:    bson.D{{Key: "timestamp", Value: 1}},
-			Options: options.Index().SetExpireAfterSeconds(int32(cacheExpiryHours * 3600)),
-		})
-		if err != nil {
-			logger.Error("Failed to create timestamp index", "error", err)
-			return nil, fmt.Errorf("failed to create timestamp index: %v", err)
-		}
+		logger.Error("Failed to create cache indexes", "error", err)
+		return nil, err
 	}
 
 	// Create HTTP client with timeouts
@@ -179,12 +133,11 @@ func NewAPICacheManager(ctx context.Context, connectionString, dbName string, ca
 	}
 
 	return &APICacheManager{
-		client:          client,
-		cacheCollection: collection,
-		httpClient:      httpClient,
-		rateLimiter:     rate.NewLimiter(rate.Every(time.Second/1000), 1), // 30 requests per second
-		logger:          logger,
-		cacheExpiry:     time.Duration(cacheExpiryHours) * time.Hour,
+		client:      client,
+		cache:       apiCache,
+		httpClient:  httpClient,
+		rateLimiter: rate.NewLimiter(rate.Every(time.Second/1000), 1), // 30 requests per second
+		logger:      logger,
 	}, nil
 }
 
@@ -213,46 +166,33 @@ func (m *APICacheManager) generateNextCombination(current, charset string) strin
 	return ""
 }
 
-func (m *APICacheManager) getCachedResult(ctx context.Context, scoreID string) (interface{}, error) {
+func (m *APICacheManager) getCachedResult(ctx context.Context, scoreID string) (*APIResponse, error) {
 	m.logger.Debugw("Checking cache", "score_id", scoreID)
 
-	var entry CacheEntry
-	err := m.cacheCollection.FindOne(ctx, bson.M{
-		"score_id": scoreID,
-		"timestamp": bson.M{
-			"$gt": time.Now().Add(-m.cacheExpiry),
-		},
-	}).Decode(&entry)
-
-	if err == mongo.ErrNoDocuments {
+	has, err := m.cache.HasCached(scoreID)
+	if err != nil {
+		m.logger.Warnw("Cache error", "score_id", scoreID, "error", err)
+		return nil, err
+	}
+	if !has {
 		m.logger.Debugw("Cache miss", "score_id", scoreID)
 		return nil, nil
 	}
+
+	entry, err := m.cache.GetFromCache(scoreID)
 	if err != nil {
 		m.logger.Warnw("Cache error", "score_id", scoreID, "error", err)
 		return nil, err
 	}
 
 	m.logger.Debugw("Cache hit", "score_id", scoreID)
-	return entry.Data, nil
+	return entry, nil
 }
 
-func (m *APICacheManager) cacheResult(ctx context.Context, scoreID string, data interface{}) error {
+func (m *APICacheManager) cacheResult(ctx context.Context, scoreID string, data *APIResponse) error {
 	m.logger.Debugw("Caching result", "score_id", scoreID)
 
-	entry := CacheEntry{
-		ScoreID:   scoreID,
-		Data:      data,
-		IsValid:   true,
-		Timestamp: time.Now(),
-	}
-
-	_, err := m.cacheCollection.UpdateOne(ctx,
-		bson.M{"score_id": scoreID},
-		bson.M{"$set": entry},
-		options.Update().SetUpsert(true))
-
-	if err != nil {
+	if err := m.cache.AddToCache(scoreID, data); err != nil {
 		m.logger.Errorw("Failed to cache result", "score_id", scoreID, "error", err)
 		return err
 	}
@@ -2,23 +2,166 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/postgres"
 )
 
+const usage = `Usage: migrate [command] [flags] [args]
+
+Commands:
+  status                   applied and pending migrations and checksum drift
+  up [-to N]               apply pending migrations, the default command
+  down <N>                 roll back the latest N applied migrations
+
+up and down accept -dry-run to print the SQL without running it, status and
+-dry-run never write to the database
+`
+
 func main() {
 	core.Init()
-	cleanup := postgres.Init(context.Background())
-	defer cleanup()
 
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"up"}
+	}
+
+	switch args[0] {
+	case "status", "up", "down":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// Connect only, Init would apply the migrations before we get to plan them
 	ctx := context.Background()
+	defer postgres.Connect(ctx)()
+
+	switch args[0] {
+	case "status":
+		status(ctx, args[1:])
+	case "up":
+		up(ctx, args[1:])
+	case "down":
+		down(ctx, args[1:])
+	}
+}
+
+func status(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	core.FatalErr(fs.Parse(args))
+
+	statuses := core.Fatal1Err(postgres.MigrationStatuses(ctx))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tREVERSIBLE\tNAME")
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Unknown:
+			state = "unknown"
+		case status.Drift:
+			state = "drift"
+		case status.Applied:
+			state = "applied"
+		}
+
+		appliedAt := "-"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+
+		reversible := "no"
+		if status.Down != "" {
+			reversible = "yes"
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", status.Version, state, appliedAt, reversible, status.Name)
+	}
+	core.FatalErr(tw.Flush())
+
+	if err := postgres.CheckDrift(statuses); err != nil {
+		core.Logger.Warn(err)
+	}
+}
+
+func up(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("up", flag.ExitOnError)
+	to := fs.Int("to", 0, "Stop after applying this version, 0 applies every pending migration")
+	dryRun := fs.Bool("dry-run", false, "Print the SQL of the pending migrations without running it")
+	allowDrift := fs.Bool("allow-drift", false, "Apply even though applied migrations were changed since they ran")
+	core.FatalErr(fs.Parse(args))
+
+	if !*dryRun {
+		core.FatalErr(postgres.PrepareMigrationsTable(ctx))
+	}
+	statuses := core.Fatal1Err(postgres.MigrationStatuses(ctx))
+
+	err := postgres.CheckDrift(statuses)
+	if err != nil && !(*allowDrift && errors.Is(err, postgres.ErrMigrationDrift)) {
+		core.Logger.Fatal(err)
+	}
+
+	steps := postgres.PlanUp(statuses, *to)
+	if len(steps) == 0 {
+		core.Logger.Info("No pending migrations")
+		return
+	}
+
+	run(ctx, steps, *dryRun)
+}
+
+func down(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("down", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Print the SQL of the rollbacks without running it")
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	n, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || n < 1 {
+		core.Logger.Fatalf("Number of migrations to roll back must be a positive integer, got %q", fs.Arg(0))
+	}
+
+	if !*dryRun {
+		core.FatalErr(postgres.PrepareMigrationsTable(ctx))
+	}
+	statuses := core.Fatal1Err(postgres.MigrationStatuses(ctx))
+	steps := core.Fatal1Err(postgres.PlanDown(statuses, n))
+	if len(steps) == 0 {
+		core.Logger.Info("No applied migrations")
+		return
+	}
+
+	run(ctx, steps, *dryRun)
+}
 
-	if err := postgres.Migrate(ctx); err != nil {
-		core.Logger.Error("Failed to run migrations", "error", err)
-		os.Exit(1)
+func run(ctx context.Context, steps []postgres.MigrationStep, dryRun bool) {
+	if dryRun {
+		for _, step := range steps {
+			direction := "up"
+			if step.Rollback {
+				direction = "down"
+			}
+			fmt.Printf("-- %d %s: %s\n%s;\n", step.Version, direction, step.Name, step.SQL())
+			if step.Func() != nil {
+				fmt.Println("-- followed by a data migration written in Go")
+			}
+			fmt.Println()
+		}
+		return
 	}
 
-	core.Logger.Info("Successfully ran all migrations")
+	core.FatalErr(postgres.ApplyMigrations(ctx, steps))
+	core.Logger.Infof("Successfully ran %d migrations", len(steps))
 }
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/postgres"
+	"github.com/mgorunuch/microb/app/engine/registry"
+)
+
+var watchlistFlag = flag.String("watchlist", "", "File with one domain per line, the watchlist table is used when empty")
+var enginesFlag = flag.String("engines", "crt_sh,certspotter,alienvault_passivedns,web_archive,commoncrawl", "Comma separated engines to run for domains without explicit engines")
+var stateFlag = flag.String("state", "monitor_state.json", "File the schedule state is persisted to")
+var tickFlag = flag.Duration("tick", time.Minute, "How often the schedule is checked")
+var sleepFlag = flag.Duration("sleep", 5*time.Second, "Pause between two collections")
+var retryFlag = flag.Duration("retry", 5*time.Minute, "Delay before a failed collection is retried, doubled on every further failure")
+var webhookFlag = flag.String("webhook", "", "URL new findings are POSTed to")
+var alertFileFlag = flag.String("alert-file", "", "File new findings are appended to as JSON lines")
+var stdoutFlag = flag.Bool("stdout", true, "Print new findings to stdout as JSON lines")
+var alertInitialFlag = flag.Bool("alert-initial", false, "Alert on the first collection of a domain")
+
+type Alert struct {
+	Service    string    `json:"service"`
+	Key        string    `json:"key"`
+	RunId      string    `json:"run_id"`
+	DetectedAt time.Time `json:"detected_at"`
+	core.FindingChange
+}
+
+// Sink delivers alerts to a single destination
+type Sink interface {
+	Send(ctx context.Context, alerts []Alert) error
+}
+
+type StdoutSink struct{}
+
+func (s StdoutSink) Send(_ context.Context, alerts []Alert) error {
+	for _, alert := range alerts {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
+
+type FileSink struct {
+	Path string
+}
+
+func (s FileSink) Send(_ context.Context, alerts []Alert) error {
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open alert file: %w", err)
+	}
+	defer core.Closer(f.Close)()
+
+	encoder := json.NewEncoder(f)
+	for _, alert := range alerts {
+		if err := encoder.Encode(alert); err != nil {
+			return fmt.Errorf("failed to write alert: %w", err)
+		}
+	}
+	return nil
+}
+
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSink) Send(ctx context.Context, alerts []Alert) error {
+	data, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type ScheduleEntry struct {
+	Service   string    `json:"service"`
+	Domain    string    `json:"domain"`
+	LastRun   time.Time `json:"last_run"`
+	NextRun   time.Time `json:"next_run"`
+	LastError string    `json:"last_error,omitempty"`
+	// Failures counts the failed collections since the last successful one
+	Failures int `json:"failures,omitempty"`
+}
+
+// retryDelay backs off exponentially from -retry, but never waits longer
+// than the regular interval
+func retryDelay(failures int, interval time.Duration) time.Duration {
+	delay := *retryFlag
+	for i := 1; i < failures && delay < interval; i++ {
+		delay *= 2
+	}
+	return min(delay, interval)
+}
+
+// State is the persisted schedule, keyed by service and domain
+type State struct {
+	Entries map[string]*ScheduleEntry `json:"entries"`
+	mu      sync.Mutex
+}
+
+func loadState(path string) (*State, error) {
+	state := &State{Entries: map[string]*ScheduleEntry{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if state.Entries == nil {
+		state.Entries = map[string]*ScheduleEntry{}
+	}
+
+	return state, nil
+}
+
+func (s *State) Save(path string) error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Entry returns the schedule of the engine for the normalized key of a
+// watchlist domain
+func (s *State) Entry(engine registry.Engine, domain string) (*ScheduleEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := engine.Name() + "/" + domain
+	if entry, ok := s.Entries[id]; ok {
+		return entry, nil
+	}
+
+	entry := &ScheduleEntry{Service: engine.Name(), Domain: domain}
+
+	// Data collected before the monitor started is reused instead of fetched again
+	snapshots, err := engine.Snapshots(domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) > 0 {
+		entry.LastRun = snapshots[0].Ts
+		entry.NextRun = snapshots[0].Ts.Add(engine.Interval())
+	}
+
+	s.Entries[id] = entry
+	return entry, nil
+}
+
+type Target struct {
+	Domain  string
+	Engines []string
+}
+
+func defaultEngines() []string {
+	var engines []string
+	for _, name := range strings.Split(*enginesFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			engines = append(engines, name)
+		}
+	}
+	return engines
+}
+
+func readWatchlistFile(path string) ([]Target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watchlist: %w", err)
+	}
+	defer core.Closer(f.Close)()
+
+	var targets []Target
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Optional second column: comma separated engines
+		target := Target{Engines: defaultEngines()}
+		fields := strings.Fields(line)
+		target.Domain = fields[0]
+		if len(fields) > 1 {
+			target.Engines = strings.Split(fields[1], ",")
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, scanner.Err()
+}
+
+func readWatchlistTable(ctx context.Context) ([]Target, error) {
+	models, err := postgres.WatchlistRepo.ListEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, len(models))
+	for i, model := range models {
+		targets[i] = Target{Domain: model.Domain, Engines: model.Engines}
+		if len(model.Engines) == 0 {
+			targets[i].Engines = defaultEngines()
+		}
+	}
+	return targets, nil
+}
+
+func readWatchlist(ctx context.Context) ([]Target, error) {
+	if *watchlistFlag != "" {
+		return readWatchlistFile(*watchlistFlag)
+	}
+	return readWatchlistTable(ctx)
+}
+
+type Monitor struct {
+	State *State
+	Sinks []Sink
+}
+
+func (m *Monitor) alerts(engine registry.Engine, key string) ([]Alert, error) {
+	snapshots, err := engine.Snapshots(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+
+	current, err := snapshots[0].Findings()
+	if err != nil {
+		return nil, err
+	}
+
+	var previous core.Findings
+	if len(snapshots) > 1 {
+		previous, err = snapshots[1].Findings()
+		if err != nil {
+			return nil, err
+		}
+	} else if !*alertInitialFlag {
+		return nil, nil
+	}
+
+	var alerts []Alert
+	for _, change := range core.DiffFindings(previous, current) {
+		if !change.Added {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			Service:       engine.Name(),
+			Key:           key,
+			RunId:         core.Run.Id,
+			DetectedAt:    time.Now(),
+			FindingChange: change,
+		})
+	}
+
+	return alerts, nil
+}
+
+func (m *Monitor) send(ctx context.Context, alerts []Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+
+	for _, sink := range m.Sinks {
+		if err := sink.Send(ctx, alerts); err != nil {
+			core.Logger.Errorf("Failed to send alerts: %v", err)
+		}
+	}
+}
+
+func (m *Monitor) collect(ctx context.Context, engine registry.Engine, entry *ScheduleEntry) {
+	core.Run.InputCount.Add(1)
+	core.Logger.Infof("Collecting %s for %s", engine.Name(), entry.Domain)
+
+	key, err := engine.Collect(ctx, entry.Domain)
+
+	m.State.mu.Lock()
+	if err != nil {
+		// LastRun stays at the last successful collection
+		entry.Failures++
+		entry.LastError = err.Error()
+		entry.NextRun = time.Now().Add(retryDelay(entry.Failures, engine.Interval()))
+	} else {
+		entry.Failures = 0
+		entry.LastError = ""
+		entry.LastRun = time.Now()
+		entry.NextRun = entry.LastRun.Add(engine.Interval())
+	}
+	nextRun := entry.NextRun
+	m.State.mu.Unlock()
+
+	if err != nil {
+		core.Run.FailureCount.Add(1)
+		core.Logger.Errorf("Failed to collect %s for %s, retrying at %s: %v", engine.Name(), entry.Domain, nextRun.Format(time.DateTime), err)
+		return
+	}
+
+	alerts, err := m.alerts(engine, key)
+	if err != nil {
+		core.Run.FailureCount.Add(1)
+		core.Logger.Errorf("Failed to diff %s for %s: %v", engine.Name(), key, err)
+		return
+	}
+
+	core.Run.SuccessCount.Add(1)
+	m.send(ctx, alerts)
+}
+
+// Tick runs every collection that is due
+func (m *Monitor) Tick(ctx context.Context) error {
+	targets, err := readWatchlist(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		for _, name := range target.Engines {
+			engine, err := registry.Get(name)
+			if err != nil {
+				core.Logger.Errorf("Skipping %s: %v", target.Domain, err)
+				continue
+			}
+
+			key, err := engine.Key(ctx, target.Domain)
+			if err != nil {
+				core.Logger.Errorf("Skipping %s: %v", target.Domain, err)
+				continue
+			}
+
+			entry, err := m.State.Entry(engine, key)
+			if err != nil {
+				core.Logger.Errorf("Failed to load schedule of %s/%s: %v", name, target.Domain, err)
+				continue
+			}
+
+			if time.Now().Before(entry.NextRun) {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			m.collect(ctx, engine, entry)
+
+			if err := m.State.Save(*stateFlag); err != nil {
+				core.Logger.Errorf("Failed to save state: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(*sleepFlag):
+			}
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	core.Init()
+
+	if *watchlistFlag == "" {
+		defer postgres.Init(ctx)()
+	} else {
+		defer postgres.InitIfConfigured(ctx)()
+	}
+
+	state := core.Fatal1Err(loadState(*stateFlag))
+
+	monitor := &Monitor{State: state}
+	if *stdoutFlag {
+		monitor.Sinks = append(monitor.Sinks, StdoutSink{})
+	}
+	if *alertFileFlag != "" {
+		monitor.Sinks = append(monitor.Sinks, FileSink{Path: *alertFileFlag})
+	}
+	if *webhookFlag != "" {
+		monitor.Sinks = append(monitor.Sinks, WebhookSink{
+			URL:    *webhookFlag,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+
+	ticker := time.NewTicker(*tickFlag)
+	defer ticker.Stop()
+
+	for {
+		if err := monitor.Tick(ctx); err != nil {
+			core.Logger.Errorf("Monitor tick failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			core.Logger.Info("Stopping monitor")
+			if err := state.Save(*stateFlag); err != nil {
+				core.Logger.Errorf("Failed to save state: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
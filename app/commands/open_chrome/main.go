@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"strings"
 	"sync"
@@ -15,6 +16,8 @@ import (
 )
 
 var reasonFlag = flag.String("reason", "manual check", "Reason for visiting URLs")
+var captureNetworkFlag = flag.Bool("capture-network", true, "Record the requests made while reviewing into visit_requests")
+var screenshotsFlag = flag.Bool("screenshots", true, "Capture viewport and full page screenshots after reviewing")
 
 func main() {
 	ctx := context.Background()
@@ -43,6 +46,9 @@ func main() {
 
 	core.ReadAllLines(func(rawUrl string) {
 		url := strings.TrimSpace(rawUrl)
+		if !core.InScope(url) {
+			return
+		}
 
 		urlModel, err := postgres.UrlRepo.UpsertByRaw(ctx, url)
 		if err != nil {
@@ -51,7 +57,7 @@ func main() {
 		}
 
 		lastVisit, err := postgres.ChromeVisitRepo.GetLastVisitAfter(ctx, urlModel.Id, time.Hour*24*365)
-		if err != nil && err != pgx.ErrNoRows {
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 			core.Logger.Errorf("Failed to check last visit: %v", err)
 			return
 		}
@@ -66,6 +72,7 @@ func main() {
 			OpenedAt:  time.Now(),
 			Success:   true,
 			Reason:    *reasonFlag,
+			RunId:     postgres.CurrentRunId(),
 			CreatedAt: time.Now(),
 		}
 
@@ -73,6 +80,11 @@ func main() {
 		tabCtx := chromeCtx.NewContextWithTimeout(5 * time.Minute)
 		defer tabCtx.Close()
 
+		var recorder *chrome.NetworkRecorder
+		if *captureNetworkFlag {
+			recorder = chrome.RecordNetwork(tabCtx)
+		}
+
 		// Navigate to the target URL in main tab
 		err = tabCtx.Run(
 			chromedp.Navigate(url),
@@ -93,7 +105,8 @@ func main() {
 		}
 		server.Wait()
 
-		err = tabCtx.Run(chromedp.OuterHTML("html", &visit.Html))
+		var html string
+		err = tabCtx.Run(chromedp.OuterHTML("html", &html))
 		if err != nil {
 			visit.Success = false
 			visit.ErrorMsg = err.Error()
@@ -101,9 +114,46 @@ func main() {
 			return
 		}
 
+		if err := visit.SetHtml(ctx, html); err != nil {
+			core.Logger.Errorf("Failed to store HTML: %v", err)
+			return
+		}
+
+		// Taken after the review, so the page shows what the reviewer saw last
+		var viewport, fullPage []byte
+		if *screenshotsFlag {
+			err = tabCtx.Run(
+				chromedp.CaptureScreenshot(&viewport),
+				chromedp.FullScreenshot(&fullPage, 100),
+			)
+			if err != nil {
+				core.Logger.Errorf("Failed to capture screenshots: %v", err)
+			}
+		}
+
 		// Save to database using the existing postgres package
 		if err := postgres.ChromeVisitRepo.Create(ctx, visit); err != nil {
 			core.Logger.Errorf("Failed to save to database: %v", err)
+			return
+		}
+
+		if recorder != nil {
+			if err := postgres.StoreVisitRequests(ctx, visit.Id, chrome.VisitRequests(recorder.Entries())); err != nil {
+				core.Logger.Errorf("Failed to store requests of %s: %v", url, err)
+			}
+		}
+
+		for kind, data := range map[string][]byte{postgres.ScreenshotViewport: viewport, postgres.ScreenshotFullPage: fullPage} {
+			if len(data) == 0 {
+				continue
+			}
+			screenshot, err := chrome.SaveScreenshot(visit.Id, kind, data)
+			if err == nil {
+				err = postgres.StoreVisitScreenshot(ctx, screenshot)
+			}
+			if err != nil {
+				core.Logger.Errorf("Failed to store screenshot: %v", err)
+			}
 		}
 
 		core.Logger.Infof("Processed URL: %s - Title: %s", url, visit.Title)
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/imagehash"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const usage = `Usage: screenshots <command> [flags] [args]
+
+Commands:
+  list <visit id>                  print the screenshot files of the visit
+  report [flags]                   group visually similar pages
+
+report flags:
+  -kind viewport|full   which screenshots are compared, viewport by default
+  -distance N           bits two hashes may differ in to count as similar
+  -min-size N           hide clusters with fewer pages
+  -host, -since         only the latest screenshots of a host or after a time
+  -json                 one JSON line per cluster
+  -html file            write a page of thumbnails per cluster
+`
+
+func list(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	screenshots := core.Fatal1Err(postgres.VisitScreenshotRepo.ListByVisitId(ctx, fs.Arg(0)))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, screenshot := range screenshots {
+		fmt.Fprintf(tw, "%s\t%dx%d\t%016x\t%s\n", screenshot.Kind, screenshot.Width, screenshot.Height, uint64(screenshot.Phash), screenshot.Path)
+	}
+	core.FatalErr(tw.Flush())
+}
+
+type clusterPage struct {
+	VisitId  string    `json:"visit_id"`
+	Url      string    `json:"url"`
+	Hostname string    `json:"hostname"`
+	Title    string    `json:"title"`
+	OpenedAt time.Time `json:"opened_at"`
+	Path     string    `json:"path"`
+	Phash    string    `json:"phash"`
+}
+
+type cluster struct {
+	Id    int           `json:"id"`
+	Size  int           `json:"size"`
+	Pages []clusterPage `json:"pages"`
+}
+
+func report(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	kind := fs.String("kind", postgres.ScreenshotViewport, "Screenshots compared: viewport or full")
+	distance := fs.Int("distance", 6, "Bits two perceptual hashes may differ in to count as similar")
+	minSize := fs.Int("min-size", 1, "Hide clusters with fewer pages")
+	maxPages := fs.Int("max-pages", 10, "Pages printed per cluster in the text report, 0 prints all")
+	host := fs.String("host", "", "Only pages of this hostname")
+	since := fs.Duration("since", 0, "Only pages visited within this duration")
+	jsonFlag := fs.Bool("json", false, "Output clusters as JSON lines")
+	htmlFlag := fs.String("html", "", "Write an HTML report with thumbnails to this file")
+	core.FatalErr(fs.Parse(args))
+
+	if *kind != postgres.ScreenshotViewport && *kind != postgres.ScreenshotFullPage {
+		core.Logger.Fatalf("Unknown -kind %q, use %s or %s", *kind, postgres.ScreenshotViewport, postgres.ScreenshotFullPage)
+	}
+
+	filter := postgres.ScreenshotFilter{Kind: *kind, Hostname: *host}
+	if *since > 0 {
+		filter.Since = time.Now().Add(-*since)
+	}
+
+	summaries := core.Fatal1Err(postgres.ListLatestScreenshots(ctx, filter))
+
+	hashes := make([]uint64, len(summaries))
+	for i, summary := range summaries {
+		hashes[i] = summary.Phash
+	}
+
+	var clusters []cluster
+	for _, indexes := range imagehash.Cluster(hashes, *distance) {
+		if len(indexes) < *minSize {
+			continue
+		}
+
+		c := cluster{Id: len(clusters) + 1, Size: len(indexes)}
+		for _, i := range indexes {
+			summary := summaries[i]
+			c.Pages = append(c.Pages, clusterPage{
+				VisitId:  summary.VisitId,
+				Url:      summary.Url,
+				Hostname: summary.Hostname,
+				Title:    summary.Title,
+				OpenedAt: summary.OpenedAt,
+				Path:     summary.Path,
+				Phash:    fmt.Sprintf("%016x", summary.Phash),
+			})
+		}
+		clusters = append(clusters, c)
+	}
+
+	if *htmlFlag != "" {
+		core.FatalErr(writeHtml(*htmlFlag, clusters))
+		core.Logger.Infof("Wrote %d clusters of %d pages to %s", len(clusters), len(summaries), *htmlFlag)
+		return
+	}
+
+	if *jsonFlag {
+		for _, c := range clusters {
+			fmt.Println(string(core.Fatal1Err(json.Marshal(c))))
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range clusters {
+		fmt.Fprintf(tw, "Cluster %d: %d pages\n", c.Id, c.Size)
+		for i, page := range c.Pages {
+			if *maxPages > 0 && i == *maxPages {
+				fmt.Fprintf(tw, "  ... %d more\n", len(c.Pages)-i)
+				break
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", page.Hostname, page.Title, page.Url, page.Path)
+		}
+		fmt.Fprintln(tw)
+	}
+	core.FatalErr(tw.Flush())
+
+	core.Logger.Infof("%d pages in %d clusters", len(summaries), len(clusters))
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Screenshot clusters</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+.pages { display: flex; flex-wrap: wrap; gap: 12px; }
+.page { width: 320px; font-size: 12px; word-break: break-all; }
+.page img { width: 320px; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+{{range .}}
+<h2>Cluster {{.Id}}: {{.Size}} pages</h2>
+<div class="pages">
+{{range .Pages}}
+<div class="page">
+<a href="{{.Url}}"><img src="{{.Path}}" loading="lazy"></a>
+<div><b>{{.Hostname}}</b> {{.Title}}</div>
+<div>{{.Url}}</div>
+</div>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+func writeHtml(path string, clusters []cluster) error {
+	// Paths are made absolute so the report opens from anywhere
+	for i := range clusters {
+		for j := range clusters[i].Pages {
+			if abs, err := filepath.Abs(clusters[i].Pages[j].Path); err == nil {
+				clusters[i].Pages[j].Path = abs
+			}
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer file.Close()
+
+	if err := reportTemplate.Execute(file, clusters); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list", "report":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	defer postgres.Init(ctx)()
+
+	switch args[0] {
+	case "list":
+		list(ctx, args[1:])
+	case "report":
+		report(ctx, args[1:])
+	}
+}
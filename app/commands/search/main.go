@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const usage = `Usage: search <command> [flags] <query>
+
+Commands:
+  text <query>             full-text search over titles and visible text
+  html <pattern>           literal or -regex search over raw HTML
+  secrets                  emails, API keys, tokens and private keys in raw HTML
+`
+
+// secretPatterns are matched against the raw HTML of every captured body
+var secretPatterns = map[string]string{
+	"email":           `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`,
+	"aws_access_key":  `(AKIA|ASIA)[0-9A-Z]{16}`,
+	"google_api_key":  `AIza[0-9A-Za-z_-]{35}`,
+	"github_token":    `(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}`,
+	"slack_token":     `xox[abposr]-[0-9A-Za-z-]{10,}`,
+	"slack_webhook":   `https://hooks\.slack\.com/services/[A-Za-z0-9/]+`,
+	"stripe_key":      `(sk|rk)_live_[0-9A-Za-z]{24,}`,
+	"jwt":             `eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`,
+	"private_key":     `-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`,
+	"bearer_token":    `[Bb]earer [A-Za-z0-9._~+/-]{20,}`,
+	"basic_auth_url":  `[a-z]+://[^/\s:@"']+:[^/\s:@"']+@[A-Za-z0-9.-]+`,
+	"firebase_config": `[a-z0-9-]+\.firebaseio\.com`,
+}
+
+// Emails matched inside asset names like logo@2x.png
+var assetEmail = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|svg|webp|css|js)$`)
+
+type Match struct {
+	VisitId  string    `json:"visit_id"`
+	Url      string    `json:"url"`
+	Title    string    `json:"title,omitempty"`
+	OpenedAt time.Time `json:"opened_at"`
+	Kind     string    `json:"kind,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Rank     float32   `json:"rank,omitempty"`
+	Snippet  string    `json:"snippet"`
+}
+
+func main() {
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var command func(ctx context.Context, args []string)
+	switch args[0] {
+	case "text":
+		command = searchText
+	case "html":
+		command = searchHtml
+	case "secrets":
+		command = searchSecrets
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	defer postgres.Init(ctx)()
+
+	command(ctx, args[1:])
+}
+
+type commonFlags struct {
+	host  *string
+	tech  *string
+	since *string
+	limit *uint64
+	json  *bool
+}
+
+func addCommonFlags(fs *flag.FlagSet) commonFlags {
+	return commonFlags{
+		host:  fs.String("host", "", "Only search visits of this hostname"),
+		tech:  fs.String("tech", "", "Only search visits of hosts running this technology"),
+		since: fs.String("since", "", "Only search visits opened on or after this date (YYYY-MM-DD)"),
+		limit: fs.Uint64("limit", 50, "Maximum number of visits, 0 for no limit"),
+		json:  fs.Bool("json", false, "Output matches as JSON lines"),
+	}
+}
+
+func (f commonFlags) filter() postgres.VisitSearchFilter {
+	filter := postgres.VisitSearchFilter{Hostname: *f.host, Technology: *f.tech, Limit: *f.limit}
+	if *f.since != "" {
+		filter.Since = core.Fatal1Err(time.ParseInLocation("2006-01-02", *f.since, time.Local))
+	}
+	return filter
+}
+
+func output(match Match, asJson bool) {
+	if asJson {
+		data, err := json.Marshal(match)
+		if err != nil {
+			core.Logger.Error(err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	label := match.Kind
+	if label == "" {
+		label = match.Title
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\n", match.VisitId, match.Url, label, match.Snippet)
+}
+
+func searchText(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("text", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	core.FatalErr(fs.Parse(args))
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	matches := core.Fatal1Err(postgres.ChromeVisitRepo.SearchText(ctx, query, common.filter()))
+	for _, match := range matches {
+		output(Match{
+			VisitId:  match.VisitId,
+			Url:      match.Url,
+			Title:    match.Title,
+			OpenedAt: match.OpenedAt,
+			Rank:     match.Rank,
+			Snippet:  oneLine(match.Snippet),
+		}, *common.json)
+	}
+}
+
+// found is a match in a body, shared by the visits that captured it
+type found struct {
+	kind    string
+	value   string
+	snippet string
+}
+
+var errLimitReached = errors.New("limit reached")
+
+// scanBodies matches every distinct captured body once and outputs the
+// matches for each visit of it, up to limit visits with matches
+func scanBodies(ctx context.Context, common commonFlags, find func(html string) []found) {
+	filter := common.filter()
+	limit := filter.Limit
+	filter.Limit = 0
+
+	store := postgres.BlobStore()
+	cache := make(map[string][]found)
+	visits := uint64(0)
+
+	err := postgres.ChromeVisitRepo.StreamVisitBodies(ctx, filter, func(visit *postgres.VisitBody) error {
+		matches, ok := cache[visit.HtmlHash]
+		if !ok {
+			html, err := store.Get(ctx, visit.HtmlHash)
+			if err != nil {
+				core.Logger.Errorf("Failed to read HTML of visit %s: %v", visit.VisitId, err)
+				return nil
+			}
+			matches = find(string(html))
+			cache[visit.HtmlHash] = matches
+		}
+
+		if len(matches) == 0 {
+			return nil
+		}
+
+		for _, match := range matches {
+			output(Match{
+				VisitId:  visit.VisitId,
+				Url:      visit.Url,
+				Title:    visit.Title,
+				OpenedAt: visit.OpenedAt,
+				Kind:     match.kind,
+				Value:    match.value,
+				Snippet:  match.snippet,
+			}, *common.json)
+		}
+
+		visits++
+		if limit > 0 && visits >= limit {
+			return errLimitReached
+		}
+		return nil
+	})
+	if !errors.Is(err, errLimitReached) {
+		core.FatalErr(err)
+	}
+}
+
+func searchHtml(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("html", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	isRegex := fs.Bool("regex", false, "Treat the pattern as a Go regex")
+	ignoreCase := fs.Bool("i", false, "Match case-insensitively")
+	contextSize := fs.Int("context", 60, "Characters of HTML around each match in snippets")
+	maxMatches := fs.Int("max-matches", 5, "Maximum snippets per visit")
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	pattern := fs.Arg(0)
+	if !*isRegex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re := core.Fatal1Err(regexp.Compile(pattern))
+
+	scanBodies(ctx, common, func(html string) []found {
+		var matches []found
+		for _, loc := range uniqueMatches(re, html, *maxMatches) {
+			matches = append(matches, found{
+				value:   html[loc[0]:loc[1]],
+				snippet: snippet(html, loc, *contextSize),
+			})
+		}
+		return matches
+	})
+}
+
+func searchSecrets(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("secrets", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	kinds := fs.String("kind", "", "Comma separated kinds to look for, all by default: "+strings.Join(secretKinds(), ","))
+	contextSize := fs.Int("context", 40, "Characters of HTML around each match in snippets")
+	maxMatches := fs.Int("max-matches", 20, "Maximum matches per visit and kind")
+	core.FatalErr(fs.Parse(args))
+
+	selected := secretKinds()
+	if *kinds != "" {
+		selected = strings.Split(*kinds, ",")
+	}
+
+	patterns := make(map[string]*regexp.Regexp)
+	for _, kind := range selected {
+		pattern, ok := secretPatterns[kind]
+		if !ok {
+			core.Logger.Fatalf("Unknown kind %q, expected one of %s", kind, strings.Join(secretKinds(), ","))
+		}
+		patterns[kind] = regexp.MustCompile(pattern)
+	}
+
+	scanBodies(ctx, common, func(html string) []found {
+		var matches []found
+		for _, kind := range selected {
+			for _, loc := range uniqueMatches(patterns[kind], html, *maxMatches) {
+				value := html[loc[0]:loc[1]]
+				if kind == "email" && assetEmail.MatchString(value) {
+					continue
+				}
+
+				matches = append(matches, found{
+					kind:    kind,
+					value:   value,
+					snippet: snippet(html, loc, *contextSize),
+				})
+			}
+		}
+		return matches
+	})
+}
+
+func secretKinds() []string {
+	kinds := make([]string, 0, len(secretPatterns))
+	for kind := range secretPatterns {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// uniqueMatches returns the locations of the first max distinct matches
+func uniqueMatches(re *regexp.Regexp, html string, max int) [][]int {
+	seen := make(map[string]bool)
+	var locs [][]int
+	for _, loc := range re.FindAllStringIndex(html, -1) {
+		value := html[loc[0]:loc[1]]
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		locs = append(locs, loc)
+		if len(locs) >= max {
+			break
+		}
+	}
+	return locs
+}
+
+// snippet cuts the match with some context and keeps it on one line
+func snippet(html string, loc []int, contextSize int) string {
+	start := max(loc[0]-contextSize, 0)
+	end := min(loc[1]+contextSize, len(html))
+
+	// Don't cut multibyte characters in half
+	for start > 0 && !isRuneStart(html[start]) {
+		start--
+	}
+	for end < len(html) && !isRuneStart(html[end]) {
+		end++
+	}
+
+	return oneLine(html[start:loc[0]] + ">>>" + html[loc[0]:loc[1]] + "<<<" + html[loc[1]:end])
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/domain"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+var reason = flag.String("reason", "", "Reason for storing the domains, merged into the reasons of existing hosts")
+var checkFlag = flag.Bool("check", false, "Resolve each host and probe ports 443 and 80 to record its resolved/alive status")
+var checkTimeout = flag.Duration("check-timeout", 5*time.Second, "Timeout of each resolve and port probe")
+var newOnly = flag.Bool("new", false, "Only output hosts that were not in the inventory yet")
+
+func extractHost(_ context.Context, line string) (string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", fmt.Errorf("%w: empty line", core.ErrSkip)
+	}
+
+	hostname, err := domain.Normalize(line)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname %q: %w", line, err)
+	}
+
+	if net.ParseIP(hostname) != nil {
+		return "", fmt.Errorf("%w: %s is an IP address", core.ErrSkip, hostname)
+	}
+
+	return hostname, nil
+}
+
+// check resolves the host and dials the usual web ports, a host is alive
+// when any of them accepts a connection
+func check(ctx context.Context, hostname string) (resolved bool, alive bool) {
+	ctx, cancel := context.WithTimeout(ctx, *checkTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, hostname)
+	if err != nil || len(addrs) == 0 {
+		return false, false
+	}
+
+	dialer := net.Dialer{Timeout: *checkTimeout}
+	for _, port := range []string{"443", "80"} {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(hostname, port))
+		if err == nil {
+			conn.Close()
+			return true, true
+		}
+	}
+
+	return true, false
+}
+
+func process(ctx context.Context, hostname string) (string, error) {
+	registrable, err := domain.Registrable(hostname)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registrable domain of %s: %w", hostname, err)
+	}
+
+	host := &postgres.HostModel{
+		Hostname:          hostname,
+		RegistrableDomain: registrable,
+		Reasons:           []string{*reason},
+	}
+
+	if *checkFlag {
+		resolved, alive := check(ctx, hostname)
+		now := time.Now()
+		host.Resolved = &resolved
+		host.Alive = &alive
+		host.CheckedAt = &now
+	}
+
+	inserted, err := postgres.HostRepo.Upsert(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	if *newOnly && !inserted {
+		return "", nil
+	}
+
+	return hostname, nil
+}
+
+func main() {
+	core.Init()
+
+	if *reason == "" {
+		fmt.Fprintln(os.Stderr, "Error: -reason flag is required")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	defer postgres.Init(ctx)()
+
+	core.ProcessLines(core.SimpleConfig[string]{
+		Ctx:          ctx,
+		ThreadsCount: 10,
+		KeyFunc:      extractHost,
+		RunFunc:      process,
+		OutputFunc: func(hostname string) {
+			if hostname != "" {
+				fmt.Println(hostname)
+			}
+		},
+		Unique: true,
+	})
+}
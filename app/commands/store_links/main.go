@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/postgres"
@@ -14,6 +16,12 @@ import (
 // Define flags
 var reason = flag.String("reason", "", "Reason for storing the links")
 var visitID = flag.String("visit", "", "ID of the chrome visit to associate URLs with")
+var batchSize = flag.Int("batch-size", 5000, "Number of URLs stored per batch")
+var flushInterval = flag.Duration("flush-interval", 5*time.Second, "Maximum time URLs are buffered before they are stored")
+var onlyFlags = flag.String("only-flags", "", "Comma separated url flags, only store URLs carrying one of them")
+var skipFlags = flag.String("skip-flags", "", "Comma separated url flags, don't store URLs carrying any of them")
+
+var batcher *postgres.Batcher[postgres.UrlModel]
 
 func process(ctx context.Context, url string) (string, error) {
 	// Clean the URL by removing any control characters
@@ -22,19 +30,48 @@ func process(ctx context.Context, url string) (string, error) {
 		return url, fmt.Errorf("empty URL after cleaning")
 	}
 
-	// Get all urls
-	urlModel, err := postgres.UrlRepo.UpsertByRaw(ctx, cleanURL)
+	urlModel := postgres.UrlModel{
+		Raw:       cleanURL,
+		Flags:     []string{},
+		CreatedAt: time.Now(),
+	}
+	err := urlModel.CalcFromRaw(ctx)
 	if err != nil {
-		core.Logger.Errorf("Failed to upsert URL %s: %v", cleanURL, err)
-		return url, err
+		return url, fmt.Errorf("failed to parse URL %s: %v", cleanURL, err)
+	}
+
+	if !keepFlags(urlModel.Flags) {
+		core.Logger.Debugf("Skipping URL %s with flags %v", cleanURL, urlModel.Flags)
+		return url, nil
 	}
 
-	err = postgres.URLVisitRepo.UpsertRaw(ctx, urlModel.Id, *visitID)
+	return url, batcher.Add(urlModel)
+}
+
+func keepFlags(flags []string) bool {
+	if *onlyFlags != "" && !hasAnyFlag(flags, *onlyFlags) {
+		return false
+	}
+	return *skipFlags == "" || !hasAnyFlag(flags, *skipFlags)
+}
+
+func hasAnyFlag(flags []string, list string) bool {
+	for _, f := range strings.Split(list, ",") {
+		if slices.Contains(flags, strings.TrimSpace(f)) {
+			return true
+		}
+	}
+	return false
+}
+
+func flush(ctx context.Context, batch []postgres.UrlModel) error {
+	urls, err := postgres.StoreUrls(ctx, batch, *visitID)
 	if err != nil {
-		return url, err
+		return err
 	}
 
-	return url, nil
+	core.Logger.Debugf("Stored %d URLs", len(urls))
+	return nil
 }
 
 func main() {
@@ -49,11 +86,21 @@ func main() {
 
 	// Initialize core and postgres
 	core.Init()
-	defer postgres.Init(ctx)()
+	cleanup := postgres.Init(ctx)
+	defer cleanup()
+
+	batcher = postgres.NewBatcher(ctx, *batchSize, *flushInterval, flush)
 
 	core.ProcessLines(core.SimpleConfig[string]{
 		Ctx:          ctx,
 		ThreadsCount: 10,
 		RunFunc:      process,
+		// Lines are only buffered here, the database work happens per batch
+		SleepTime: time.Microsecond,
 	})
+
+	if err := batcher.Close(); err != nil {
+		core.Closer(cleanup)()
+		core.Logger.Fatalf("Failed to store URLs: %v", err)
+	}
 }
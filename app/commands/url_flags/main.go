@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/canonical"
+	"github.com/mgorunuch/microb/app/core/postgres"
+	"github.com/mgorunuch/microb/app/core/urlflags"
+)
+
+const usage = `Usage: url_flags <command> [flags]
+
+Commands:
+  backfill                 classify stored urls again with the current rules
+  list                     print stored urls carrying the given flags
+  rules                    print the effective rules as JSON
+`
+
+func main() {
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "backfill":
+		defer postgres.Init(ctx)()
+		backfill(ctx, args[1:])
+	case "list":
+		defer postgres.Init(ctx)()
+		list(ctx, args[1:])
+	case "rules":
+		rules()
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func backfill(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	batchSize := fs.Uint64("batch-size", 5000, "Number of urls classified per query")
+	core.FatalErr(fs.Parse(args))
+
+	classifier := urlflags.Default()
+	opts := canonical.DefaultOptions()
+
+	checked, changed := 0, 0
+	err := postgres.UrlRepo.StreamPages(ctx, "id", func(model *postgres.UrlModel) any {
+		return model.Id
+	}, *batchSize, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder
+	}, func(page []postgres.UrlModel) error {
+		var ids []string
+		var flags [][]string
+		for _, model := range page {
+			checked++
+
+			u, err := canonical.Parse(model.Canonical, opts)
+			if err != nil {
+				core.Logger.Debugf("Skipping url %s: %v", model.Canonical, err)
+				continue
+			}
+
+			classified := classifier.Classify(u)
+			if slices.Equal(classified, model.Flags) {
+				continue
+			}
+			ids = append(ids, model.Id)
+			flags = append(flags, classified)
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		changed += len(ids)
+		core.Logger.Debugf("Reclassified %d of %d urls", changed, checked)
+		return postgres.UrlRepo.UpdateFlags(ctx, ids, flags)
+	})
+	core.FatalErr(err)
+
+	core.Logger.Infof("Reclassified %d of %d urls", changed, checked)
+}
+
+func list(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	flags := fs.String("flag", "", "Comma separated flags the urls must all carry")
+	host := fs.String("host", "", "Only list urls of this hostname")
+	raw := fs.Bool("raw", false, "Print the urls as they were found instead of their canonical form")
+	core.FatalErr(fs.Parse(args))
+
+	var required []string
+	for _, f := range strings.Split(*flags, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			required = append(required, f)
+		}
+	}
+
+	err := postgres.UrlRepo.StreamByFlags(ctx, required, *host, func(model *postgres.UrlModel) error {
+		if *raw {
+			fmt.Println(model.Raw)
+		} else {
+			fmt.Println(model.Canonical)
+		}
+		return nil
+	})
+	core.FatalErr(err)
+}
+
+func rules() {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	core.FatalErr(encoder.Encode(urlflags.Rules()))
+}
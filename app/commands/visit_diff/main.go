@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/canonical"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+var urlFlag = flag.String("url", "", "Compare the two latest visits of this URL instead of two visit IDs")
+var textFlag = flag.Bool("text", false, "Compare the visible text instead of the HTML")
+var contextFlag = flag.Int("context", 3, "Unchanged lines shown around each change")
+var maxEditsFlag = flag.Int("max-edits", 20000, "Give up when the bodies differ in more lines than this")
+
+const usage = `Usage: visit_diff <old visit id> <new visit id>
+       visit_diff -url <url>
+`
+
+// Splitting after tags and sentences gives minified pages lines to diff
+var (
+	tagBoundary      = regexp.MustCompile(`>\s*`)
+	sentenceBoundary = regexp.MustCompile(`([.!?])\s+`)
+)
+
+func loadVisits(ctx context.Context) (*postgres.ChromeVisitModel, *postgres.ChromeVisitModel) {
+	if *urlFlag != "" {
+		canonicalUrl := core.Fatal1Err(canonical.String(*urlFlag))
+		urlModel, err := postgres.UrlRepo.GetByCanonical(ctx, canonicalUrl)
+		if err != nil {
+			core.Logger.Fatalf("URL %s is not stored: %v", canonicalUrl, err)
+		}
+
+		visits := core.Fatal1Err(postgres.ChromeVisitRepo.ListLastVisits(ctx, urlModel.Id, 2))
+		if len(visits) < 2 {
+			core.Logger.Fatalf("URL %s has %d visits with captured HTML, need 2", canonicalUrl, len(visits))
+		}
+		return &visits[1], &visits[0]
+	}
+
+	if flag.NArg() != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	return core.Fatal1Err(postgres.ChromeVisitRepo.GetById(ctx, flag.Arg(0))),
+		core.Fatal1Err(postgres.ChromeVisitRepo.GetById(ctx, flag.Arg(1)))
+}
+
+func lines(ctx context.Context, visit *postgres.ChromeVisitModel) []string {
+	html := core.Fatal1Err(visit.LoadHtml(ctx))
+
+	var split string
+	if *textFlag {
+		split = sentenceBoundary.ReplaceAllString(core.VisibleText(html), "$1\n")
+	} else {
+		split = tagBoundary.ReplaceAllString(html, ">\n")
+	}
+
+	var result []string
+	for _, line := range strings.Split(split, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+func main() {
+	core.Init()
+
+	ctx := context.Background()
+	defer postgres.Init(ctx)()
+
+	oldVisit, newVisit := loadVisits(ctx)
+	if oldVisit.HtmlHash == nil || newVisit.HtmlHash == nil {
+		core.Logger.Fatal("Both visits need captured HTML")
+	}
+
+	// Same hash, same content, nothing to load
+	if *oldVisit.HtmlHash == *newVisit.HtmlHash {
+		core.Logger.Infof("Unchanged between %s and %s", oldVisit.OpenedAt.Format("2006-01-02 15:04"), newVisit.OpenedAt.Format("2006-01-02 15:04"))
+		return
+	}
+
+	script, err := core.DiffLines(lines(ctx, oldVisit), lines(ctx, newVisit), *maxEditsFlag)
+	if err != nil {
+		core.Logger.Fatal(err)
+	}
+
+	diff := core.UnifiedDiff(script, *contextFlag)
+	if diff == "" {
+		core.Logger.Infof("Only whitespace changed between %s and %s", oldVisit.Id, newVisit.Id)
+		return
+	}
+
+	fmt.Printf("--- %s %s\n", oldVisit.Id, oldVisit.OpenedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("+++ %s %s\n", newVisit.Id, newVisit.OpenedAt.Format("2006-01-02 15:04:05"))
+	fmt.Print(diff)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/har"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const usage = `Usage: visit_requests <command> [flags] <visit id>...
+
+Commands:
+  list [-json] <visit id>          print the requests recorded during the visit
+  har [-bodies] <visit id>...      export the requests of the visits as HAR
+`
+
+func list(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Output requests as JSON lines")
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	requests := core.Fatal1Err(postgres.VisitRequestRepo.ListByVisitId(ctx, fs.Arg(0)))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !*jsonFlag {
+		fmt.Fprintln(tw, "SEQ\tSTATUS\tMETHOD\tTYPE\tSIZE\tTIME\tURL")
+	}
+	for _, request := range requests {
+		if *jsonFlag {
+			fmt.Println(string(core.Fatal1Err(json.Marshal(request))))
+			continue
+		}
+
+		status := fmt.Sprint(request.Status)
+		if request.ErrorText != "" {
+			status = request.ErrorText
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%.0fms\t%s\n",
+			request.Seq, status, request.Method, request.ResourceType, request.EncodedSize, request.DurationMs, request.Url)
+	}
+	core.FatalErr(tw.Flush())
+}
+
+func exportHar(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("har", flag.ExitOnError)
+	bodiesFlag := fs.Bool("bodies", false, "Include the captured response bodies")
+	core.FatalErr(fs.Parse(args))
+
+	if fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	archive := har.New("microb", "1.0")
+	for _, visitId := range fs.Args() {
+		visit := core.Fatal1Err(postgres.ChromeVisitRepo.GetById(ctx, visitId))
+		archive.AddPage(visit.Id, visit.Title, visit.OpenedAt)
+
+		requests := core.Fatal1Err(postgres.VisitRequestRepo.ListByVisitId(ctx, visitId))
+		for i := range requests {
+			entry := harEntry(&requests[i])
+			entry.Pageref = visit.Id
+
+			if *bodiesFlag {
+				body, err := requests[i].LoadBody(ctx)
+				if err != nil {
+					core.Logger.Warnf("Failed to load body of %s: %v", requests[i].Url, err)
+				} else if body != nil {
+					entry.Response.Content.SetBody(body)
+				}
+			}
+
+			archive.Log.Entries = append(archive.Log.Entries, entry)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	core.FatalErr(encoder.Encode(archive))
+}
+
+func harEntry(request *postgres.VisitRequestModel) har.Entry {
+	httpVersion := strings.ToUpper(request.Protocol)
+
+	entry := har.Entry{
+		StartedDateTime: request.StartedAt,
+		Time:            request.DurationMs,
+		Request: har.Request{
+			Method:      request.Method,
+			Url:         request.Url,
+			HttpVersion: httpVersion,
+			Cookies:     []har.Cookie{},
+			Headers:     har.Headers(request.RequestHeaders),
+			QueryString: har.QueryString(request.Url),
+			HeadersSize: -1,
+			BodySize:    len(request.PostData),
+		},
+		Response: har.Response{
+			Status:      request.Status,
+			StatusText:  request.StatusText,
+			HttpVersion: httpVersion,
+			Cookies:     []har.Cookie{},
+			Headers:     har.Headers(request.ResponseHeaders),
+			Content:     har.Content{MimeType: request.MimeType},
+			RedirectURL: request.RedirectUrl,
+			HeadersSize: -1,
+			BodySize:    request.EncodedSize,
+		},
+		Timings:         har.Timings{Send: 0, Wait: request.DurationMs, Receive: 0},
+		ServerIPAddress: strings.Trim(request.RemoteIp, "[]"),
+		Comment:         request.ErrorText,
+	}
+
+	if len(request.PostData) > 0 {
+		entry.Request.PostData = &har.PostData{
+			MimeType: request.RequestHeaders["Content-Type"],
+			Text:     string(request.PostData),
+		}
+	}
+
+	return entry
+}
+
+func main() {
+	ctx := context.Background()
+
+	core.Init()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list", "har":
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	defer postgres.Init(ctx)()
+
+	switch args[0] {
+	case "list":
+		list(ctx, args[1:])
+	case "har":
+		exportHar(ctx, args[1:])
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+
 	"github.com/mgorunuch/microb/app/core"
 	"github.com/mgorunuch/microb/app/core/cache"
+	"github.com/mgorunuch/microb/app/core/postgres"
 	"github.com/mgorunuch/microb/app/engine/web_archive"
 )
 
 func main() {
+	ctx := context.Background()
+
 	core.Init()
+	defer postgres.InitIfConfigured(ctx)()
+
 	core.ProcessLinesWithCache(core.Config[[]string]{
-		CacheProvider: cache.NewDefaultFileCache[[]string]("web_archive", core.YEAR),
+		CacheProvider: cache.NewProvider[[]string](ctx, "web_archive", core.YEAR),
 		ThreadsCount:  1,
 		KeyFunc:       core.ParseUrlHostName,
 		RunFunc:       web_archive.Get,
@@ -0,0 +1,127 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mgorunuch/microb/app/core"
+)
+
+var (
+	ErrNotFound    = errors.New("blob not found")
+	ErrInvalidHash = errors.New("invalid blob hash")
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Store keeps content addressed by the hex SHA-256 of the uncompressed
+// bytes, storing the same content twice is a no-op
+type Store interface {
+	Put(ctx context.Context, data []byte) (hash string, err error)
+	Get(ctx context.Context, hash string) ([]byte, error)
+	Has(ctx context.Context, hash string) (bool, error)
+}
+
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateHash(hash string) error {
+	if !hashPattern.MatchString(hash) {
+		return fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+	return nil
+}
+
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	decoder, _ = zstd.NewReader(nil)
+)
+
+func Compress(data []byte) []byte {
+	return encoder.EncodeAll(data, nil)
+}
+
+// Decompress also checks that the content matches its hash
+func Decompress(hash string, compressed []byte) ([]byte, error) {
+	data, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress blob %s: %w", hash, err)
+	}
+
+	if Hash(data) != hash {
+		return nil, fmt.Errorf("blob %s is corrupted", hash)
+	}
+
+	return data, nil
+}
+
+// DirStore keeps compressed blobs as files under Root, fanned out by the
+// first two characters of the hash
+type DirStore struct {
+	Root string
+}
+
+func NewDirStore(root string) *DirStore {
+	return &DirStore{Root: root}
+}
+
+func (s *DirStore) path(hash string) string {
+	return filepath.Join(s.Root, hash[:2], hash+".zst")
+}
+
+func (s *DirStore) Put(_ context.Context, data []byte) (string, error) {
+	hash := Hash(data)
+	path := s.path(hash)
+
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Written under a temporary name so readers never see partial blobs
+	if err := core.WriteFileAtomic(path, Compress(data), 0644); err != nil {
+		return "", fmt.Errorf("failed to store blob %s: %w", hash, err)
+	}
+
+	return hash, nil
+}
+
+func (s *DirStore) Get(_ context.Context, hash string) ([]byte, error) {
+	if err := ValidateHash(hash); err != nil {
+		return nil, err
+	}
+
+	compressed, err := os.ReadFile(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", hash, err)
+	}
+
+	return Decompress(hash, compressed)
+}
+
+func (s *DirStore) Has(_ context.Context, hash string) (bool, error) {
+	if err := ValidateHash(hash); err != nil {
+		return false, err
+	}
+
+	_, err := os.Stat(s.path(hash))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
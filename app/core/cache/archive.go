@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+const manifestFileName = "manifest.json"
+
+// Manifest is the first entry of a cache archive and describes its content
+type Manifest struct {
+	CreatedAt time.Time      `json:"created_at"`
+	Host      string         `json:"host"`
+	Services  []ServiceStats `json:"services"`
+}
+
+// Export writes the services stored under root as a gzipped tarball. Entries
+// are stored as "<service>/<path inside the service directory>".
+func Export(w io.Writer, root string, services []string) (Manifest, error) {
+	host, _ := os.Hostname()
+	manifest := Manifest{CreatedAt: time.Now(), Host: host}
+
+	for _, service := range services {
+		stats, err := NewFileCache[any](filepath.Join(root, service), 0).Stats(service)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Services = append(manifest.Services, stats)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    manifestFileName,
+		Mode:    0644,
+		Size:    int64(len(manifestData)),
+		ModTime: manifest.CreatedAt,
+	})
+	if err != nil {
+		return manifest, fmt.Errorf("failed to write manifest header: %w", err)
+	}
+	if _, err := tw.Write(manifestData); err != nil {
+		return manifest, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	for _, service := range services {
+		serviceDir := filepath.Join(root, service)
+		err := filepath.Walk(serviceDir, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == locksDirName {
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() || isTmpFile(info.Name()) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(serviceDir, filePath)
+			if err != nil {
+				return err
+			}
+
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = path.Join(service, filepath.ToSlash(rel))
+
+			if err := tw.WriteHeader(header); err != nil {
+				return fmt.Errorf("failed to write header of %s: %w", filePath, err)
+			}
+
+			f, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if _, err := io.Copy(tw, f); err != nil {
+				return fmt.Errorf("failed to write %s: %w", filePath, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return manifest, fmt.Errorf("failed to export %s: %w", service, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to close archive: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// Import extracts an archive written by Export into root. Snapshots that
+// already exist are kept and the service indexes are merged.
+func Import(r io.Reader, root string) (Manifest, int, error) {
+	var manifest Manifest
+	written := 0
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, 0, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	header, err := tr.Next()
+	if err != nil {
+		return manifest, 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if header.Name != manifestFileName {
+		return manifest, 0, fmt.Errorf("archive does not start with %s", manifestFileName)
+	}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return manifest, 0, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	indexes := map[string][]indexEntry{}
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, written, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		service, rel, ok := strings.Cut(name, "/")
+		if !ok || path.IsAbs(name) || service == ".." || strings.HasPrefix(rel, "../") {
+			return manifest, written, fmt.Errorf("invalid archive entry: %s", header.Name)
+		}
+
+		if rel == indexFileName {
+			entries, err := parseIndex(tr)
+			if err != nil {
+				return manifest, written, fmt.Errorf("failed to read index of %s: %w", service, err)
+			}
+			indexes[service] = append(indexes[service], entries...)
+			continue
+		}
+
+		target := filepath.Join(root, service, filepath.FromSlash(rel))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return manifest, written, fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return manifest, written, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		if err := core.WriteFileAtomic(target, data, 0644); err != nil {
+			return manifest, written, fmt.Errorf("failed to write %s: %w", target, err)
+		}
+
+		if _, ok := parseSnapshotName(path.Base(rel)); ok {
+			written++
+		}
+	}
+
+	for service, imported := range indexes {
+		if err := mergeIndex(filepath.Join(root, service), imported); err != nil {
+			return manifest, written, err
+		}
+	}
+
+	return manifest, written, nil
+}
+
+func mergeIndex(dir string, imported []indexEntry) error {
+	fc := NewFileCache[any](dir, 0)
+
+	unlock, err := fc.lock(indexFileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := fc.readIndex()
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	for _, entry := range entries {
+		known[entry.Key] = true
+	}
+	for _, entry := range imported {
+		if !known[entry.Key] {
+			known[entry.Key] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	return fc.writeIndex(entries)
+}
+
+func parseIndex(r io.Reader) ([]indexEntry, error) {
+	var entries []indexEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry indexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
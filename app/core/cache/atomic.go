@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+// Temporary files start with a dot so they are never parsed as snapshots
+const tmpFilePrefix = core.TmpFilePrefix
+
+// locksDirName holds the advisory lock files of a service cache
+const locksDirName = ".locks"
+
+func isTmpFile(name string) bool {
+	return strings.HasPrefix(name, tmpFilePrefix)
+}
+
+// lock takes an exclusive advisory lock named after name, shared by every
+// process using the same cache directory. Names may contain directories
+func (fc *FileCache[T]) lock(name string) (func(), error) {
+	lockPath := filepath.Join(fc.Dir, locksDirName, name+".lock")
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating lock directory: %w", err)
+	}
+
+	unlock, err := lockFile(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %w", name, err)
+	}
+
+	return unlock, nil
+}
+
+// LockKey blocks until no other worker or process holds the key. Key locks
+// are sharded like the key directories so .locks stays small
+func (fc *FileCache[T]) LockKey(key string) (func(), error) {
+	return fc.lock(keyPath(key))
+}
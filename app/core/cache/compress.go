@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mgorunuch/microb/app/core"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var compressionExtensions = map[string]string{
+	CompressionNone: ".json",
+	CompressionGzip: ".json.gz",
+	CompressionZstd: ".json.zst",
+}
+
+func CACHE_COMPRESSION() string {
+	return core.Env.GetDefault("CACHE_COMPRESSION", CompressionZstd)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder = core.Fatal1Err(zstd.NewWriter(nil))
+		zstdDecoder = core.Fatal1Err(zstd.NewReader(nil))
+	})
+}
+
+func compress(compression string, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", compression)
+	}
+}
+
+// readSnapshotFile returns the decompressed payload, the compression is
+// detected from the file extension
+func readSnapshotFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(path, compressionExtensions[CompressionGzip]):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case strings.HasSuffix(path, compressionExtensions[CompressionZstd]):
+		initZstd()
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core/postgres"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Snapshot is one stored response of a key, Read loads it on demand and
+// ReadMeta tells which run stored it
+type Snapshot[T any] struct {
+	Key      string
+	Ts       time.Time
+	Read     func() (T, error)
+	ReadMeta func() (SnapshotMeta, error)
+}
+
+// HistoryProvider is implemented by the caches that can list their keys and
+// the responses stored for a key, failures are left out
+type HistoryProvider[T any] interface {
+	Keys() ([]string, error)
+	// Snapshots returns the responses of the key, newest first
+	Snapshots(key string) ([]Snapshot[T], error)
+}
+
+func (fc *FileCache[T]) Snapshots(key string) ([]Snapshot[T], error) {
+	records, err := fc.Records(key)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot[T], len(records))
+	for i, record := range records {
+		snapshots[i] = Snapshot[T]{Key: key, Ts: record.Ts, Read: record.Read, ReadMeta: record.ReadMeta}
+	}
+	return snapshots, nil
+}
+
+func (pc *PostgresCache[T]) Keys() ([]string, error) {
+	rows, err := postgres.Pool.Query(pc.Ctx, `
+		select distinct key from cache_entries
+		where service = $1 and status <> 'error'
+		order by key
+	`, pc.Service)
+	if err != nil {
+		return nil, fmt.Errorf("error listing cache keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("error scanning cache key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (pc *PostgresCache[T]) Snapshots(key string) ([]Snapshot[T], error) {
+	rows, err := postgres.Pool.Query(pc.Ctx, `
+		select ce.id, ce.created_at, ce.status, coalesce(ce.run_id, ''), coalesce(cr.command, ''), cr.started_at
+		from cache_entries ce
+		left join command_runs cr on cr.id::text = ce.run_id
+		where ce.service = $1 and ce.key = $2 and ce.status <> 'error'
+		order by ce.created_at desc
+	`, pc.Service, key)
+	if err != nil {
+		return nil, fmt.Errorf("error listing cache entries: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot[T]
+	for rows.Next() {
+		var id int64
+		var startedAt *time.Time
+		var meta SnapshotMeta
+		if err := rows.Scan(&id, &meta.CreatedAt, &meta.Status, &meta.RunId, &meta.Command, &startedAt); err != nil {
+			return nil, fmt.Errorf("error scanning cache entry: %w", err)
+		}
+		if startedAt != nil {
+			meta.StartedAt = *startedAt
+		}
+
+		snapshots = append(snapshots, Snapshot[T]{
+			Key: key,
+			Ts:  meta.CreatedAt,
+			Read: func() (T, error) {
+				return pc.read(id)
+			},
+			ReadMeta: func() (SnapshotMeta, error) {
+				return meta, nil
+			},
+		})
+	}
+	return snapshots, rows.Err()
+}
+
+func (pc *PostgresCache[T]) read(id int64) (T, error) {
+	var value T
+	var data []byte
+
+	err := postgres.Pool.QueryRow(pc.Ctx, "select data from cache_entries where id = $1", id).Scan(&data)
+	if err != nil {
+		return value, fmt.Errorf("error getting cache entry: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("error unmarshaling cache data: %w", err)
+	}
+	return value, nil
+}
+
+func (mc *MongoCache[T]) Keys() ([]string, error) {
+	values, err := mc.Collection.Distinct(mc.Ctx, mc.KeyField, bson.M{"data": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, fmt.Errorf("error listing cache keys: %w", err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for _, value := range values {
+		if key, ok := value.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Snapshots returns the only response mongo keeps per key
+func (mc *MongoCache[T]) Snapshots(key string) ([]Snapshot[T], error) {
+	var doc struct {
+		Timestamp time.Time `bson:"timestamp"`
+		RunId     string    `bson:"run_id"`
+		Command   string    `bson:"command"`
+		StartedAt time.Time `bson:"started_at"`
+		Status    string    `bson:"status"`
+	}
+	err := mc.Collection.FindOne(mc.Ctx, mc.filter(key)).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting cache entry: %w", err)
+	}
+
+	meta := SnapshotMeta{
+		RunId:     doc.RunId,
+		Command:   doc.Command,
+		CreatedAt: doc.Timestamp,
+		StartedAt: doc.StartedAt,
+		Status:    doc.Status,
+	}
+	return []Snapshot[T]{{
+		Key: key,
+		Ts:  doc.Timestamp,
+		Read: func() (T, error) {
+			return mc.GetFromCache(key)
+		},
+		ReadMeta: func() (SnapshotMeta, error) {
+			return meta, nil
+		},
+	}}, nil
+}
+
+func (tc *TieredCache[T]) Keys() ([]string, error) {
+	history, err := tc.history()
+	if err != nil {
+		return nil, err
+	}
+	return history.Keys()
+}
+
+func (tc *TieredCache[T]) Snapshots(key string) ([]Snapshot[T], error) {
+	history, err := tc.history()
+	if err != nil {
+		return nil, err
+	}
+	return history.Snapshots(key)
+}
+
+func (tc *TieredCache[T]) history() (HistoryProvider[T], error) {
+	history, ok := tc.Backend.(HistoryProvider[T])
+	if !ok {
+		return nil, fmt.Errorf("cache backend %T does not keep a history", tc.Backend)
+	}
+	return history, nil
+}
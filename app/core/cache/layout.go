@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+// Keys are stored in sharded directories named after their hash:
+//
+//	<dir>/<hash[0:2]>/<hash[2:4]>/<hash>/<unix nano><ext>
+//
+// The original key is kept in a "key" file inside the key directory and in
+// the "index" file at the root of the cache, one JSON entry per line. The
+// last failed fetch of the key is kept in a "failure.json" file.
+const (
+	indexFileName   = "index"
+	keyFileName     = "key"
+	failureFileName = "failure.json"
+	metaFileSuffix  = ".meta.json"
+)
+
+type indexEntry struct {
+	Key  string `json:"key"`
+	Path string `json:"path"`
+}
+
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func keyPath(key string) string {
+	hash := keyHash(key)
+	return filepath.Join(hash[0:2], hash[2:4], hash)
+}
+
+func isMetaFile(name string) bool {
+	return strings.HasSuffix(name, metaFileSuffix)
+}
+
+// parseSnapshotName returns the timestamp a snapshot file name starts with
+func parseSnapshotName(name string) (int64, bool) {
+	if isMetaFile(name) {
+		return 0, false
+	}
+
+	stamp, _, _ := strings.Cut(name, ".")
+	ts, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return ts, true
+}
+
+func metaFilePath(keyDir string, ts time.Time) string {
+	return filepath.Join(keyDir, fmt.Sprintf("%d%s", ts.UnixNano(), metaFileSuffix))
+}
+
+// ensureKeyDir creates the key directory and registers it in the index
+func (fc *FileCache[T]) ensureKeyDir(key string) (string, error) {
+	keyDir := fc.getKeyDir(key)
+
+	exists, err := keyDirExists(keyDir)
+	if err != nil || exists {
+		return keyDir, err
+	}
+
+	// Another process may register the key between the check and the lock
+	unlock, err := fc.lock(indexFileName)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	exists, err = keyDirExists(keyDir)
+	if err != nil || exists {
+		return keyDir, err
+	}
+
+	if err := os.MkdirAll(keyDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	entry, err := json.Marshal(indexEntry{Key: key, Path: keyPath(key)})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling index entry: %w", err)
+	}
+
+	index, err := os.OpenFile(filepath.Join(fc.Dir, indexFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("error opening cache index: %w", err)
+	}
+	defer index.Close()
+
+	if _, err := index.Write(append(entry, '\n')); err != nil {
+		return "", fmt.Errorf("error writing cache index: %w", err)
+	}
+
+	if err := core.WriteFileAtomic(filepath.Join(keyDir, keyFileName), []byte(key), 0644); err != nil {
+		return "", fmt.Errorf("error writing cache key file: %w", err)
+	}
+
+	return keyDir, nil
+}
+
+// keyDirExists reports whether the key directory was fully registered, the
+// key file is written last
+func keyDirExists(keyDir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(keyDir, keyFileName))
+	if err == nil {
+		return true, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, fmt.Errorf("error checking cache directory: %w", err)
+	}
+	return false, nil
+}
+
+func (fc *FileCache[T]) readIndex() ([]indexEntry, error) {
+	f, err := os.Open(filepath.Join(fc.Dir, indexFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer f.Close()
+
+	var entries []indexEntry
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry indexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if seen[entry.Key] {
+			continue
+		}
+		seen[entry.Key] = true
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+type lruEntry[T any] struct {
+	key      string
+	value    T
+	storedAt time.Time
+}
+
+// TieredCache keeps the most recently used values in memory in front of a
+// slower CacheProvider
+type TieredCache[T any] struct {
+	Backend       core.CacheProvider[T]
+	Size          int
+	ExpirationTTL time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func NewTieredCache[T any](backend core.CacheProvider[T], size int, expirationTTL time.Duration) *TieredCache[T] {
+	return &TieredCache[T]{
+		Backend:       backend,
+		Size:          size,
+		ExpirationTTL: expirationTTL,
+		order:         list.New(),
+		entries:       map[string]*list.Element{},
+	}
+}
+
+func (tc *TieredCache[T]) get(key string) (T, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	var zero T
+	el, ok := tc.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := el.Value.(*lruEntry[T])
+	if tc.ExpirationTTL != 0 && time.Since(entry.storedAt) > tc.ExpirationTTL {
+		tc.order.Remove(el)
+		delete(tc.entries, key)
+		return zero, false
+	}
+
+	tc.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (tc *TieredCache[T]) put(key string, value T, storedAt time.Time) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if el, ok := tc.entries[key]; ok {
+		el.Value = &lruEntry[T]{key: key, value: value, storedAt: storedAt}
+		tc.order.MoveToFront(el)
+		return
+	}
+
+	tc.entries[key] = tc.order.PushFront(&lruEntry[T]{key: key, value: value, storedAt: storedAt})
+
+	for tc.order.Len() > tc.Size {
+		oldest := tc.order.Back()
+		tc.order.Remove(oldest)
+		delete(tc.entries, oldest.Value.(*lruEntry[T]).key)
+	}
+}
+
+func (tc *TieredCache[T]) remove(key string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if el, ok := tc.entries[key]; ok {
+		tc.order.Remove(el)
+		delete(tc.entries, key)
+	}
+}
+
+func (tc *TieredCache[T]) HasCached(key string) (bool, error) {
+	if _, ok := tc.get(key); ok {
+		return true, nil
+	}
+	return tc.Backend.HasCached(key)
+}
+
+func (tc *TieredCache[T]) GetFromCache(key string) (T, error) {
+	if value, ok := tc.get(key); ok {
+		return value, nil
+	}
+
+	value, err := tc.Backend.GetFromCache(key)
+	if err != nil {
+		return value, err
+	}
+
+	// The backend does not expose when the value was stored, so the memory
+	// copy can live for at most one more TTL
+	tc.put(key, value, time.Now())
+	return value, nil
+}
+
+func (tc *TieredCache[T]) AddToCache(key string, value T) error {
+	if err := tc.Backend.AddToCache(key, value); err != nil {
+		return err
+	}
+
+	tc.put(key, value, time.Now())
+	return nil
+}
+
+func (tc *TieredCache[T]) GetFailure(key string) (core.CacheFailure, bool, error) {
+	if negativeCache, ok := tc.Backend.(core.NegativeCacheProvider); ok {
+		return negativeCache.GetFailure(key)
+	}
+	return core.CacheFailure{}, false, nil
+}
+
+func (tc *TieredCache[T]) AddFailureToCache(key string, failure core.CacheFailure) error {
+	// The failure is now the latest result of the key, the memory copy of an
+	// older response must not be served anymore
+	defer tc.remove(key)
+
+	if negativeCache, ok := tc.Backend.(core.NegativeCacheProvider); ok {
+		return negativeCache.AddFailureToCache(key, failure)
+	}
+	return nil
+}
+
+func (tc *TieredCache[T]) LockKey(key string) (func(), error) {
+	if locker, ok := tc.Backend.(core.LockingCacheProvider); ok {
+		return locker.LockKey(key)
+	}
+	return func() {}, nil
+}
@@ -3,13 +3,24 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/mgorunuch/microb/app/core"
 	"os"
 	"path/filepath"
-	"sort"
 	"time"
+
+	"github.com/mgorunuch/microb/app/core"
 )
 
+// SnapshotMeta is stored next to every cache snapshot and records its provenance
+type SnapshotMeta struct {
+	RunId     string    `json:"run_id"`
+	Command   string    `json:"command"`
+	CreatedAt time.Time `json:"created_at"`
+	// StartedAt is when the run started, blank in snapshots written before it was recorded
+	StartedAt time.Time `json:"started_at"`
+	// Status is either ok or empty, snapshots written before it was recorded leave it blank
+	Status string `json:"status,omitempty"`
+}
+
 func NewDefaultFileCache[T any](service string, ttl time.Duration) *FileCache[T] {
 	return NewFileCache[T](filepath.Join("cache", service), ttl)
 }
@@ -18,20 +29,22 @@ func NewFileCache[T any](dir string, expirationTTL time.Duration) *FileCache[T]
 	return &FileCache[T]{
 		Dir:           dir,
 		ExpirationTTL: expirationTTL,
+		Compression:   CACHE_COMPRESSION(),
 	}
 }
 
 type FileCache[T any] struct {
 	Dir           string
 	ExpirationTTL time.Duration
+	Compression   string
 }
 
 func (fc *FileCache[T]) getKeyDir(key string) string {
-	return filepath.Join(fc.Dir, key)
+	return filepath.Join(fc.Dir, keyPath(key))
 }
 
-func (fc *FileCache[T]) getCacheFilePath(key string, timestamp time.Time) string {
-	return filepath.Join(fc.getKeyDir(key), fmt.Sprintf("%d", timestamp.UnixNano()))
+func (fc *FileCache[T]) getCacheFilePath(keyDir string, timestamp time.Time) string {
+	return filepath.Join(keyDir, fmt.Sprintf("%d%s", timestamp.UnixNano(), compressionExtensions[fc.Compression]))
 }
 
 func (fc *FileCache[T]) getLatestCacheFile(key string) (string, error) {
@@ -43,39 +56,34 @@ func (fc *FileCache[T]) getLatestCacheFile(key string) (string, error) {
 		return "", err
 	}
 
-	if len(files) == 0 {
-		return "", os.ErrNotExist
-	}
-
-	// Get all timestamps
-	var timestamps []int64
+	// Find the latest snapshot
+	var latestTs int64
+	var latestName string
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
-		ts, err := core.ParseInt64(file.Name())
-		if err != nil {
+		ts, ok := parseSnapshotName(file.Name())
+		if !ok {
 			continue
 		}
-		timestamps = append(timestamps, ts)
+		if latestName == "" || ts > latestTs {
+			latestTs = ts
+			latestName = file.Name()
+		}
 	}
 
-	if len(timestamps) == 0 {
+	if latestName == "" {
 		return "", os.ErrNotExist
 	}
 
-	// Sort timestamps in descending order
-	sort.Slice(timestamps, func(i, j int) bool {
-		return timestamps[i] > timestamps[j]
-	})
-
 	// Check if the latest file is expired
-	latestTime := time.Unix(0, timestamps[0])
+	latestTime := time.Unix(0, latestTs)
 	if fc.ExpirationTTL != 0 && time.Since(latestTime) > fc.ExpirationTTL {
 		return "", os.ErrNotExist
 	}
 
-	return filepath.Join(keyDir, fmt.Sprintf("%d", timestamps[0])), nil
+	return filepath.Join(keyDir, latestName), nil
 }
 
 func (fc *FileCache[T]) HasCached(key string) (bool, error) {
@@ -97,7 +105,7 @@ func (fc *FileCache[T]) GetFromCache(key string) (T, error) {
 		return zero, fmt.Errorf("error getting latest cache file: %w", err)
 	}
 
-	data, err := os.ReadFile(filePath)
+	data, err := readSnapshotFile(filePath)
 	if err != nil {
 		return zero, fmt.Errorf("error reading cache file: %w", err)
 	}
@@ -111,21 +119,95 @@ func (fc *FileCache[T]) GetFromCache(key string) (T, error) {
 }
 
 func (fc *FileCache[T]) AddToCache(key string, value T) error {
-	keyDir := fc.getKeyDir(key)
-	if err := os.MkdirAll(keyDir, 0755); err != nil {
-		return fmt.Errorf("error creating cache directory: %w", err)
-	}
-
 	data, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("error marshaling cache data: %w", err)
 	}
 
-	filePath := fc.getCacheFilePath(key, time.Now())
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	now := time.Now()
+	err = fc.WriteSnapshot(key, now, data, SnapshotMeta{
+		RunId:     core.Run.Id,
+		Command:   core.Run.Command,
+		CreatedAt: now,
+		StartedAt: core.Run.StartedAt,
+		Status:    core.ResultStatus(value),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(fc.getFailureFilePath(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing cache failure file: %w", err)
+	}
+
+	return nil
+}
+
+func (fc *FileCache[T]) getFailureFilePath(key string) string {
+	return filepath.Join(fc.getKeyDir(key), failureFileName)
+}
+
+func (fc *FileCache[T]) GetFailure(key string) (core.CacheFailure, bool, error) {
+	var failure core.CacheFailure
+
+	data, err := os.ReadFile(fc.getFailureFilePath(key))
+	if os.IsNotExist(err) {
+		return failure, false, nil
+	}
+	if err != nil {
+		return failure, false, fmt.Errorf("error reading cache failure file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &failure); err != nil {
+		return failure, false, fmt.Errorf("error unmarshaling cache failure: %w", err)
+	}
+
+	return failure, true, nil
+}
+
+// AddFailureToCache replaces the failure recorded for the key, snapshots are kept
+func (fc *FileCache[T]) AddFailureToCache(key string, failure core.CacheFailure) error {
+	if _, err := fc.ensureKeyDir(key); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return fmt.Errorf("error marshaling cache failure: %w", err)
+	}
+
+	if err := core.WriteFileAtomic(fc.getFailureFilePath(key), data, 0644); err != nil {
+		return fmt.Errorf("error writing cache failure file: %w", err)
+	}
+
+	return nil
+}
+
+// WriteSnapshot stores already marshaled data as the snapshot of key taken at ts
+func (fc *FileCache[T]) WriteSnapshot(key string, ts time.Time, data []byte, meta SnapshotMeta) error {
+	keyDir, err := fc.ensureKeyDir(key)
+	if err != nil {
+		return err
+	}
+
+	compressed, err := compress(fc.Compression, data)
+	if err != nil {
+		return fmt.Errorf("error compressing cache data: %w", err)
+	}
+
+	if err := core.WriteFileAtomic(fc.getCacheFilePath(keyDir, ts), compressed, 0644); err != nil {
 		return fmt.Errorf("error writing cache file: %w", err)
 	}
 
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("error marshaling cache meta: %w", err)
+	}
+
+	if err := core.WriteFileAtomic(metaFilePath(keyDir, ts), metaData, 0644); err != nil {
+		return fmt.Errorf("error writing cache meta file: %w", err)
+	}
+
 	return nil
 }
 
@@ -134,7 +216,11 @@ func (fc *FileCache[T]) CleanExpired() error {
 		return nil
 	}
 
-	return filepath.Walk(fc.Dir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(fc.Dir, func(path string, info os.FileInfo, err error) error {
+		// Meta files are removed together with their snapshot before the walk reaches them
+		if os.IsNotExist(err) {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -143,16 +229,22 @@ func (fc *FileCache[T]) CleanExpired() error {
 			return nil
 		}
 
-		ts, err := core.ParseInt64(info.Name())
-		if err != nil {
+		ts, ok := parseSnapshotName(info.Name())
+		if !ok {
 			return nil
 		}
 
 		cacheTime := time.Unix(0, ts)
 		if time.Since(cacheTime) > fc.ExpirationTTL {
 			_ = os.Remove(path)
+			_ = os.Remove(metaFilePath(filepath.Dir(path), cacheTime))
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	return fc.pruneEmptyKeys()
 }
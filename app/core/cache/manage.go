@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+// ServiceStats summarises the content of a service cache directory
+type ServiceStats struct {
+	Service   string `json:"service"`
+	Keys      int    `json:"keys"`
+	Snapshots int    `json:"snapshots"`
+	Failures  int    `json:"failures"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Services lists the service directories stored under root
+func Services(root string) ([]string, error) {
+	dirs, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache root: %w", err)
+	}
+
+	var services []string
+	for _, dir := range dirs {
+		if dir.IsDir() {
+			services = append(services, dir.Name())
+		}
+	}
+
+	return services, nil
+}
+
+func (fc *FileCache[T]) Stats(service string) (ServiceStats, error) {
+	stats := ServiceStats{Service: service}
+
+	keys, err := fc.Keys()
+	if err != nil {
+		return stats, err
+	}
+	stats.Keys = len(keys)
+
+	err = filepath.Walk(fc.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		stats.Bytes += info.Size()
+		if _, ok := parseSnapshotName(info.Name()); ok {
+			stats.Snapshots++
+		}
+		if info.Name() == failureFileName {
+			stats.Failures++
+		}
+
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return stats, fmt.Errorf("failed to walk cache: %w", err)
+	}
+
+	return stats, nil
+}
+
+// MatchKeys returns the keys matching the path.Match pattern
+func (fc *FileCache[T]) MatchKeys(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid key pattern: %w", err)
+	}
+
+	keys, err := fc.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []string
+	for _, key := range keys {
+		if ok, _ := path.Match(pattern, key); ok {
+			matched = append(matched, key)
+		}
+	}
+
+	return matched, nil
+}
+
+// RemoveKeys deletes every snapshot of the keys and drops them from the index
+func (fc *FileCache[T]) RemoveKeys(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	removed := map[string]bool{}
+	for _, key := range keys {
+		keyDir := fc.getKeyDir(key)
+		if err := os.RemoveAll(keyDir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", key, err)
+		}
+		removeEmptyDirs(fc.Dir, filepath.Dir(keyDir))
+		removed[key] = true
+	}
+
+	unlock, err := fc.lock(indexFileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := fc.readIndex()
+	if err != nil {
+		return err
+	}
+
+	var kept []indexEntry
+	for _, entry := range entries {
+		if !removed[entry.Key] {
+			kept = append(kept, entry)
+		}
+	}
+
+	return fc.writeIndex(kept)
+}
+
+// pruneEmptyKeys removes the keys which no longer have any snapshot
+func (fc *FileCache[T]) pruneEmptyKeys() error {
+	keys, err := fc.Keys()
+	if err != nil {
+		return err
+	}
+
+	var empty []string
+	for _, key := range keys {
+		records, err := fc.Records(key)
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			continue
+		}
+
+		// Keys that only failed so far are kept until their failure expires
+		failure, found, err := fc.GetFailure(key)
+		if err != nil {
+			return err
+		}
+		if found && time.Since(failure.FailedAt) <= fc.ExpirationTTL {
+			continue
+		}
+
+		empty = append(empty, key)
+	}
+
+	return fc.RemoveKeys(empty)
+}
+
+// writeIndex replaces the index file with the entries, the caller holds the index lock
+func (fc *FileCache[T]) writeIndex(entries []indexEntry) error {
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("error marshaling index entry: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	if err := core.WriteFileAtomic(filepath.Join(fc.Dir, indexFileName), data, 0644); err != nil {
+		return fmt.Errorf("error writing cache index: %w", err)
+	}
+
+	return nil
+}
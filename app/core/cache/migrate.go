@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type legacySnapshot struct {
+	Path string
+	Ts   time.Time
+}
+
+// findLegacySnapshots walks the cache looking for the layout used before
+// hashing, where the raw key was the directory and files were bare timestamps
+func findLegacySnapshots(dir string) (map[string][]legacySnapshot, error) {
+	snapshots := map[string][]legacySnapshot{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		stamp, err := strconv.ParseInt(d.Name(), 10, 64)
+		if err != nil {
+			return nil
+		}
+
+		key, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		key = filepath.ToSlash(key)
+		snapshots[key] = append(snapshots[key], legacySnapshot{Path: path, Ts: time.Unix(0, stamp)})
+		return nil
+	})
+
+	return snapshots, err
+}
+
+// MigrateLegacyLayout moves every snapshot of the legacy layout in dir into the
+// hashed layout and returns the number of migrated snapshots
+func MigrateLegacyLayout(dir string, keep bool) (int, error) {
+	legacy, err := findLegacySnapshots(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan legacy cache: %w", err)
+	}
+
+	fc := NewFileCache[json.RawMessage](dir, 0)
+
+	migrated := 0
+	for key, snapshots := range legacy {
+		for _, snapshot := range snapshots {
+			data, err := os.ReadFile(snapshot.Path)
+			if err != nil {
+				return migrated, fmt.Errorf("failed to read %s: %w", snapshot.Path, err)
+			}
+
+			metaPath := metaFilePath(filepath.Dir(snapshot.Path), snapshot.Ts)
+			meta := SnapshotMeta{CreatedAt: snapshot.Ts}
+			if metaData, err := os.ReadFile(metaPath); err == nil {
+				_ = json.Unmarshal(metaData, &meta)
+			}
+
+			if err := fc.WriteSnapshot(key, snapshot.Ts, data, meta); err != nil {
+				return migrated, fmt.Errorf("failed to migrate %s: %w", snapshot.Path, err)
+			}
+			migrated++
+
+			if keep {
+				continue
+			}
+
+			if err := os.Remove(snapshot.Path); err != nil {
+				return migrated, err
+			}
+			_ = os.Remove(metaPath)
+		}
+
+		if !keep {
+			removeEmptyDirs(dir, filepath.Join(dir, filepath.FromSlash(key)))
+		}
+	}
+
+	return migrated, nil
+}
+
+// removeEmptyDirs removes path and its parents up to root while they are empty
+func removeEmptyDirs(root string, path string) {
+	for path != root && path != "." {
+		if err := os.Remove(path); err != nil {
+			return
+		}
+		path = filepath.Dir(path)
+	}
+}
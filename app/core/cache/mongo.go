@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoCacheOpts struct {
+	Collection    *mongo.Collection
+	ExpirationTTL time.Duration
+	// KeyField is the document field holding the key, defaults to "key"
+	KeyField string
+}
+
+// MongoCache keeps the latest value of every key in a collection,
+// expired documents are removed by a TTL index on timestamp
+type MongoCache[T any] struct {
+	Collection    *mongo.Collection
+	ExpirationTTL time.Duration
+	KeyField      string
+	Ctx           context.Context
+}
+
+func NewMongoCache[T any](ctx context.Context, opts MongoCacheOpts) (*MongoCache[T], error) {
+	if opts.KeyField == "" {
+		opts.KeyField = "key"
+	}
+
+	mc := &MongoCache[T]{
+		Collection:    opts.Collection,
+		ExpirationTTL: opts.ExpirationTTL,
+		KeyField:      opts.KeyField,
+		Ctx:           ctx,
+	}
+
+	if err := mc.ensureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return mc, nil
+}
+
+func (mc *MongoCache[T]) ensureIndexes(ctx context.Context) error {
+	cursor, err := mc.Collection.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var existingIndexes []bson.M
+	if err = cursor.All(ctx, &existingIndexes); err != nil {
+		return fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	// Create map of existing index names
+	existingIndexNames := make(map[string]bool)
+	for _, idx := range existingIndexes {
+		if name, ok := idx["name"].(string); ok {
+			existingIndexNames[name] = true
+		}
+	}
+
+	// Create only missing indexes
+	if !existingIndexNames[mc.KeyField+"_1"] {
+		core.Logger.Infof("Creating %s index", mc.KeyField)
+		_, err = mc.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: mc.KeyField, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create %s index: %w", mc.KeyField, err)
+		}
+	}
+
+	if !existingIndexNames["timestamp_1"] && mc.ExpirationTTL != 0 {
+		core.Logger.Info("Creating timestamp index")
+		_, err = mc.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(mc.ExpirationTTL.Seconds())),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create timestamp index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (mc *MongoCache[T]) filter(key string) bson.M {
+	filter := bson.M{mc.KeyField: key, "data": bson.M{"$exists": true}}
+	if mc.ExpirationTTL != 0 {
+		// The TTL monitor runs once a minute, so expired documents may still exist
+		filter["timestamp"] = bson.M{"$gt": time.Now().Add(-mc.ExpirationTTL)}
+	}
+	return filter
+}
+
+func (mc *MongoCache[T]) HasCached(key string) (bool, error) {
+	count, err := mc.Collection.CountDocuments(mc.Ctx, mc.filter(key), options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error checking cache: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (mc *MongoCache[T]) GetFromCache(key string) (T, error) {
+	var value T
+
+	raw, err := mc.Collection.FindOne(mc.Ctx, mc.filter(key)).Raw()
+	if err != nil {
+		return value, fmt.Errorf("error getting cache entry: %w", err)
+	}
+
+	if err := raw.Lookup("data").Unmarshal(&value); err != nil {
+		return value, fmt.Errorf("error unmarshaling cache data: %w", err)
+	}
+
+	return value, nil
+}
+
+func (mc *MongoCache[T]) AddToCache(key string, value T) error {
+	_, err := mc.Collection.UpdateOne(mc.Ctx,
+		bson.M{mc.KeyField: key},
+		bson.M{
+			"$set": bson.M{
+				mc.KeyField:  key,
+				"data":       value,
+				"status":     core.ResultStatus(value),
+				"is_valid":   true,
+				"run_id":     core.Run.Id,
+				"command":    core.Run.Command,
+				"started_at": core.Run.StartedAt,
+				"timestamp":  time.Now(),
+			},
+			"$unset": bson.M{"failure": ""},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// mongoFailure is stored in the failure field next to the last good data
+type mongoFailure struct {
+	HTTPStatus int       `bson:"http_status,omitempty"`
+	ErrorClass string    `bson:"error_class"`
+	Error      string    `bson:"error"`
+	Attempts   int       `bson:"attempts"`
+	FailedAt   time.Time `bson:"failed_at"`
+}
+
+func (mc *MongoCache[T]) GetFailure(key string) (core.CacheFailure, bool, error) {
+	var failure core.CacheFailure
+
+	var doc struct {
+		Failure *mongoFailure `bson:"failure"`
+	}
+	err := mc.Collection.FindOne(mc.Ctx, bson.M{mc.KeyField: key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return failure, false, nil
+	}
+	if err != nil {
+		return failure, false, fmt.Errorf("error checking cache failure: %w", err)
+	}
+
+	if doc.Failure == nil {
+		return failure, false, nil
+	}
+
+	return core.CacheFailure(*doc.Failure), true, nil
+}
+
+func (mc *MongoCache[T]) AddFailureToCache(key string, failure core.CacheFailure) error {
+	_, err := mc.Collection.UpdateOne(mc.Ctx,
+		bson.M{mc.KeyField: key},
+		bson.M{
+			"$set": bson.M{
+				mc.KeyField: key,
+				"failure":   mongoFailure(failure),
+			},
+			// Documents holding only a failure are expired by the TTL index as well
+			"$setOnInsert": bson.M{"timestamp": failure.FailedAt},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error writing cache failure: %w", err)
+	}
+
+	return nil
+}
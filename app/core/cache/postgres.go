@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+// PostgresCache stores every snapshot of a service in the cache_entries table
+type PostgresCache[T any] struct {
+	Service       string
+	ExpirationTTL time.Duration
+	Ctx           context.Context
+}
+
+func NewPostgresCache[T any](ctx context.Context, service string, expirationTTL time.Duration) *PostgresCache[T] {
+	return &PostgresCache[T]{
+		Service:       service,
+		ExpirationTTL: expirationTTL,
+		Ctx:           ctx,
+	}
+}
+
+// checkPostgresCacheTable fails when the migrations creating cache_entries
+// were not applied, commands that only use the cache never migrate
+func checkPostgresCacheTable(ctx context.Context) error {
+	var exists bool
+	err := postgres.Pool.QueryRow(ctx, "select to_regclass('cache_entries') is not null").Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking cache_entries table: %w", err)
+	}
+	if !exists {
+		return errors.New("cache_entries table is missing, apply the migrations with bin/migrate up")
+	}
+	return nil
+}
+
+// after returns the oldest creation time that is not expired
+func (pc *PostgresCache[T]) after() time.Time {
+	if pc.ExpirationTTL == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-pc.ExpirationTTL)
+}
+
+func (pc *PostgresCache[T]) HasCached(key string) (bool, error) {
+	var exists bool
+	err := postgres.Pool.QueryRow(pc.Ctx, `
+		select exists (
+			select 1 from cache_entries
+			where service = $1 and key = $2 and created_at > $3 and status <> 'error'
+		)
+	`, pc.Service, key, pc.after()).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking cache: %w", err)
+	}
+	return exists, nil
+}
+
+func (pc *PostgresCache[T]) GetFromCache(key string) (T, error) {
+	var value T
+	var data []byte
+
+	err := postgres.Pool.QueryRow(pc.Ctx, `
+		select data from cache_entries
+		where service = $1 and key = $2 and created_at > $3 and status <> 'error'
+		order by created_at desc
+		limit 1
+	`, pc.Service, key, pc.after()).Scan(&data)
+	if err != nil {
+		return value, fmt.Errorf("error getting cache entry: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("error unmarshaling cache data: %w", err)
+	}
+
+	return value, nil
+}
+
+func (pc *PostgresCache[T]) AddToCache(key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error marshaling cache data: %w", err)
+	}
+
+	_, err = postgres.Pool.Exec(pc.Ctx, `
+		insert into cache_entries (service, key, data, run_id, status)
+		values ($1, $2, $3::jsonb, $4, $5)
+	`, pc.Service, key, string(data), core.Run.Id, core.ResultStatus(value))
+	if err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetFailure returns the latest entry of the key when it is a failure
+func (pc *PostgresCache[T]) GetFailure(key string) (core.CacheFailure, bool, error) {
+	var failure core.CacheFailure
+	var status string
+	var httpStatus *int
+	var errorClass, errorMsg *string
+
+	err := postgres.Pool.QueryRow(pc.Ctx, `
+		select status, http_status, error_class, error, attempts, created_at
+		from cache_entries
+		where service = $1 and key = $2
+		order by created_at desc
+		limit 1
+	`, pc.Service, key).Scan(&status, &httpStatus, &errorClass, &errorMsg, &failure.Attempts, &failure.FailedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure, false, nil
+	}
+	if err != nil {
+		return failure, false, fmt.Errorf("error checking cache failure: %w", err)
+	}
+
+	if status != core.CacheStatusError {
+		return failure, false, nil
+	}
+
+	if httpStatus != nil {
+		failure.HTTPStatus = *httpStatus
+	}
+	if errorClass != nil {
+		failure.ErrorClass = *errorClass
+	}
+	if errorMsg != nil {
+		failure.Error = *errorMsg
+	}
+
+	return failure, true, nil
+}
+
+func (pc *PostgresCache[T]) AddFailureToCache(key string, failure core.CacheFailure) error {
+	var httpStatus *int
+	if failure.HTTPStatus != 0 {
+		httpStatus = &failure.HTTPStatus
+	}
+
+	_, err := postgres.Pool.Exec(pc.Ctx, `
+		insert into cache_entries (service, key, run_id, status, http_status, error_class, error, attempts, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, pc.Service, key, core.Run.Id, core.CacheStatusError, httpStatus, failure.ErrorClass, failure.Error, failure.Attempts, failure.FailedAt)
+	if err != nil {
+		return fmt.Errorf("error writing cache failure: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/postgres"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	BackendFile     = "file"
+	BackendPostgres = "postgres"
+	BackendMongo    = "mongo"
+)
+
+var cacheBackendFlag = flag.String("cache-backend", "", "Cache backend (file, postgres, mongo), overrides CACHE_BACKEND")
+var cacheLRUSizeFlag = flag.Int("cache-lru", -1, "Number of entries kept in memory in front of the cache backend, overrides CACHE_LRU_SIZE")
+
+func CACHE_BACKEND() string {
+	if *cacheBackendFlag != "" {
+		return *cacheBackendFlag
+	}
+	return core.Env.GetDefault("CACHE_BACKEND", BackendFile)
+}
+
+func CACHE_LRU_SIZE() int {
+	if *cacheLRUSizeFlag >= 0 {
+		return *cacheLRUSizeFlag
+	}
+	return core.Fatal1Err(strconv.Atoi(core.Env.GetDefault("CACHE_LRU_SIZE", "0")))
+}
+
+func MONGO_URI() string {
+	return core.Env.GetDefault("MONGO_URI", "mongodb://localhost:27017")
+}
+
+func MONGO_DB() string {
+	return core.Env.GetDefault("MONGO_DB", "microb")
+}
+
+var (
+	mongoOnce   sync.Once
+	mongoClient *mongo.Client
+)
+
+func MongoClient(ctx context.Context) *mongo.Client {
+	mongoOnce.Do(func() {
+		mongoClient = core.Fatal1Err(mongo.Connect(ctx, options.Client().ApplyURI(MONGO_URI())))
+	})
+	return mongoClient
+}
+
+// NewProvider returns the cache configured for the command, every analyst
+// pointing at the same postgres or mongo database shares the cache
+func NewProvider[T any](ctx context.Context, service string, ttl time.Duration) core.CacheProvider[T] {
+	var provider core.CacheProvider[T]
+
+	switch backend := CACHE_BACKEND(); backend {
+	case BackendFile:
+		provider = NewDefaultFileCache[T](service, ttl)
+	case BackendPostgres:
+		if postgres.Pool == nil {
+			core.Logger.Fatal("Postgres cache backend requires a configured postgres connection")
+		}
+		core.FatalErr(checkPostgresCacheTable(ctx))
+		provider = NewPostgresCache[T](ctx, service, ttl)
+	case BackendMongo:
+		collection := MongoClient(ctx).Database(MONGO_DB()).Collection(service)
+		provider = core.Fatal1Err(NewMongoCache[T](ctx, MongoCacheOpts{
+			Collection:    collection,
+			ExpirationTTL: ttl,
+		}))
+	default:
+		core.Logger.Fatalf("Unknown cache backend: %s", backend)
+	}
+
+	if size := CACHE_LRU_SIZE(); size > 0 {
+		provider = NewTieredCache[T](provider, size, ttl)
+	}
+
+	return provider
+}
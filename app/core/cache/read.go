@@ -4,7 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
 	"time"
 )
 
@@ -19,10 +20,19 @@ type FileCacheRecord[T any] struct {
 	FilePath string
 }
 
+// ReadRaw returns the decompressed JSON payload of the snapshot
+func (fcr FileCacheRecord[T]) ReadRaw() ([]byte, error) {
+	data, err := readSnapshotFile(fcr.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
 func (fcr FileCacheRecord[T]) Read() (res T, err error) {
-	data, err := os.ReadFile(fcr.FilePath)
+	data, err := fcr.ReadRaw()
 	if err != nil {
-		return res, fmt.Errorf("failed to read file: %w", err)
+		return res, err
 	}
 
 	var resp T
@@ -34,38 +44,41 @@ func (fcr FileCacheRecord[T]) Read() (res T, err error) {
 	return resp, nil
 }
 
-func ReadAllFileCacheFiles[T any](opts ReadAllFileCacheFilesOpts[T]) error {
-	dirs, err := os.ReadDir(opts.Dir)
+// ReadMeta returns the provenance of the snapshot, snapshots written before
+// metadata was recorded return an empty SnapshotMeta.
+func (fcr FileCacheRecord[T]) ReadMeta() (SnapshotMeta, error) {
+	var meta SnapshotMeta
+
+	data, err := os.ReadFile(metaFilePath(filepath.Dir(fcr.FilePath), fcr.Ts))
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return meta, fmt.Errorf("failed to read meta file: %w", err)
 	}
 
-	for _, keyFile := range dirs {
-		if !keyFile.IsDir() {
-			continue
-		}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to unmarshal meta: %w", err)
+	}
 
-		files, err := os.ReadDir(fmt.Sprintf("%s/%s", opts.Dir, keyFile.Name()))
-		if err != nil {
-			return fmt.Errorf("failed to read directory: %w", err)
-		}
+	return meta, nil
+}
 
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
+func ReadAllFileCacheFiles[T any](opts ReadAllFileCacheFilesOpts[T]) error {
+	fc := NewFileCache[T](opts.Dir, 0)
 
-			stamp, err := strconv.ParseInt(file.Name(), 10, 64)
-			if err != nil {
-				return fmt.Errorf("failed to parse timestamp: %w", err)
-			}
+	keys, err := fc.Keys()
+	if err != nil {
+		return err
+	}
 
-			fcr := FileCacheRecord[T]{
-				Key:      keyFile.Name(),
-				Ts:       time.Unix(stamp, 0),
-				FilePath: fmt.Sprintf("%s/%s/%s", opts.Dir, keyFile.Name(), file.Name()),
-			}
+	for _, key := range keys {
+		records, err := fc.Records(key)
+		if err != nil {
+			return err
+		}
 
+		for _, fcr := range records {
 			if err := opts.Process(fcr); err != nil {
 				return fmt.Errorf("failed to process file: %w", err)
 			}
@@ -74,3 +87,55 @@ func ReadAllFileCacheFiles[T any](opts ReadAllFileCacheFilesOpts[T]) error {
 
 	return nil
 }
+
+// Keys lists every key registered in the cache index
+func (fc *FileCache[T]) Keys() ([]string, error) {
+	entries, err := fc.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+
+	return keys, nil
+}
+
+// Records lists every snapshot stored for the key, newest first
+func (fc *FileCache[T]) Records(key string) ([]FileCacheRecord[T], error) {
+	keyDir := fc.getKeyDir(key)
+
+	files, err := os.ReadDir(keyDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var records []FileCacheRecord[T]
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		stamp, ok := parseSnapshotName(file.Name())
+		if !ok {
+			continue
+		}
+
+		records = append(records, FileCacheRecord[T]{
+			Key:      key,
+			Ts:       time.Unix(0, stamp),
+			FilePath: filepath.Join(keyDir, file.Name()),
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Ts.After(records[j].Ts)
+	})
+
+	return records, nil
+}
@@ -0,0 +1,37 @@
+package canonical
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	SegmentInt  = "{int}"
+	SegmentUUID = "{uuid}"
+	SegmentHash = "{hash}"
+)
+
+var (
+	intSegment  = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// hashSegment matches hex digests like md5, sha1 and sha256 and object ids
+	hashSegment = regexp.MustCompile(`^[0-9a-fA-F]{24,128}$`)
+)
+
+// PathTemplate collapses the numeric, UUID and hash segments of a path into
+// placeholders, so that /users/42/avatar and /users/7/avatar share the
+// template /users/{int}/avatar
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case intSegment.MatchString(segment):
+			segments[i] = SegmentInt
+		case uuidSegment.MatchString(segment):
+			segments[i] = SegmentUUID
+		case hashSegment.MatchString(segment):
+			segments[i] = SegmentHash
+		}
+	}
+	return strings.Join(segments, "/")
+}
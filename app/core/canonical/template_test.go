@@ -0,0 +1,26 @@
+package canonical
+
+import "testing"
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/users/42/avatar", "/users/{int}/avatar"},
+		{"/users/7/avatar", "/users/{int}/avatar"},
+		{"/orders/123e4567-e89b-12d3-a456-426614174000", "/orders/{uuid}"},
+		{"/files/d41d8cd98f00b204e9800998ecf8427e", "/files/{hash}"},
+		{"/objects/507f1f77bcf86cd799439011/", "/objects/{hash}/"},
+		{"/v2/items", "/v2/items"},
+		{"/deadbeef", "/deadbeef"},
+		{"/a/1/b/2", "/a/{int}/b/{int}"},
+	}
+
+	for _, tt := range tests {
+		if got := PathTemplate(tt.path); got != tt.want {
+			t.Errorf("PathTemplate(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/domain"
+)
+
+var (
+	ErrNotAbsolute = errors.New("URL has no scheme or host")
+)
+
+// DefaultTrackingParams are stripped from queries unless URL_STRIP_PARAMS
+// overrides them. A trailing "*" matches every parameter with the prefix.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+	"igshid",
+	"ref_src",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+type Options struct {
+	// StripParams are removed from the query, matched case-insensitively
+	// on the decoded name
+	StripParams []string
+	// KeepFragment keeps the fragment, it is dropped by default because it
+	// never reaches the server
+	KeepFragment bool
+}
+
+// DefaultOptions reads URL_STRIP_PARAMS (comma separated, "none" keeps every
+// parameter) and URL_KEEP_FRAGMENT from the environment
+func DefaultOptions() Options {
+	opts := Options{
+		StripParams:  DefaultTrackingParams,
+		KeepFragment: core.Env.GetDefault("URL_KEEP_FRAGMENT", "false") == "true",
+	}
+
+	if params := core.Env.GetDefault("URL_STRIP_PARAMS", ""); params != "" {
+		opts.StripParams = nil
+		if params != "none" {
+			for _, param := range strings.Split(params, ",") {
+				if param = strings.TrimSpace(param); param != "" {
+					opts.StripParams = append(opts.StripParams, param)
+				}
+			}
+		}
+	}
+
+	return opts
+}
+
+// URL is the canonical form of an absolute URL. Components keep their
+// percent-encoding, Port is empty when it is the default of the scheme.
+type URL struct {
+	Scheme   string
+	User     string
+	Host     string
+	Port     string
+	Path     string
+	Query    string
+	Fragment string
+}
+
+func (u URL) String() string {
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != "" {
+		b.WriteString(u.User)
+		b.WriteByte('@')
+	}
+	if strings.Contains(u.Host, ":") {
+		b.WriteString("[" + u.Host + "]")
+	} else {
+		b.WriteString(u.Host)
+	}
+	if u.Port != "" {
+		b.WriteByte(':')
+		b.WriteString(u.Port)
+	}
+	b.WriteString(u.Path)
+	if u.Query != "" {
+		b.WriteByte('?')
+		b.WriteString(u.Query)
+	}
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(u.Fragment)
+	}
+	return b.String()
+}
+
+// Parse canonicalizes an absolute URL: scheme and host are lowercased, the
+// host is converted to punycode, default ports, dot-segments and stripped
+// parameters are removed, percent-encoding is normalized and the query is
+// sorted by parameter name.
+func Parse(raw string, opts Options) (URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return URL{}, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return URL{}, fmt.Errorf("%w: %s", ErrNotAbsolute, raw)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return URL{}, fmt.Errorf("invalid host of %s: %w", raw, err)
+	}
+
+	c := URL{
+		Scheme: strings.ToLower(u.Scheme),
+		Host:   host,
+		Port:   u.Port(),
+		Path:   Path(u.EscapedPath()),
+		Query:  Query(u.RawQuery, opts.StripParams),
+	}
+
+	if c.Port == defaultPorts[c.Scheme] {
+		c.Port = ""
+	}
+
+	if u.User != nil {
+		c.User = u.User.String()
+	}
+
+	if opts.KeepFragment {
+		c.Fragment = normalizeEscapes(u.EscapedFragment(), isFragmentChar)
+	}
+
+	return c, nil
+}
+
+// String returns the canonical form of raw with the default options
+func String(raw string) (string, error) {
+	u, err := Parse(raw, DefaultOptions())
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func normalizeHost(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	return domain.Normalize(host)
+}
+
+// Path normalizes the escaping of an escaped path and removes its
+// dot-segments, an empty path becomes "/"
+func Path(escaped string) string {
+	p := normalizeEscapes(escaped, isPathChar)
+	if p == "" {
+		return "/"
+	}
+
+	trailingSlash := strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")
+	p = path.Clean("/" + p)
+	if trailingSlash && p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// Query normalizes the escaping of a raw query, drops empty and stripped
+// parameters and sorts the rest by name keeping the order of repeated names
+func Query(rawQuery string, stripParams []string) string {
+	type param struct{ name, raw string }
+
+	var params []param
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(part, "=")
+		name = normalizeEscapes(name, isQueryChar)
+		decoded, err := url.QueryUnescape(name)
+		if err != nil {
+			decoded = name
+		}
+		if isStripped(decoded, stripParams) {
+			continue
+		}
+
+		raw := name
+		if hasValue {
+			raw += "=" + normalizeEscapes(value, isQueryChar)
+		}
+		params = append(params, param{name: decoded, raw: raw})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].name < params[j].name
+	})
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+func isStripped(name string, stripParams []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range stripParams {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+const upperHex = "0123456789ABCDEF"
+
+// normalizeEscapes decodes escaped unreserved characters, uppercases the
+// remaining escapes and escapes bytes that are not allowed in the component
+func normalizeEscapes(s string, allowed func(byte) bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(upperHex[decoded>>4])
+				b.WriteByte(upperHex[decoded&15])
+			}
+			i += 2
+			continue
+		}
+
+		if allowed(c) {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(upperHex[c>>4])
+		b.WriteByte(upperHex[c&15])
+	}
+
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isSubDelim(c byte) bool {
+	return strings.IndexByte("!$&'()*+,;=", c) >= 0
+}
+
+func isPathChar(c byte) bool {
+	return isUnreserved(c) || isSubDelim(c) || c == ':' || c == '@' || c == '/'
+}
+
+// isQueryChar excludes "&" and "=" since names and values are normalized
+// separately and must keep them escaped
+func isQueryChar(c byte) bool {
+	return (isPathChar(c) || c == '?') && c != '&' && c != '='
+}
+
+func isFragmentChar(c byte) bool {
+	return isPathChar(c) || c == '?'
+}
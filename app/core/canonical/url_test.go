@@ -0,0 +1,53 @@
+package canonical
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		opts Options
+		want string
+	}{
+		{"lowercases scheme and host", "HTTP://Example.COM/Path", Options{}, "http://example.com/Path"},
+		{"drops default port", "https://example.com:443/", Options{}, "https://example.com/"},
+		{"keeps other ports", "https://example.com:8443/", Options{}, "https://example.com:8443/"},
+		{"empty path", "https://example.com", Options{}, "https://example.com/"},
+		{"removes dot segments", "https://example.com/a/./b/../c", Options{}, "https://example.com/a/c"},
+		{"keeps trailing slash", "https://example.com/a/b/", Options{}, "https://example.com/a/b/"},
+		{"decodes unreserved escapes", "https://example.com/%7Euser/%41", Options{}, "https://example.com/~user/A"},
+		{"uppercases escapes", "https://example.com/a%2fb", Options{}, "https://example.com/a%2Fb"},
+		{"escapes spaces", "https://example.com/a b", Options{}, "https://example.com/a%20b"},
+		{"sorts the query", "https://example.com/?b=2&a=1&b=1", Options{}, "https://example.com/?a=1&b=2&b=1"},
+		{"drops empty parameters", "https://example.com/?a=1&&b=2&", Options{}, "https://example.com/?a=1&b=2"},
+		{"strips tracking parameters", "https://example.com/?utm_source=x&id=1&FBCLID=y", Options{StripParams: DefaultTrackingParams}, "https://example.com/?id=1"},
+		{"drops the fragment", "https://example.com/#top", Options{}, "https://example.com/"},
+		{"keeps the fragment", "https://example.com/#top", Options{KeepFragment: true}, "https://example.com/#top"},
+		{"converts the host to punycode", "https://bücher.example/", Options{}, "https://xn--bcher-kva.example/"},
+		{"brackets ipv6 hosts", "http://[::1]:8080/", Options{}, "http://[::1]:8080/"},
+		{"keeps user info", "ftp://user@example.com:21/file", Options{}, "ftp://user@example.com/file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := Parse(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.raw, err)
+			}
+			if got := u.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNotAbsolute(t *testing.T) {
+	for _, raw := range []string{"/relative/path", "example.com/path", "https:///path"} {
+		if _, err := Parse(raw, Options{}); !errors.Is(err, ErrNotAbsolute) {
+			t.Errorf("Parse(%q) error = %v, want ErrNotAbsolute", raw, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
 
@@ -26,6 +27,19 @@ func NewWindow() *Controller {
 	}
 }
 
+var headlessOptions = append(chromedp.DefaultExecAllocatorOptions[:],
+	chromedp.WindowSize(1366, 768),
+)
+
+// NewHeadless starts chrome without a window for batch crawling
+func NewHeadless() *Controller {
+	ctx, cancel := chromedp.NewExecAllocator(context.Background(), headlessOptions...)
+	return &Controller{
+		chromeCtx:    ctx,
+		chromeCancel: cancel,
+	}
+}
+
 func (c *Controller) Close() {
 	c.chromeCancel()
 }
@@ -68,6 +82,28 @@ func (c *Context) NewContextWithTimeout(timeout time.Duration) *Context {
 	}
 }
 
+// WithTimeout bounds the actions run in the same tab, cancelling it leaves
+// the tab open
+func (c *Context) WithTimeout(timeout time.Duration) *Context {
+	ctx, cancel := context.WithTimeout(c.chromeCtx, timeout)
+	return &Context{
+		chromeCtx:    ctx,
+		chromeCancel: cancel,
+	}
+}
+
 func (c *Context) Run(actions ...chromedp.Action) error {
 	return chromedp.Run(c.chromeCtx, actions...)
 }
+
+// RunResponse runs the actions and returns the response of the document they
+// navigated to, after redirects
+func (c *Context) RunResponse(actions ...chromedp.Action) (*network.Response, error) {
+	return chromedp.RunResponse(c.chromeCtx, actions...)
+}
+
+// Listen calls fn for every event of the tab until the context is closed,
+// fn must not block
+func (c *Context) Listen(fn func(ev interface{})) {
+	chromedp.ListenTarget(c.chromeCtx, fn)
+}
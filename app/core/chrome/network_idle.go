@@ -0,0 +1,80 @@
+package chrome
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// NetworkIdle tracks the requests of a tab, start it before navigating
+type NetworkIdle struct {
+	mu           sync.Mutex
+	inflight     map[network.RequestID]struct{}
+	lastActivity time.Time
+}
+
+// WatchNetwork counts the requests the tab starts and finishes from now on
+func WatchNetwork(tab *Context) *NetworkIdle {
+	idle := &NetworkIdle{
+		inflight:     map[network.RequestID]struct{}{},
+		lastActivity: time.Now(),
+	}
+
+	tab.Listen(func(ev interface{}) {
+		idle.mu.Lock()
+		defer idle.mu.Unlock()
+
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			// Redirects reuse the request id of the request they end
+			idle.inflight[ev.RequestID] = struct{}{}
+		case *network.EventLoadingFinished:
+			delete(idle.inflight, ev.RequestID)
+		case *network.EventLoadingFailed:
+			delete(idle.inflight, ev.RequestID)
+		default:
+			return
+		}
+		idle.lastActivity = time.Now()
+	})
+
+	return idle
+}
+
+// Wait returns an action that waits until no request was in flight for
+// quiet. Pages that keep polling never go idle, after max it stops waiting
+// without failing
+func (n *NetworkIdle) Wait(quiet, max time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+
+		deadline := time.After(max)
+		for {
+			if n.idleFor() >= quiet {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-deadline:
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func (n *NetworkIdle) idleFor() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.inflight) > 0 {
+		return 0
+	}
+	return time.Since(n.lastActivity)
+}
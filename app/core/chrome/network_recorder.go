@@ -0,0 +1,205 @@
+package chrome
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// NetworkEntry is one request of a tab and its response. A redirect ends
+// the entry and the request continues in a new one
+type NetworkEntry struct {
+	RequestId       string
+	Url             string
+	Method          string
+	ResourceType    string
+	RequestHeaders  map[string]string
+	PostData        []byte
+	Status          int
+	StatusText      string
+	Protocol        string
+	ResponseHeaders map[string]string
+	MimeType        string
+	RemoteIp        string
+	RedirectUrl     string
+	EncodedSize     int64
+	Body            []byte
+	ErrorText       string
+	StartedAt       time.Time
+	Duration        time.Duration
+
+	start    time.Time
+	finished bool
+}
+
+// NetworkRecorder records the requests of a tab, start it before navigating
+type NetworkRecorder struct {
+	mu      sync.Mutex
+	entries []*NetworkEntry
+	current map[network.RequestID]*NetworkEntry
+}
+
+// RecordNetwork records every request the tab sends from now on, data URLs
+// are left out
+func RecordNetwork(tab *Context) *NetworkRecorder {
+	recorder := &NetworkRecorder{
+		current: map[network.RequestID]*NetworkEntry{},
+	}
+	tab.Listen(recorder.handle)
+	return recorder
+}
+
+func (r *NetworkRecorder) handle(ev interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		if previous := r.current[ev.RequestID]; previous != nil && ev.RedirectResponse != nil {
+			previous.setResponse(ev.RedirectResponse)
+			previous.RedirectUrl = ev.Request.URL
+			previous.finish(ev.Timestamp)
+		}
+
+		if strings.HasPrefix(ev.Request.URL, "data:") {
+			delete(r.current, ev.RequestID)
+			return
+		}
+
+		entry := &NetworkEntry{
+			RequestId:      string(ev.RequestID),
+			Url:            ev.Request.URL,
+			Method:         ev.Request.Method,
+			ResourceType:   string(ev.Type),
+			RequestHeaders: headers(ev.Request.Headers),
+			PostData:       postData(ev.Request.PostDataEntries),
+			StartedAt:      time.Now(),
+		}
+		if ev.WallTime != nil {
+			entry.StartedAt = ev.WallTime.Time()
+		}
+		if ev.Timestamp != nil {
+			entry.start = ev.Timestamp.Time()
+		}
+
+		r.entries = append(r.entries, entry)
+		r.current[ev.RequestID] = entry
+
+	case *network.EventResponseReceived:
+		if entry := r.current[ev.RequestID]; entry != nil {
+			entry.setResponse(ev.Response)
+		}
+
+	case *network.EventLoadingFinished:
+		if entry := r.current[ev.RequestID]; entry != nil {
+			entry.EncodedSize = int64(ev.EncodedDataLength)
+			entry.finish(ev.Timestamp)
+		}
+
+	case *network.EventLoadingFailed:
+		if entry := r.current[ev.RequestID]; entry != nil {
+			entry.ErrorText = ev.ErrorText
+			entry.finish(ev.Timestamp)
+		}
+	}
+}
+
+func (e *NetworkEntry) setResponse(response *network.Response) {
+	e.Status = int(response.Status)
+	e.StatusText = response.StatusText
+	e.Protocol = response.Protocol
+	e.ResponseHeaders = headers(response.Headers)
+	e.MimeType = response.MimeType
+	e.RemoteIp = response.RemoteIPAddress
+	e.EncodedSize = int64(response.EncodedDataLength)
+}
+
+func (e *NetworkEntry) finish(timestamp *cdp.MonotonicTime) {
+	e.finished = true
+	if timestamp != nil && !e.start.IsZero() {
+		e.Duration = timestamp.Time().Sub(e.start)
+	}
+}
+
+func headers(h network.Headers) map[string]string {
+	result := make(map[string]string, len(h))
+	for name, value := range h {
+		result[name] = fmt.Sprint(value)
+	}
+	return result
+}
+
+// postData joins the request body parts, they may be binary
+func postData(entries []*network.PostDataEntry) []byte {
+	var body []byte
+	for _, entry := range entries {
+		data, err := base64.StdEncoding.DecodeString(entry.Bytes)
+		if err != nil {
+			continue
+		}
+		body = append(body, data...)
+	}
+	return body
+}
+
+// Images, fonts and media are large and rarely worth keeping
+var skipBodyTypes = map[string]bool{
+	string(network.ResourceTypeImage): true,
+	string(network.ResourceTypeFont):  true,
+	string(network.ResourceTypeMedia): true,
+}
+
+// FetchBodies returns an action that reads the bodies of the finished
+// responses up to maxSize bytes. Run it in the same tab before it navigates
+// away, chrome drops the bodies of the previous page. Bodies chrome no
+// longer has are skipped
+func (r *NetworkRecorder) FetchBodies(maxSize int64) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		r.mu.Lock()
+		var pending []*NetworkEntry
+		for _, entry := range r.current {
+			if entry.finished && entry.ErrorText == "" && entry.RedirectUrl == "" &&
+				entry.EncodedSize <= maxSize && !skipBodyTypes[entry.ResourceType] {
+				pending = append(pending, entry)
+			}
+		}
+		r.mu.Unlock()
+
+		for _, entry := range pending {
+			body, err := network.GetResponseBody(network.RequestID(entry.RequestId)).Do(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				continue
+			}
+			if int64(len(body)) > maxSize {
+				continue
+			}
+
+			r.mu.Lock()
+			entry.Body = body
+			r.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// Entries returns the recorded requests in the order they were sent
+func (r *NetworkRecorder) Entries() []NetworkEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]NetworkEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
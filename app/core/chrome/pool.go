@@ -0,0 +1,86 @@
+package chrome
+
+import (
+	"fmt"
+	"time"
+)
+
+// TabPool keeps a fixed number of tabs of one browser open and lends them
+// out one page at a time
+type TabPool struct {
+	browser *Context
+	tabs    chan *Context
+}
+
+// NewTabPool starts the browser of the controller and opens size tabs in it
+func NewTabPool(controller *Controller, size int) (*TabPool, error) {
+	browser := controller.NewContext()
+
+	// Tabs created before the browser runs would each start their own browser
+	if err := browser.Run(); err != nil {
+		browser.Close()
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+
+	pool := &TabPool{
+		browser: browser,
+		tabs:    make(chan *Context, size),
+	}
+
+	for i := 0; i < size; i++ {
+		tab, err := pool.openTab()
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.tabs <- tab
+	}
+
+	return pool, nil
+}
+
+func (p *TabPool) openTab() (*Context, error) {
+	tab := p.browser.NewContext()
+	if err := tab.Run(); err != nil {
+		tab.Close()
+		return nil, fmt.Errorf("failed to open tab: %w", err)
+	}
+	return tab, nil
+}
+
+// Do runs fn in a free tab, waiting for one when all are busy. The context
+// passed to fn is closed after timeout. A tab whose page failed is replaced,
+// a broken renderer must not fail the pages after it
+func (p *TabPool) Do(timeout time.Duration, fn func(tab *Context) error) error {
+	tab := <-p.tabs
+
+	pageCtx := tab.WithTimeout(timeout)
+	err := fn(pageCtx)
+	pageCtx.Close()
+
+	if err == nil {
+		p.tabs <- tab
+		return nil
+	}
+
+	tab.Close()
+	fresh, openErr := p.openTab()
+	if openErr != nil {
+		// Keep the pool size, the next page fails fast if the tab is dead
+		p.tabs <- tab
+		return fmt.Errorf("%w, and %w", err, openErr)
+	}
+	p.tabs <- fresh
+
+	return err
+}
+
+// Close closes every tab and the browser, it must not be called while pages
+// are running
+func (p *TabPool) Close() {
+	close(p.tabs)
+	for tab := range p.tabs {
+		tab.Close()
+	}
+	p.browser.Close()
+}
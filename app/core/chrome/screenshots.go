@@ -0,0 +1,49 @@
+package chrome
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/imagehash"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+// SCREENSHOT_DIR is where the screenshots of visits are written
+func SCREENSHOT_DIR() string {
+	return core.Env.GetDefault("SCREENSHOT_DIR", "screenshots")
+}
+
+// SaveScreenshot writes the PNG next to the other screenshots of the visit
+// and returns the row describing it with its perceptual hash
+func SaveScreenshot(visitId, kind string, data []byte) (*postgres.VisitScreenshotModel, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s screenshot of visit %s: %w", kind, visitId, err)
+	}
+
+	dir := SCREENSHOT_DIR()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create screenshot directory: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s.%s.png", visitId, kind))
+	if err := core.WriteFileAtomic(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s screenshot of visit %s: %w", kind, visitId, err)
+	}
+
+	bounds := img.Bounds()
+	return &postgres.VisitScreenshotModel{
+		VisitId:   visitId,
+		Kind:      kind,
+		Path:      path,
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		Phash:     int64(imagehash.Difference(img)),
+		CreatedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,38 @@
+package chrome
+
+import (
+	"time"
+
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+// VisitRequests converts the recorded entries to visit_requests rows, in
+// the order they were sent
+func VisitRequests(entries []NetworkEntry) []postgres.VisitRequestModel {
+	now := time.Now()
+	models := make([]postgres.VisitRequestModel, len(entries))
+	for i, entry := range entries {
+		models[i] = postgres.VisitRequestModel{
+			Seq:             i,
+			Url:             entry.Url,
+			Method:          entry.Method,
+			ResourceType:    entry.ResourceType,
+			RequestHeaders:  entry.RequestHeaders,
+			PostData:        entry.PostData,
+			Status:          entry.Status,
+			StatusText:      entry.StatusText,
+			Protocol:        entry.Protocol,
+			ResponseHeaders: entry.ResponseHeaders,
+			MimeType:        entry.MimeType,
+			RemoteIp:        entry.RemoteIp,
+			RedirectUrl:     entry.RedirectUrl,
+			EncodedSize:     entry.EncodedSize,
+			Body:            entry.Body,
+			ErrorText:       entry.ErrorText,
+			StartedAt:       entry.StartedAt,
+			DurationMs:      float64(entry.Duration.Microseconds()) / 1000,
+			CreatedAt:       now,
+		}
+	}
+	return models
+}
@@ -17,4 +17,8 @@ func Init() {
 	if err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
+
+	loadScope()
+
+	Logger.Debugf("Command run %s started", Run.Id)
 }
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// CommandRun describes a single execution of a command, every record produced
+// by the command can be traced back to it through Id.
+type CommandRun struct {
+	Id        string
+	Command   string
+	Args      []string
+	Host      string
+	StartedAt time.Time
+	EndedAt   time.Time
+
+	InputCount   atomic.Int64
+	SuccessCount atomic.Int64
+	FailureCount atomic.Int64
+}
+
+var Run = NewCommandRun()
+
+func NewCommandRun() *CommandRun {
+	host, _ := os.Hostname()
+
+	return &CommandRun{
+		Id:        NewUUID(),
+		Command:   filepath.Base(os.Args[0]),
+		Args:      os.Args[1:],
+		Host:      host,
+		StartedAt: time.Now(),
+	}
+}
+
+func (r *CommandRun) Finish() {
+	if r.EndedAt.IsZero() {
+		r.EndedAt = time.Now()
+	}
+}
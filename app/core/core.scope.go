@@ -0,0 +1,55 @@
+package core
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+var scopeFileFlag = flag.String("scope", "", "Scope rules file, defaults to SCOPE_FILE or scope.txt when present")
+
+// Scope is consulted by ProcessLines and ProcessLinesWithCache for every
+// input and output. It is filled from the scope file on Init and from the
+// ignored_hostnames table when postgres is initialized.
+var Scope = &ScopeRules{}
+
+// ScopeTargeter is implemented by outputs that are not plain strings
+type ScopeTargeter interface {
+	ScopeTarget() string
+}
+
+func loadScope() {
+	path := *scopeFileFlag
+	if path == "" {
+		path = Env.GetDefault("SCOPE_FILE", "scope.txt")
+	}
+
+	err := Scope.LoadFile(path)
+	if os.IsNotExist(err) && *scopeFileFlag == "" {
+		return
+	}
+	FatalErr(err)
+
+	Logger.Debugf("Loaded scope from %s: %d include and %d exclude rules", path, len(Scope.Include), len(Scope.Exclude))
+}
+
+// InScope checks the target and logs why it is skipped
+func InScope(target string) bool {
+	ok, reason := Scope.Check(target)
+	if !ok {
+		Logger.Infof("Skipping out of scope %s: %s", strings.TrimSpace(target), reason)
+	}
+	return ok
+}
+
+// outputInScope checks outputs which describe a single target
+func outputInScope(v any) bool {
+	switch out := v.(type) {
+	case string:
+		return InScope(out)
+	case ScopeTargeter:
+		return InScope(out.ScopeTarget())
+	default:
+		return true
+	}
+}
@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	ErrEmpty        = errors.New("empty hostname")
+	ErrIP           = errors.New("hostname is an IP address")
+	ErrInvalid      = errors.New("invalid hostname")
+	ErrPublicSuffix = errors.New("hostname is a public suffix")
+	ErrLevelTooDeep = errors.New("hostname has fewer labels than the requested level")
+)
+
+// profile converts unicode names to their ASCII form and validates labels.
+// Underscores are allowed because they appear in DNS records like _dmarc.
+var profile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.BidiRule(),
+)
+
+// Domain is a normalized hostname split around its public suffix
+type Domain struct {
+	// Name is the lowercase ASCII (punycode) form without trailing dot
+	Name string
+	// Unicode is Name with punycode labels decoded
+	Unicode string
+	// Wildcard is set when the input started with "*."
+	Wildcard bool
+	// Suffix is the public suffix, e.g. "co.uk"
+	Suffix string
+	// ICANN is false for privately managed suffixes like "github.io"
+	ICANN bool
+	// Registrable is the eTLD+1, e.g. "example.co.uk"
+	Registrable string
+	// Subdomain is what precedes Registrable, empty for the apex
+	Subdomain string
+}
+
+// Host extracts the hostname from a URL or a bare host. It handles schemes,
+// userinfo, ports, paths, IPv6 literals and a trailing dot.
+func Host(input string) string {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return ""
+	}
+
+	if !strings.Contains(input, "://") {
+		// Scheme relative URLs and bare hosts
+		input = "http://" + strings.TrimPrefix(input, "//")
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// Normalize returns the lowercase ASCII form of a hostname or URL host. A
+// leading "*." is removed, IP addresses are returned as is.
+func Normalize(input string) (string, error) {
+	d, err := parse(input)
+	if errors.Is(err, ErrIP) {
+		return Host(input), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return d.Name, nil
+}
+
+func parse(input string) (Domain, error) {
+	var d Domain
+
+	host := Host(input)
+	if strings.HasPrefix(host, "*.") {
+		d.Wildcard = true
+		host = host[2:]
+	}
+
+	if host == "" {
+		return d, ErrEmpty
+	}
+
+	if net.ParseIP(host) != nil {
+		return d, ErrIP
+	}
+
+	name, err := profile.ToASCII(host)
+	if err != nil {
+		return d, fmt.Errorf("%w %q: %v", ErrInvalid, host, err)
+	}
+
+	if err := Validate(name); err != nil {
+		return d, err
+	}
+
+	d.Name = name
+	d.Unicode, _ = idna.ToUnicode(name)
+
+	return d, nil
+}
+
+// Parse normalizes the input and splits it around its public suffix
+func Parse(input string) (Domain, error) {
+	d, err := parse(input)
+	if err != nil {
+		return d, err
+	}
+
+	d.Suffix, d.ICANN = publicsuffix.PublicSuffix(d.Name)
+	if d.Suffix == d.Name {
+		return d, fmt.Errorf("%w: %s", ErrPublicSuffix, d.Name)
+	}
+
+	d.Registrable, err = publicsuffix.EffectiveTLDPlusOne(d.Name)
+	if err != nil {
+		return d, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	d.Subdomain = strings.TrimSuffix(strings.TrimSuffix(d.Name, d.Registrable), ".")
+
+	return d, nil
+}
+
+// Validate checks the length and characters of an ASCII hostname
+func Validate(name string) error {
+	if name == "" {
+		return ErrEmpty
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("%w: %s is longer than 253 characters", ErrInvalid, name)
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("%w: bad label length in %s", ErrInvalid, name)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%w: label of %s starts or ends with a hyphen", ErrInvalid, name)
+		}
+		for _, c := range label {
+			isValid := c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+			if !isValid {
+				return fmt.Errorf("%w: %s contains %q", ErrInvalid, name, c)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Registrable returns the eTLD+1 of a hostname or URL
+func Registrable(input string) (string, error) {
+	d, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return d.Registrable, nil
+}
+
+// IsSubdomain reports whether the name is strictly below its registrable domain
+func (d Domain) IsSubdomain() bool {
+	return d.Subdomain != ""
+}
+
+// Level returns the name cut to n labels above the public suffix, level 1
+// is the registrable domain
+func (d Domain) Level(n int) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("level must be at least 1, got %d", n)
+	}
+
+	labels := strings.Split(d.Name, ".")
+	suffixLabels := strings.Count(d.Suffix, ".") + 1
+
+	if len(labels) < suffixLabels+n {
+		return "", fmt.Errorf("%w: %s", ErrLevelTooDeep, d.Name)
+	}
+
+	return strings.Join(labels[len(labels)-suffixLabels-n:], "."), nil
+}
+
+// StripWWW removes a leading "www." unless what remains is a public suffix
+func StripWWW(name string) string {
+	rest, ok := strings.CutPrefix(name, "www.")
+	if !ok {
+		return name
+	}
+
+	if suffix, _ := publicsuffix.PublicSuffix(rest); suffix == rest {
+		return name
+	}
+
+	return rest
+}
@@ -0,0 +1,447 @@
+// Package fingerprint detects the technologies of a page from its headers,
+// cookies, markup and JavaScript globals
+package fingerprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+// Signature detects Name when any of its patterns matches. Patterns are Go
+// regexes with optional Wappalyzer style tags appended, e.g.
+// `nginx/?([\d.]+)?\;version:\1\;confidence:50`. An empty pattern matches
+// the presence of the header, cookie, meta tag or global alone
+type Signature struct {
+	Name       string   `json:"name"`
+	Categories []string `json:"categories,omitempty"`
+	// Headers by name, compared case-insensitively
+	Headers map[string]string `json:"headers,omitempty"`
+	// Cookies by name, a trailing * matches names with that prefix
+	Cookies map[string]string `json:"cookies,omitempty"`
+	// Meta tags by name or property, e.g. generator
+	Meta map[string]string `json:"meta,omitempty"`
+	// ScriptSrc is matched against the URL of every script
+	ScriptSrc []string `json:"script_src,omitempty"`
+	// JS globals by dotted path, matched against their value as a string,
+	// only available when the page was evaluated in chrome
+	JS map[string]string `json:"js,omitempty"`
+	// Html is matched against the raw document
+	Html []string `json:"html,omitempty"`
+	// Implies lists technologies detected along with this one
+	Implies []string `json:"implies,omitempty"`
+	// Disabled in the signatures file removes the built-in signature
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Detection is a technology found on a page, Confidence is 0-100
+type Detection struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Confidence int      `json:"confidence"`
+	// Evidence names what matched, e.g. "header server"
+	Evidence []string `json:"evidence,omitempty"`
+}
+
+type pattern struct {
+	re         *regexp.Regexp
+	version    string
+	confidence int
+}
+
+func parsePattern(raw string) (pattern, error) {
+	parts := strings.Split(raw, `\;`)
+	p := pattern{confidence: 100}
+
+	re, err := regexp.Compile("(?i)" + parts[0])
+	if err != nil {
+		return p, err
+	}
+	p.re = re
+
+	for _, tag := range parts[1:] {
+		name, value, _ := strings.Cut(tag, ":")
+		switch name {
+		case "version":
+			p.version = value
+		case "confidence":
+			confidence, err := strconv.Atoi(value)
+			if err != nil {
+				return p, fmt.Errorf("invalid confidence %q", value)
+			}
+			p.confidence = confidence
+		}
+	}
+	return p, nil
+}
+
+// match returns whether the value matches and the version it reveals
+func (p pattern) match(value string) (bool, string) {
+	groups := p.re.FindStringSubmatch(value)
+	if groups == nil {
+		return false, ""
+	}
+	if p.version == "" {
+		return true, ""
+	}
+
+	version := p.version
+	for i := len(groups) - 1; i > 0; i-- {
+		version = strings.ReplaceAll(version, `\`+strconv.Itoa(i), groups[i])
+	}
+	return true, strings.TrimSpace(version)
+}
+
+type namedPattern struct {
+	name string
+	pattern
+}
+
+type compiledSignature struct {
+	Signature
+	headers   []namedPattern
+	cookies   []namedPattern
+	meta      []namedPattern
+	js        []namedPattern
+	scriptSrc []pattern
+	html      []pattern
+}
+
+type Engine struct {
+	signatures []compiledSignature
+	byName     map[string]int
+	globals    []string
+}
+
+// NewEngine compiles the signatures, names must be unique
+func NewEngine(signatures []Signature) (*Engine, error) {
+	e := &Engine{byName: map[string]int{}}
+	globals := map[string]bool{}
+
+	for _, signature := range signatures {
+		if signature.Name == "" {
+			return nil, fmt.Errorf("signature without a name")
+		}
+		if _, exists := e.byName[signature.Name]; exists {
+			return nil, fmt.Errorf("signature %s is defined twice", signature.Name)
+		}
+
+		compiled := compiledSignature{Signature: signature}
+
+		named := []struct {
+			patterns map[string]string
+			dest     *[]namedPattern
+			lower    bool
+		}{
+			{signature.Headers, &compiled.headers, true},
+			{signature.Cookies, &compiled.cookies, false},
+			{signature.Meta, &compiled.meta, true},
+			{signature.JS, &compiled.js, false},
+		}
+		for _, n := range named {
+			for name, raw := range n.patterns {
+				p, err := parsePattern(raw)
+				if err != nil {
+					return nil, fmt.Errorf("signature %s: %w", signature.Name, err)
+				}
+				if n.lower {
+					name = strings.ToLower(name)
+				}
+				*n.dest = append(*n.dest, namedPattern{name: name, pattern: p})
+			}
+			// Maps iterate randomly, the first version found must not
+			sort.Slice(*n.dest, func(i, j int) bool {
+				return (*n.dest)[i].name < (*n.dest)[j].name
+			})
+		}
+
+		for _, list := range []struct {
+			patterns []string
+			dest     *[]pattern
+		}{
+			{signature.ScriptSrc, &compiled.scriptSrc},
+			{signature.Html, &compiled.html},
+		} {
+			for _, raw := range list.patterns {
+				p, err := parsePattern(raw)
+				if err != nil {
+					return nil, fmt.Errorf("signature %s: %w", signature.Name, err)
+				}
+				*list.dest = append(*list.dest, p)
+			}
+		}
+
+		for path := range signature.JS {
+			globals[path] = true
+		}
+
+		e.byName[signature.Name] = len(e.signatures)
+		e.signatures = append(e.signatures, compiled)
+	}
+
+	for _, signature := range e.signatures {
+		for _, implied := range signature.Implies {
+			if _, ok := e.byName[implied]; !ok {
+				return nil, fmt.Errorf("signature %s implies unknown %s", signature.Name, implied)
+			}
+		}
+	}
+
+	for path := range globals {
+		e.globals = append(e.globals, path)
+	}
+	sort.Strings(e.globals)
+
+	return e, nil
+}
+
+// Page is what is known about a fetched page, fields left empty are not
+// checked
+type Page struct {
+	Url       string
+	Headers   map[string]string
+	Cookies   map[string]string
+	Html      string
+	ScriptSrc []string
+	// Globals are the values of the GlobalsScript paths that exist
+	Globals map[string]string
+}
+
+type detection struct {
+	Detection
+	order int
+}
+
+// Analyze returns the technologies detected on the page, most confident
+// first
+func (e *Engine) Analyze(page *Page) []Detection {
+	headers := make(map[string]string, len(page.Headers))
+	for name, value := range page.Headers {
+		headers[strings.ToLower(name)] = value
+	}
+
+	meta, scripts := parseHtml(page.Html)
+	scripts = append(scripts, page.ScriptSrc...)
+
+	found := map[string]*detection{}
+	add := func(signature *compiledSignature, evidence string, matched bool, version string, confidence int) {
+		if !matched {
+			return
+		}
+		d, ok := found[signature.Name]
+		if !ok {
+			d = &detection{Detection: Detection{Name: signature.Name, Categories: signature.Categories}, order: len(found)}
+			found[signature.Name] = d
+		}
+		d.Confidence = min(100, d.Confidence+confidence)
+		if d.Version == "" {
+			d.Version = version
+		}
+		d.Evidence = append(d.Evidence, evidence)
+	}
+
+	for i := range e.signatures {
+		signature := &e.signatures[i]
+
+		for _, p := range signature.headers {
+			if value, ok := headers[p.name]; ok {
+				matched, version := p.match(value)
+				add(signature, "header "+p.name, matched, version, p.confidence)
+			}
+		}
+
+		for _, p := range signature.cookies {
+			for name, value := range page.Cookies {
+				if cookieNameMatches(p.name, name) {
+					matched, version := p.match(value)
+					add(signature, "cookie "+name, matched, version, p.confidence)
+					break
+				}
+			}
+		}
+
+		for _, p := range signature.meta {
+			for _, value := range meta[p.name] {
+				matched, version := p.match(value)
+				add(signature, "meta "+p.name, matched, version, p.confidence)
+			}
+		}
+
+		for _, p := range signature.js {
+			if value, ok := page.Globals[p.name]; ok {
+				matched, version := p.match(value)
+				add(signature, "js "+p.name, matched, version, p.confidence)
+			}
+		}
+
+		for _, p := range signature.scriptSrc {
+			for _, src := range scripts {
+				if matched, version := p.match(src); matched {
+					add(signature, "script "+src, matched, version, p.confidence)
+					break
+				}
+			}
+		}
+
+		if page.Html != "" {
+			for _, p := range signature.html {
+				matched, version := p.match(page.Html)
+				add(signature, "html", matched, version, p.confidence)
+			}
+		}
+	}
+
+	e.addImplied(found)
+
+	detections := make([]*detection, 0, len(found))
+	for _, d := range found {
+		detections = append(detections, d)
+	}
+	sort.Slice(detections, func(i, j int) bool {
+		if detections[i].Confidence != detections[j].Confidence {
+			return detections[i].Confidence > detections[j].Confidence
+		}
+		return detections[i].order < detections[j].order
+	})
+
+	result := make([]Detection, 0, len(detections))
+	for _, d := range detections {
+		result = append(result, d.Detection)
+	}
+	return result
+}
+
+// addImplied adds what the detections imply with the confidence of the
+// detection implying it
+func (e *Engine) addImplied(found map[string]*detection) {
+	queue := make([]string, 0, len(found))
+	for name := range found {
+		queue = append(queue, name)
+	}
+	sort.Strings(queue)
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, implied := range e.signatures[e.byName[name]].Implies {
+			if _, ok := found[implied]; ok {
+				continue
+			}
+			signature := e.signatures[e.byName[implied]]
+			found[implied] = &detection{
+				Detection: Detection{
+					Name:       implied,
+					Categories: signature.Categories,
+					Confidence: found[name].Confidence,
+					Evidence:   []string{"implied by " + name},
+				},
+				order: len(found),
+			}
+			queue = append(queue, implied)
+		}
+	}
+}
+
+func cookieNameMatches(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+// GlobalsScript returns a JavaScript expression evaluating to an object of
+// the JS signature paths that exist on the page and their values, objects
+// and functions are reported as empty strings
+func (e *Engine) GlobalsScript() string {
+	paths, _ := json.Marshal(e.globals)
+	return `(() => {
+	const found = {};
+	for (const path of ` + string(paths) + `) {
+		try {
+			let value = window;
+			for (const key of path.split('.')) {
+				if (value === undefined || value === null) break;
+				value = value[key];
+			}
+			if (value === undefined || value === null) continue;
+			found[path] = ['string', 'number', 'boolean'].includes(typeof value) ? String(value) : '';
+		} catch (e) {}
+	}
+	return found;
+})()`
+}
+
+// ParseSetCookie returns the cookie names and values of Set-Cookie header
+// values, chrome joins repeated headers with newlines
+func ParseSetCookie(values ...string) map[string]string {
+	cookies := map[string]string{}
+	for _, value := range values {
+		for _, line := range strings.Split(value, "\n") {
+			pair, _, _ := strings.Cut(line, ";")
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && name != "" {
+				cookies[name] = value
+			}
+		}
+	}
+	return cookies
+}
+
+// MergeSignatures adds the signatures of the signatures file to the base
+// ones, a signature of the file replaces the base one of the same name and
+// a disabled one only removes it
+func MergeSignatures(base, fileSignatures []Signature) []Signature {
+	replaced := make(map[string]bool)
+	for _, signature := range fileSignatures {
+		replaced[signature.Name] = true
+	}
+
+	var signatures []Signature
+	for _, signature := range base {
+		if !replaced[signature.Name] {
+			signatures = append(signatures, signature)
+		}
+	}
+	for _, signature := range fileSignatures {
+		if !signature.Disabled {
+			signatures = append(signatures, signature)
+		}
+	}
+	return signatures
+}
+
+var (
+	defaultSignatures []Signature
+	defaultEngine     *Engine
+	defaultEngineOnce sync.Once
+)
+
+// Default is the engine of the built-in signatures merged with the file
+// from FINGERPRINTS_FILE, or fingerprints.json when present
+func Default() *Engine {
+	defaultEngineOnce.Do(func() {
+		fileSignatures, file, err := core.LoadOverrides[Signature]("FINGERPRINTS_FILE", "fingerprints.json")
+		core.FatalErr(err)
+		if file != "" {
+			core.Logger.Debugf("Loaded fingerprints from %s", file)
+		}
+
+		defaultSignatures = MergeSignatures(DefaultSignatures, fileSignatures)
+		defaultEngine = core.Fatal1Err(NewEngine(defaultSignatures))
+	})
+	return defaultEngine
+}
+
+// Signatures returns the signatures of the Default engine
+func Signatures() []Signature {
+	Default()
+	return defaultSignatures
+}
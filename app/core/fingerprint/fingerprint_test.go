@@ -0,0 +1,173 @@
+package fingerprint
+
+import (
+	"slices"
+	"testing"
+)
+
+var testSignatures = []Signature{
+	{
+		Name:    "nginx",
+		Headers: map[string]string{"server": `nginx/?([\d.]+)?\;version:\1`},
+	},
+	{
+		Name:    "Express",
+		Headers: map[string]string{"x-powered-by": `^Express$`},
+		Implies: []string{"Node.js"},
+	},
+	{
+		Name: "Node.js",
+	},
+	{
+		Name:    "Laravel",
+		Cookies: map[string]string{"laravel_session": ""},
+		Implies: []string{"PHP"},
+	},
+	{
+		Name: "PHP",
+	},
+	{
+		Name: "jQuery",
+		ScriptSrc: []string{
+			`jquery[.-]([\d.]+)(?:\.min)?\.js\;version:\1`,
+		},
+	},
+	{
+		Name: "Hugo",
+		Meta: map[string]string{"generator": `^Hugo ([\d.]+)\;version:\1`},
+	},
+	{
+		Name: "React",
+		JS:   map[string]string{"React.version": `^(.+)$\;version:\1`},
+		Html: []string{`<[^>]+data-reactroot\;confidence:50`},
+	},
+	{
+		Name:    "Cloudflare",
+		Cookies: map[string]string{"__cf*": ""},
+	},
+}
+
+type result struct {
+	name       string
+	version    string
+	confidence int
+}
+
+func TestAnalyze(t *testing.T) {
+	engine, err := NewEngine(testSignatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		page Page
+		want []result
+	}{
+		{
+			name: "nothing matches",
+			page: Page{Headers: map[string]string{"Server": "Apache"}},
+			want: []result{},
+		},
+		{
+			name: "header with version",
+			page: Page{Headers: map[string]string{"Server": "nginx/1.25.3"}},
+			want: []result{{"nginx", "1.25.3", 100}},
+		},
+		{
+			name: "header without version",
+			page: Page{Headers: map[string]string{"server": "nginx"}},
+			want: []result{{"nginx", "", 100}},
+		},
+		{
+			name: "implied technology",
+			page: Page{Headers: map[string]string{"X-Powered-By": "Express"}},
+			want: []result{{"Express", "", 100}, {"Node.js", "", 100}},
+		},
+		{
+			name: "cookie presence and prefix",
+			page: Page{Cookies: map[string]string{"laravel_session": "abc", "__cfduid": "x"}},
+			want: []result{{"Laravel", "", 100}, {"Cloudflare", "", 100}, {"PHP", "", 100}},
+		},
+		{
+			name: "script src from the markup",
+			page: Page{Html: `<html><head><script src="/js/jquery-3.7.1.min.js"></script></head></html>`},
+			want: []result{{"jQuery", "3.7.1", 100}},
+		},
+		{
+			name: "meta generator",
+			page: Page{Html: `<html><head><meta name="generator" content="Hugo 0.121.0"></head></html>`},
+			want: []result{{"Hugo", "0.121.0", 100}},
+		},
+		{
+			name: "low confidence html",
+			page: Page{Html: `<div data-reactroot=""></div>`},
+			want: []result{{"React", "", 50}},
+		},
+		{
+			name: "js global adds up with html",
+			page: Page{Html: `<div data-reactroot=""></div>`, Globals: map[string]string{"React.version": "18.2.0"}},
+			want: []result{{"React", "18.2.0", 100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detections := engine.Analyze(&tt.page)
+
+			got := make([]result, len(detections))
+			for i, d := range detections {
+				got[i] = result{d.Name, d.Version, d.Confidence}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeDefaultSignatures(t *testing.T) {
+	engine, err := NewEngine(DefaultSignatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detections := engine.Analyze(&Page{
+		Html: `<html><head><meta name="generator" content="WordPress 6.4.2"></head></html>`,
+	})
+
+	var names []string
+	for _, d := range detections {
+		names = append(names, d.Name)
+		if d.Name == "WordPress" && d.Version != "6.4.2" {
+			t.Errorf("WordPress version = %q, want 6.4.2", d.Version)
+		}
+	}
+	for _, want := range []string{"WordPress", "PHP"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("Analyze detected %v, want %s", names, want)
+		}
+	}
+}
+
+func TestMergeSignatures(t *testing.T) {
+	base := []Signature{{Name: "A"}, {Name: "B"}, {Name: "C"}}
+	file := []Signature{{Name: "B", Disabled: true}, {Name: "C", Implies: []string{"A"}}, {Name: "D"}}
+
+	var names []string
+	for _, signature := range MergeSignatures(base, file) {
+		names = append(names, signature.Name)
+		if signature.Name == "C" && len(signature.Implies) == 0 {
+			t.Error("C was not replaced by the file signature")
+		}
+	}
+	if want := []string{"A", "C", "D"}; !slices.Equal(names, want) {
+		t.Errorf("MergeSignatures names = %v, want %v", names, want)
+	}
+}
+
+func TestNewEngineRejectsDuplicateNames(t *testing.T) {
+	if _, err := NewEngine([]Signature{{Name: "A"}, {Name: "A"}}); err == nil {
+		t.Error("NewEngine accepted a signature defined twice")
+	}
+}
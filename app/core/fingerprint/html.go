@@ -0,0 +1,66 @@
+package fingerprint
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// parseHtml collects the meta tags by lowercase name or property and the
+// script URLs of the document
+func parseHtml(document string) (map[string][]string, []string) {
+	meta := map[string][]string{}
+	var scripts []string
+	if document == "" {
+		return meta, scripts
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return meta, scripts
+			}
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		name, hasAttr := tokenizer.TagName()
+		if !hasAttr {
+			continue
+		}
+
+		switch string(name) {
+		case "meta":
+			attrs := attributes(tokenizer)
+			key := attrs["name"]
+			if key == "" {
+				key = attrs["property"]
+			}
+			if key != "" {
+				key = strings.ToLower(key)
+				meta[key] = append(meta[key], attrs["content"])
+			}
+		case "script":
+			if src := attributes(tokenizer)["src"]; src != "" {
+				scripts = append(scripts, src)
+			}
+		}
+	}
+	return meta, scripts
+}
+
+func attributes(tokenizer *html.Tokenizer) map[string]string {
+	attrs := map[string]string{}
+	for {
+		key, value, more := tokenizer.TagAttr()
+		attrs[string(key)] = string(value)
+		if !more {
+			return attrs
+		}
+	}
+}
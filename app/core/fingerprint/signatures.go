@@ -0,0 +1,432 @@
+package fingerprint
+
+const (
+	CategoryCMS       = "cms"
+	CategoryFramework = "framework"
+	CategoryJSLibrary = "js-library"
+	CategoryServer    = "web-server"
+	CategoryLanguage  = "language"
+	CategoryCDN       = "cdn"
+	CategoryWAF       = "waf"
+	CategoryPaaS      = "paas"
+	CategoryAnalytics = "analytics"
+	CategorySecurity  = "security"
+	CategoryEcommerce = "ecommerce"
+)
+
+// DefaultSignatures are the built-in signatures, the signatures file adds to
+// and replaces them
+var DefaultSignatures = []Signature{
+	// CMS
+	{
+		Name:       "WordPress",
+		Categories: []string{CategoryCMS},
+		Meta:       map[string]string{"generator": `^WordPress ?([\d.]+)?\;version:\1`},
+		Html:       []string{`<link[^>]+/wp-(?:content|includes)/`},
+		ScriptSrc:  []string{`/wp-(?:content|includes)/`},
+		Cookies:    map[string]string{"wordpress_*": "", "wp-settings-*": ""},
+		Headers:    map[string]string{"link": `rel="https://api\.w\.org/"`},
+		Implies:    []string{"PHP"},
+	},
+	{
+		Name:       "Drupal",
+		Categories: []string{CategoryCMS},
+		Meta:       map[string]string{"generator": `^Drupal(?:\s([\d.]+))?\;version:\1`},
+		Headers:    map[string]string{"x-generator": `^Drupal(?:\s([\d.]+))?\;version:\1`, "x-drupal-cache": "", "x-drupal-dynamic-cache": ""},
+		JS:         map[string]string{"Drupal": ""},
+		ScriptSrc:  []string{`/(?:misc|core/misc)/drupal\.js`},
+		Implies:    []string{"PHP"},
+	},
+	{
+		Name:       "Joomla",
+		Categories: []string{CategoryCMS},
+		Meta:       map[string]string{"generator": `Joomla!?\s?([\d.]+)?\;version:\1`},
+		Html:       []string{`<script[^>]+/media/(?:system|jui)/js/\;confidence:50`},
+		JS:         map[string]string{"Joomla": ""},
+		Implies:    []string{"PHP"},
+	},
+	{
+		Name:       "Ghost",
+		Categories: []string{CategoryCMS},
+		Meta:       map[string]string{"generator": `^Ghost(?:\s([\d.]+))?\;version:\1`},
+		Headers:    map[string]string{"x-ghost-cache-status": ""},
+	},
+	{
+		Name:       "Confluence",
+		Categories: []string{CategoryCMS},
+		Meta:       map[string]string{"ajs-version-number": `^([\d.]+)\;version:\1`},
+		Headers:    map[string]string{"x-confluence-request-time": ""},
+		Implies:    []string{"Java"},
+	},
+	{
+		Name:       "Wix",
+		Categories: []string{CategoryCMS},
+		Meta:       map[string]string{"generator": `Wix\.com`},
+		Headers:    map[string]string{"x-wix-request-id": ""},
+	},
+	{
+		Name:       "Squarespace",
+		Categories: []string{CategoryCMS},
+		Headers:    map[string]string{"server": `^Squarespace`},
+		JS:         map[string]string{"Static.SQUARESPACE_CONTEXT": ""},
+	},
+	{
+		Name:       "Shopify",
+		Categories: []string{CategoryEcommerce},
+		Headers:    map[string]string{"x-shopid": "", "x-shopify-stage": ""},
+		ScriptSrc:  []string{`cdn\.shopify\.com`},
+		JS:         map[string]string{"Shopify.shop": ""},
+	},
+	{
+		Name:       "Magento",
+		Categories: []string{CategoryEcommerce},
+		ScriptSrc:  []string{`/static/version\d+/frontend/`, `js/mage/`},
+		JS:         map[string]string{"Mage": ""},
+		Cookies:    map[string]string{"X-Magento-Vary": ""},
+		Implies:    []string{"PHP"},
+	},
+
+	// Frameworks and libraries
+	{
+		Name:       "React",
+		Categories: []string{CategoryJSLibrary},
+		JS:         map[string]string{"React.version": `^(.+)$\;version:\1`},
+		Html:       []string{`<[^>]+data-react(?:root|id)`},
+	},
+	{
+		Name:       "Next.js",
+		Categories: []string{CategoryFramework},
+		Headers:    map[string]string{"x-powered-by": `^Next\.js ?([\d.]+)?\;version:\1`},
+		JS:         map[string]string{"__NEXT_DATA__": "", "next.version": `^(.+)$\;version:\1`},
+		ScriptSrc:  []string{`/_next/static/`},
+		Implies:    []string{"React"},
+	},
+	{
+		Name:       "Vue.js",
+		Categories: []string{CategoryJSLibrary},
+		JS:         map[string]string{"Vue.version": `^(.+)$\;version:\1`, "__VUE__": ""},
+		Html:       []string{`<[^>]+\sdata-v-[0-9a-f]{8}\;confidence:50`},
+	},
+	{
+		Name:       "Nuxt.js",
+		Categories: []string{CategoryFramework},
+		JS:         map[string]string{"__NUXT__": "", "$nuxt": ""},
+		ScriptSrc:  []string{`/_nuxt/`},
+		Implies:    []string{"Vue.js"},
+	},
+	{
+		Name:       "Angular",
+		Categories: []string{CategoryFramework},
+		Html:       []string{`<[^>]+ ng-version="([\d.]+)"\;version:\1`},
+		JS:         map[string]string{"ng.getComponent": ""},
+	},
+	{
+		Name:       "AngularJS",
+		Categories: []string{CategoryFramework},
+		JS:         map[string]string{"angular.version.full": `^(.+)$\;version:\1`},
+		ScriptSrc:  []string{`angular(?:\.min)?\.js`},
+	},
+	{
+		Name:       "Ember.js",
+		Categories: []string{CategoryFramework},
+		JS:         map[string]string{"Ember.VERSION": `^(.+)$\;version:\1`},
+	},
+	{
+		Name:       "Svelte",
+		Categories: []string{CategoryFramework},
+		Html:       []string{`<[^>]+class="[^"]*svelte-[a-z0-9]{5,}\;confidence:50`},
+	},
+	{
+		Name:       "Gatsby",
+		Categories: []string{CategoryFramework},
+		Meta:       map[string]string{"generator": `^Gatsby(?: ([\d.]+))?\;version:\1`},
+		Html:       []string{`<div[^>]+id="___gatsby"`},
+		Implies:    []string{"React"},
+	},
+	{
+		Name:       "jQuery",
+		Categories: []string{CategoryJSLibrary},
+		JS:         map[string]string{"jQuery.fn.jquery": `^(.+)$\;version:\1`},
+		ScriptSrc:  []string{`jquery[.-]([\d.]+)(?:\.min)?\.js\;version:\1`, `/jquery(?:\.min)?\.js`},
+	},
+	{
+		Name:       "Bootstrap",
+		Categories: []string{CategoryJSLibrary},
+		JS:         map[string]string{"bootstrap.Alert.VERSION": `^(.+)$\;version:\1`},
+		ScriptSrc:  []string{`bootstrap(?:[.-]([\d.]+))?(?:\.bundle)?(?:\.min)?\.js\;version:\1`},
+	},
+	{
+		Name:       "Laravel",
+		Categories: []string{CategoryFramework},
+		Cookies:    map[string]string{"laravel_session": ""},
+		Implies:    []string{"PHP"},
+	},
+	{
+		Name:       "Django",
+		Categories: []string{CategoryFramework},
+		Html:       []string{`<input[^>]+name="csrfmiddlewaretoken"`},
+		Cookies:    map[string]string{"django_language": ""},
+		Implies:    []string{"Python"},
+	},
+	{
+		Name:       "Ruby on Rails",
+		Categories: []string{CategoryFramework},
+		Meta:       map[string]string{"csrf-param": `^authenticity_token$`},
+		Cookies:    map[string]string{"_rails_session": ""},
+		Headers:    map[string]string{"x-powered-by": `Phusion Passenger\;confidence:50`},
+		Implies:    []string{"Ruby"},
+	},
+	{
+		Name:       "Express",
+		Categories: []string{CategoryFramework},
+		Headers:    map[string]string{"x-powered-by": `^Express$`},
+		Implies:    []string{"Node.js"},
+	},
+	{
+		Name:       "ASP.NET",
+		Categories: []string{CategoryFramework},
+		Headers:    map[string]string{"x-aspnet-version": `^(.+)$\;version:\1`, "x-powered-by": `^ASP\.NET`},
+		Cookies:    map[string]string{"ASP.NET_SessionId": "", ".AspNetCore.*": ""},
+		Html:       []string{`<input[^>]+name="__VIEWSTATE"`},
+	},
+	{
+		Name:       "Spring",
+		Categories: []string{CategoryFramework},
+		Headers:    map[string]string{"x-application-context": ""},
+		Implies:    []string{"Java"},
+	},
+
+	// Languages
+	{
+		Name:       "PHP",
+		Categories: []string{CategoryLanguage},
+		Headers:    map[string]string{"x-powered-by": `^PHP/?([\d.]+)?\;version:\1`},
+		Cookies:    map[string]string{"PHPSESSID": ""},
+	},
+	{
+		Name:       "Java",
+		Categories: []string{CategoryLanguage},
+		Cookies:    map[string]string{"JSESSIONID": ""},
+	},
+	{
+		Name:       "Python",
+		Categories: []string{CategoryLanguage},
+		Headers:    map[string]string{"server": `(?:^|\s)Python/?([\d.]+)?\;version:\1`},
+	},
+	{
+		Name:       "Ruby",
+		Categories: []string{CategoryLanguage},
+	},
+	{
+		Name:       "Node.js",
+		Categories: []string{CategoryLanguage},
+	},
+
+	// Web servers
+	{
+		Name:       "Nginx",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `nginx(?:/([\d.]+))?\;version:\1`},
+	},
+	{
+		Name:       "OpenResty",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `openresty(?:/([\d.]+))?\;version:\1`},
+		Implies:    []string{"Nginx"},
+	},
+	{
+		Name:       "Apache HTTP Server",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `(?:Apache(?:$|/([\d.]+)|[^-])|(?:^|\b)HTTPD)\;version:\1`},
+	},
+	{
+		Name:       "Microsoft IIS",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `^Microsoft-IIS(?:/([\d.]+))?\;version:\1`},
+	},
+	{
+		Name:       "LiteSpeed",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `^LiteSpeed`},
+	},
+	{
+		Name:       "Caddy",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `^Caddy`},
+	},
+	{
+		Name:       "Envoy",
+		Categories: []string{CategoryServer},
+		Headers:    map[string]string{"server": `^envoy`, "x-envoy-upstream-service-time": ""},
+	},
+
+	// CDNs
+	{
+		Name:       "Cloudflare",
+		Categories: []string{CategoryCDN},
+		Headers:    map[string]string{"server": `^cloudflare$`, "cf-ray": "", "cf-cache-status": ""},
+		Cookies:    map[string]string{"__cfduid": "", "__cflb": ""},
+	},
+	{
+		Name:       "Amazon CloudFront",
+		Categories: []string{CategoryCDN},
+		Headers:    map[string]string{"x-amz-cf-id": "", "via": `\(CloudFront\)$`},
+	},
+	{
+		Name:       "Fastly",
+		Categories: []string{CategoryCDN},
+		Headers:    map[string]string{"x-fastly-request-id": "", "x-served-by": `^cache-\;confidence:50`},
+	},
+	{
+		Name:       "Akamai",
+		Categories: []string{CategoryCDN},
+		Headers:    map[string]string{"x-akamai-transformed": "", "server": `^AkamaiGHost`, "x-akamai-request-id": ""},
+	},
+	{
+		Name:       "Azure Front Door",
+		Categories: []string{CategoryCDN},
+		Headers:    map[string]string{"x-azure-ref": ""},
+	},
+	{
+		Name:       "Google Cloud CDN",
+		Categories: []string{CategoryCDN},
+		Headers:    map[string]string{"via": `^1\.1 google$\;confidence:50`},
+	},
+	{
+		Name:       "jsDelivr",
+		Categories: []string{CategoryCDN},
+		ScriptSrc:  []string{`cdn\.jsdelivr\.net`},
+	},
+	{
+		Name:       "cdnjs",
+		Categories: []string{CategoryCDN},
+		ScriptSrc:  []string{`cdnjs\.cloudflare\.com`},
+	},
+	{
+		Name:       "unpkg",
+		Categories: []string{CategoryCDN},
+		ScriptSrc:  []string{`unpkg\.com`},
+	},
+
+	// WAFs and bot protection
+	{
+		Name:       "Cloudflare Bot Management",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"__cf_bm": "", "cf_clearance": ""},
+		Implies:    []string{"Cloudflare"},
+	},
+	{
+		Name:       "Imperva Incapsula",
+		Categories: []string{CategoryWAF, CategoryCDN},
+		Headers:    map[string]string{"x-iinfo": "", "x-cdn": `Incapsula`},
+		Cookies:    map[string]string{"incap_ses_*": "", "visid_incap_*": ""},
+	},
+	{
+		Name:       "Sucuri",
+		Categories: []string{CategoryWAF},
+		Headers:    map[string]string{"x-sucuri-id": "", "server": `^Sucuri(?:/Cloudproxy)?`},
+	},
+	{
+		Name:       "AWS WAF",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"aws-waf-token": ""},
+		Headers:    map[string]string{"x-amzn-waf-action": ""},
+	},
+	{
+		Name:       "Akamai Bot Manager",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"_abck": "", "bm_sz": ""},
+		Implies:    []string{"Akamai"},
+	},
+	{
+		Name:       "F5 BIG-IP",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"BIGipServer*": "", "TS01*": `\;confidence:50`},
+		Headers:    map[string]string{"server": `^BigIP`},
+	},
+	{
+		Name:       "DataDome",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"datadome": ""},
+		Headers:    map[string]string{"x-datadome": "", "x-datadome-cid": ""},
+	},
+	{
+		Name:       "PerimeterX",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"_px3": "", "_pxhd": "", "_pxvid": ""},
+	},
+	{
+		Name:       "Barracuda",
+		Categories: []string{CategoryWAF},
+		Cookies:    map[string]string{"barra_counter_session": ""},
+	},
+
+	// Hosting
+	{
+		Name:       "Vercel",
+		Categories: []string{CategoryPaaS},
+		Headers:    map[string]string{"server": `^Vercel$`, "x-vercel-id": ""},
+	},
+	{
+		Name:       "Netlify",
+		Categories: []string{CategoryPaaS, CategoryCDN},
+		Headers:    map[string]string{"server": `^Netlify`, "x-nf-request-id": ""},
+	},
+	{
+		Name:       "Heroku",
+		Categories: []string{CategoryPaaS},
+		Headers:    map[string]string{"via": `vegur`},
+	},
+	{
+		Name:       "GitHub Pages",
+		Categories: []string{CategoryPaaS},
+		Headers:    map[string]string{"server": `^GitHub\.com$`, "x-github-request-id": ""},
+	},
+	{
+		Name:       "Amazon S3",
+		Categories: []string{CategoryPaaS},
+		Headers:    map[string]string{"server": `^AmazonS3$`},
+	},
+	{
+		Name:       "Amazon ELB",
+		Categories: []string{CategoryPaaS},
+		Cookies:    map[string]string{"AWSALB": "", "AWSELB": "", "AWSALBCORS": ""},
+		Headers:    map[string]string{"server": `^awselb`},
+	},
+
+	// Analytics and security widgets
+	{
+		Name:       "Google Analytics",
+		Categories: []string{CategoryAnalytics},
+		ScriptSrc:  []string{`google-analytics\.com/(?:ga|urchin|analytics)\.js`, `googletagmanager\.com/gtag/js`},
+		JS:         map[string]string{"GoogleAnalyticsObject": "", "gaGlobal": ""},
+	},
+	{
+		Name:       "Google Tag Manager",
+		Categories: []string{CategoryAnalytics},
+		ScriptSrc:  []string{`googletagmanager\.com/gtm\.js`},
+		JS:         map[string]string{"google_tag_manager": ""},
+	},
+	{
+		Name:       "Hotjar",
+		Categories: []string{CategoryAnalytics},
+		ScriptSrc:  []string{`static\.hotjar\.com`},
+		JS:         map[string]string{"hj": ""},
+	},
+	{
+		Name:       "Sentry",
+		Categories: []string{CategoryAnalytics},
+		ScriptSrc:  []string{`browser\.sentry-cdn\.com/([\d.]+)/\;version:\1`},
+		JS:         map[string]string{"Sentry.SDK_VERSION": `^(.+)$\;version:\1`, "__SENTRY__": ""},
+	},
+	{
+		Name:       "reCAPTCHA",
+		Categories: []string{CategorySecurity},
+		ScriptSrc:  []string{`(?:google\.com|recaptcha\.net)/recaptcha/`},
+	},
+	{
+		Name:       "hCaptcha",
+		Categories: []string{CategorySecurity},
+		ScriptSrc:  []string{`hcaptcha\.com/1/api\.js`},
+	},
+}
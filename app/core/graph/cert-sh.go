@@ -0,0 +1,40 @@
+package graph
+
+import (
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core/neo4j"
+)
+
+// AddCrtshRecords mirrors neo4j.CrtshInsertQuery.
+func (b *Batch) AddCrtshRecords(certs []neo4j.CrtshCert) {
+	for _, cert := range certs {
+		c := b.Found(Node{
+			Ref: NewRef(LabelCertificate, cert.ID),
+			Props: map[string]any{
+				"serial_number":   cert.SerialNumber,
+				"not_before":      cert.NotBefore,
+				"not_after":       cert.NotAfter,
+				"entry_timestamp": cert.EntryTimestamp,
+			},
+		})
+
+		i := b.Found(Node{
+			Ref:   NewRef(LabelIssuer, cert.IssuerName),
+			Props: map[string]any{"issuer_ca_id": cert.IssuerCAID},
+		})
+		b.Relate(c, RelIssuedBy, i)
+
+		d := b.Found(Node{Ref: NewRef(LabelDnsName, cert.CommonName)})
+		b.Relate(c, RelSecures, d)
+
+		if cert.NameValue == "" {
+			continue
+		}
+
+		for _, altName := range strings.Split(cert.NameValue, "\n") {
+			alt := b.AddNode(Node{Ref: NewRef(LabelDnsName, altName)})
+			b.Relate(c, RelSecures, alt)
+		}
+	}
+}
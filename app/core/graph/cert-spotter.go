@@ -0,0 +1,29 @@
+package graph
+
+import (
+	"github.com/mgorunuch/microb/app/core/neo4j"
+)
+
+// AddCertspotterRecords mirrors neo4j.CertspotterInsertQuery.
+func (b *Batch) AddCertspotterRecords(certs []neo4j.CertspotterCert) {
+	for _, cert := range certs {
+		c := b.Found(Node{
+			Ref: NewRef(LabelCertificate, cert.ID),
+			Props: map[string]any{
+				"tbs_sha256":  cert.TbsSHA256,
+				"cert_sha256": cert.CertSHA256,
+				"not_before":  cert.NotBefore,
+				"not_after":   cert.NotAfter,
+				"revoked":     cert.Revoked,
+			},
+		})
+
+		pk := b.Found(Node{Ref: NewRef(LabelPublicKey, cert.PubkeySHA256)})
+		b.Relate(c, RelUses, pk)
+
+		for _, dnsName := range cert.DNSNames {
+			d := b.Found(Node{Ref: NewRef(LabelDnsName, dnsName)})
+			b.Relate(c, RelSecures, d)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package graph
+
+import (
+	"github.com/mgorunuch/microb/app/core/neo4j"
+)
+
+// AddCommonCrawlRecords mirrors neo4j.CommonCrawlInsertQuery.
+func (b *Batch) AddCommonCrawlRecords(webpages []neo4j.CommonCrawlWebpage) {
+	for _, webpage := range webpages {
+		props := webpage.ToMap()
+		delete(props, "urlkey")
+		props["first_seen"] = webpage.Timestamp.Unix()
+		props["last_seen"] = webpage.Timestamp.Unix()
+
+		b.Found(Node{
+			Ref:   NewRef(LabelWebpage, webpage.Urlkey),
+			Props: props,
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"github.com/mgorunuch/microb/app/core/neo4j"
+)
+
+// AddDnsRecords mirrors neo4j.DnsRecordInsertQuery.
+func (b *Batch) AddDnsRecords(records []neo4j.DnsRecord) {
+	for _, record := range records {
+		ts := record.Timestamp.Unix()
+
+		h := b.Found(Node{
+			Ref: NewRef(LabelHostname, record.Hostname),
+			Props: map[string]any{
+				"asset_type": record.AssetType,
+				"first_seen": ts,
+				"last_seen":  ts,
+			},
+		})
+
+		a := b.Found(Node{Ref: NewRef(LabelAddress, record.Address)})
+		b.AddNode(Node{Ref: NewRef(LabelRecordType, record.RecordType)})
+
+		b.Relationships = append(b.Relationships, Relationship{
+			Type: RelHasDnsRecord,
+			From: h,
+			To:   a,
+			Props: map[string]any{
+				"record_type": record.RecordType,
+				"first_seen":  ts,
+				"last_seen":   ts,
+			},
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package graph
+
+import (
+	"github.com/mgorunuch/microb/app/core/neo4j"
+)
+
+// AddGoogleSearchRecords mirrors neo4j.GoogleSearchInsertQuery.
+func (b *Batch) AddGoogleSearchRecords(results []neo4j.GoogleSearchResult) {
+	for _, result := range results {
+		ts := result.Timestamp.Unix()
+
+		w := b.Found(Node{
+			Ref:   NewRef(LabelWebsite, result.DisplayLink),
+			Props: map[string]any{"first_seen": ts, "last_seen": ts},
+		})
+
+		r := b.Found(Node{
+			Ref: NewRef(LabelSearchResult, result.Link),
+			Props: map[string]any{
+				"title":      result.Title,
+				"snippet":    result.Snippet,
+				"first_seen": ts,
+				"last_seen":  ts,
+			},
+		})
+
+		b.Relate(r, RelHostedBy, w)
+	}
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/neo4j"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const (
+	BackendNeo4j    = "neo4j"
+	BackendPostgres = "postgres"
+)
+
+func GRAPH_BACKEND() string {
+	return core.Env.GetDefault("GRAPH_BACKEND", BackendNeo4j)
+}
+
+// Backend stores the node/relationship model shared by all ingest commands.
+type Backend interface {
+	Write(ctx context.Context, batch *Batch) error
+	// Related returns the nodes connected to ref in either direction.
+	// An empty relType matches every relationship type.
+	Related(ctx context.Context, ref Ref, relType string) ([]Node, error)
+}
+
+var Store Backend
+
+func Init(ctx context.Context) func() error {
+	switch backend := GRAPH_BACKEND(); backend {
+	case BackendNeo4j:
+		cleanup := neo4j.Init(ctx)
+		if err := neo4j.SetupConstraints(ctx, constraintQueries()); err != nil {
+			core.Logger.Fatalf("Failed to set up graph constraints: %v", err)
+		}
+		runCleanup := postgres.InitIfConfigured(ctx)
+		Store = &Neo4jBackend{}
+		return func() error {
+			core.Closer(runCleanup)()
+			return cleanup()
+		}
+	case BackendPostgres:
+		cleanup := postgres.Init(ctx)
+		Store = &PostgresBackend{}
+		return cleanup
+	default:
+		core.Logger.Fatalf("Unknown graph backend: %s", backend)
+		return nil
+	}
+}
@@ -0,0 +1,252 @@
+package graph
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+const (
+	LabelCommand      = "Command"
+	LabelCommandRun   = "CommandRun"
+	LabelCertificate  = "Certificate"
+	LabelIssuer       = "Issuer"
+	LabelPublicKey    = "PublicKey"
+	LabelDnsName      = "DnsName"
+	LabelWebsite      = "Website"
+	LabelURLPath      = "URLPath"
+	LabelURL          = "URL"
+	LabelHostname     = "Hostname"
+	LabelAddress      = "Address"
+	LabelRecordType   = "RecordType"
+	LabelSearchResult = "SearchResult"
+	LabelWebpage      = "Webpage"
+	LabelTechnology   = "Technology"
+)
+
+const (
+	RelExecuted     = "EXECUTED"
+	RelFound        = "FOUND"
+	RelIssuedBy     = "ISSUED_BY"
+	RelSecures      = "SECURES"
+	RelUses         = "USES"
+	RelHasPath      = "HAS_PATH"
+	RelHasURL       = "HAS_URL"
+	RelHostedBy     = "HOSTED_BY"
+	RelHasDnsRecord = "HAS_DNS_RECORD"
+	RelRuns         = "RUNS"
+)
+
+// KeyProps lists the properties that uniquely identify a node of the given label.
+// They mirror the unique constraints declared in the neo4j package.
+var KeyProps = map[string][]string{
+	LabelCommand:      {"name"},
+	LabelCommandRun:   {"key"},
+	LabelCertificate:  {"cert_id"},
+	LabelIssuer:       {"name"},
+	LabelPublicKey:    {"pubkey_sha256"},
+	LabelDnsName:      {"name"},
+	LabelWebsite:      {"domain"},
+	LabelURLPath:      {"website", "path"},
+	LabelURL:          {"url"},
+	LabelHostname:     {"name"},
+	LabelAddress:      {"value"},
+	LabelRecordType:   {"type"},
+	LabelSearchResult: {"link"},
+	LabelWebpage:      {"urlkey"},
+	LabelTechnology:   {"name"},
+}
+
+// intKeyLabels have keys stored as integers by some sources, crt.sh
+// certificate ids are int64 while certspotter ones are strings
+var intKeyLabels = map[string]bool{
+	LabelCertificate: true,
+}
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Ref identifies a node by its label and key properties.
+type Ref struct {
+	Label string
+	Key   map[string]any
+}
+
+type Node struct {
+	Ref
+	Props map[string]any
+}
+
+type Relationship struct {
+	Type  string
+	From  Ref
+	To    Ref
+	Props map[string]any
+}
+
+// NewRef builds a ref for labels identified by a single property.
+func NewRef(label string, value any) Ref {
+	return Ref{Label: label, Key: map[string]any{KeyProps[label][0]: value}}
+}
+
+// ParseRefs returns the refs a text value, e.g. a line of input, may identify
+// a node of the label by, one per type its key is stored as
+func ParseRefs(label string, value string) []Ref {
+	refs := []Ref{NewRef(label, value)}
+	if intKeyLabels[label] {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			refs = append(refs, NewRef(label, n))
+		}
+	}
+	return refs
+}
+
+func (r Ref) Validate() error {
+	if !identifierRegex.MatchString(r.Label) {
+		return fmt.Errorf("invalid label: %q", r.Label)
+	}
+
+	keyProps, ok := KeyProps[r.Label]
+	if !ok {
+		return fmt.Errorf("unknown label: %s", r.Label)
+	}
+
+	if len(keyProps) != len(r.Key) {
+		return fmt.Errorf("label %s expects key %v, got %v", r.Label, keyProps, r.KeyNames())
+	}
+
+	for _, prop := range keyProps {
+		if _, ok := r.Key[prop]; !ok {
+			return fmt.Errorf("label %s is missing key property %s", r.Label, prop)
+		}
+	}
+
+	return nil
+}
+
+func (r Ref) KeyNames() []string {
+	names := make([]string, 0, len(r.Key))
+	for name := range r.Key {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitProps separates the stored properties of a node into its key and the remaining props.
+func splitProps(label string, all map[string]any) Node {
+	node := Node{
+		Ref:   Ref{Label: label, Key: map[string]any{}},
+		Props: map[string]any{},
+	}
+
+	isKey := map[string]bool{}
+	for _, prop := range KeyProps[label] {
+		isKey[prop] = true
+	}
+
+	for name, value := range all {
+		if isKey[name] {
+			node.Key[name] = value
+		} else {
+			node.Props[name] = value
+		}
+	}
+
+	return node
+}
+
+// Batch collects the nodes and relationships produced by a single command run.
+type Batch struct {
+	Run           Ref
+	Nodes         []Node
+	Relationships []Relationship
+}
+
+func NewRunBatch(commandName string, runKey string, runTimestamp time.Time) *Batch {
+	b := &Batch{}
+
+	cmd := b.AddNode(Node{Ref: NewRef(LabelCommand, commandName)})
+	b.Run = b.AddNode(Node{
+		Ref:   NewRef(LabelCommandRun, runKey),
+		Props: map[string]any{"timestamp": runTimestamp.Unix()},
+	})
+	b.Relate(b.Run, RelExecuted, cmd)
+
+	return b
+}
+
+// NewCurrentRunBatch starts a batch attributed to core.Run
+func NewCurrentRunBatch() *Batch {
+	b := NewRunBatch(core.Run.Command, core.Run.Id, core.Run.StartedAt)
+	b.Nodes[1].Props["host"] = core.Run.Host
+	b.Nodes[1].Props["args"] = core.Run.Args
+	return b
+}
+
+func (b *Batch) AddNode(node Node) Ref {
+	b.Nodes = append(b.Nodes, node)
+	return node.Ref
+}
+
+func (b *Batch) Relate(from Ref, relType string, to Ref) {
+	b.Relationships = append(b.Relationships, Relationship{
+		Type: relType,
+		From: from,
+		To:   to,
+	})
+}
+
+// Found adds the node and links it to the batch command run.
+func (b *Batch) Found(node Node) Ref {
+	ref := b.AddNode(node)
+	b.Relationships = append(b.Relationships, Relationship{
+		Type:  RelFound,
+		From:  b.Run,
+		To:    ref,
+		Props: map[string]any{"run_id": b.Run.Key["key"]},
+	})
+	return ref
+}
+
+func (b *Batch) Validate() error {
+	for _, node := range b.Nodes {
+		if err := node.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, rel := range b.Relationships {
+		if !identifierRegex.MatchString(rel.Type) {
+			return fmt.Errorf("invalid relationship type: %q", rel.Type)
+		}
+		if err := rel.From.Validate(); err != nil {
+			return err
+		}
+		if err := rel.To.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seenValues extracts the first_seen and last_seen props which are merged
+// with min/max semantics instead of being overwritten.
+func seenValues(props map[string]any) (rest map[string]any, firstSeen any, lastSeen any) {
+	rest = make(map[string]any, len(props))
+	for name, value := range props {
+		switch name {
+		case "first_seen":
+			firstSeen = value
+		case "last_seen":
+			lastSeen = value
+		default:
+			rest[name] = value
+		}
+	}
+	return rest, firstSeen, lastSeen
+}
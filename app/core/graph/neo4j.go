@@ -0,0 +1,198 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/neo4j"
+	driver "github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+const mergeSeenQuery = `
+SET %[1]s.first_seen = CASE
+    WHEN %[2]s.first_seen IS NULL THEN %[1]s.first_seen
+    WHEN %[1]s.first_seen IS NULL OR %[1]s.first_seen > %[2]s.first_seen
+    THEN %[2]s.first_seen
+    ELSE %[1]s.first_seen
+END
+SET %[1]s.last_seen = CASE
+    WHEN %[2]s.last_seen IS NULL THEN %[1]s.last_seen
+    WHEN %[1]s.last_seen IS NULL OR %[1]s.last_seen < %[2]s.last_seen
+    THEN %[2]s.last_seen
+    ELSE %[1]s.last_seen
+END
+`
+
+type Neo4jBackend struct{}
+
+var wordBoundaryRegex = regexp.MustCompile(`([a-z0-9])([A-Z])|([A-Z])([A-Z][a-z])`)
+
+// constraintQueries makes the key of every label unique, MERGE relies on
+// the index that comes with it and on the constraint to not duplicate
+// nodes written concurrently. Existing equivalent constraints are kept
+func constraintQueries() []string {
+	labels := make([]string, 0, len(KeyProps))
+	for label := range KeyProps {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	queries := make([]string, 0, len(labels))
+	for _, label := range labels {
+		name := strings.ToLower(wordBoundaryRegex.ReplaceAllString(label, "${1}${3}_${2}${4}")) + "_key_unique"
+
+		props := make([]string, len(KeyProps[label]))
+		for i, prop := range KeyProps[label] {
+			props[i] = "n." + prop
+		}
+
+		key := props[0]
+		if len(props) > 1 {
+			key = "(" + strings.Join(props, ", ") + ")"
+		}
+
+		queries = append(queries, fmt.Sprintf(
+			"CREATE CONSTRAINT %s IF NOT EXISTS FOR (n:%s) REQUIRE %s IS UNIQUE",
+			name, label, key,
+		))
+	}
+	return queries
+}
+
+func matchPattern(variable string, ref Ref, param string) string {
+	var fields []string
+	for _, name := range ref.KeyNames() {
+		fields = append(fields, fmt.Sprintf("%s: %s.%s", name, param, name))
+	}
+	return fmt.Sprintf("(%s:%s {%s})", variable, ref.Label, strings.Join(fields, ", "))
+}
+
+func toParams(props map[string]any) map[string]any {
+	rest, firstSeen, lastSeen := seenValues(props)
+	return map[string]any{
+		"props":      rest,
+		"first_seen": firstSeen,
+		"last_seen":  lastSeen,
+	}
+}
+
+func (b *Neo4jBackend) run(ctx context.Context, session driver.SessionWithContext, query string, params map[string]any) error {
+	_, err := session.ExecuteWrite(ctx, func(transaction driver.ManagedTransaction) (any, error) {
+		result, err := transaction.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+		return result.Consume(ctx)
+	})
+	return err
+}
+
+func (b *Neo4jBackend) Write(ctx context.Context, batch *Batch) error {
+	if err := batch.Validate(); err != nil {
+		return err
+	}
+
+	session := neo4j.Driver.NewSession(ctx, driver.SessionConfig{AccessMode: driver.AccessModeWrite})
+	defer core.CtxCloser(ctx, session.Close)()
+
+	// Nodes of one label share the same key shape, so they can be merged with one query
+	var labels []string
+	nodesByLabel := map[string][]map[string]any{}
+	for _, node := range batch.Nodes {
+		if _, ok := nodesByLabel[node.Label]; !ok {
+			labels = append(labels, node.Label)
+		}
+		params := toParams(node.Props)
+		params["key"] = node.Key
+		nodesByLabel[node.Label] = append(nodesByLabel[node.Label], params)
+	}
+
+	for _, label := range labels {
+		ref := Ref{Label: label, Key: map[string]any{}}
+		for _, name := range KeyProps[label] {
+			ref.Key[name] = nil
+		}
+
+		query := fmt.Sprintf("UNWIND $nodes AS n\nMERGE %s\nSET x += n.props\n%s",
+			matchPattern("x", ref, "n.key"),
+			fmt.Sprintf(mergeSeenQuery, "x", "n"),
+		)
+
+		if err := b.run(ctx, session, query, map[string]any{"nodes": nodesByLabel[label]}); err != nil {
+			return fmt.Errorf("failed to merge %s nodes: %w", label, err)
+		}
+	}
+
+	var groups []Relationship
+	relsByGroup := map[string][]map[string]any{}
+	for _, rel := range batch.Relationships {
+		group := rel.From.Label + ":" + rel.Type + ":" + rel.To.Label
+		if _, ok := relsByGroup[group]; !ok {
+			groups = append(groups, rel)
+		}
+		params := toParams(rel.Props)
+		params["from"] = rel.From.Key
+		params["to"] = rel.To.Key
+		relsByGroup[group] = append(relsByGroup[group], params)
+	}
+
+	for _, rel := range groups {
+		group := rel.From.Label + ":" + rel.Type + ":" + rel.To.Label
+		query := fmt.Sprintf("UNWIND $rels AS r\nMATCH %s\nMATCH %s\nMERGE (a)-[e:%s]->(b)\nSET e += r.props\n%s",
+			matchPattern("a", rel.From, "r.from"),
+			matchPattern("b", rel.To, "r.to"),
+			rel.Type,
+			fmt.Sprintf(mergeSeenQuery, "e", "r"),
+		)
+
+		if err := b.run(ctx, session, query, map[string]any{"rels": relsByGroup[group]}); err != nil {
+			return fmt.Errorf("failed to merge %s relationships: %w", group, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *Neo4jBackend) Related(ctx context.Context, ref Ref, relType string) ([]Node, error) {
+	if err := ref.Validate(); err != nil {
+		return nil, err
+	}
+
+	session := neo4j.Driver.NewSession(ctx, driver.SessionConfig{AccessMode: driver.AccessModeRead})
+	defer core.CtxCloser(ctx, session.Close)()
+
+	query := fmt.Sprintf(`
+MATCH %s-[r]-(b)
+WHERE $rel_type = '' OR type(r) = $rel_type
+RETURN DISTINCT labels(b)[0] AS label, properties(b) AS props
+`, matchPattern("a", ref, "$key"))
+
+	res, err := session.ExecuteRead(ctx, func(transaction driver.ManagedTransaction) (any, error) {
+		result, err := transaction.Run(ctx, query, map[string]any{"key": ref.Key, "rel_type": relType})
+		if err != nil {
+			return nil, err
+		}
+
+		var nodes []Node
+		for result.Next(ctx) {
+			record := result.Record()
+			label, _ := record.Get("label")
+			props, _ := record.Get("props")
+
+			labelStr, _ := label.(string)
+			propsMap, _ := props.(map[string]any)
+			nodes = append(nodes, splitProps(labelStr, propsMap))
+		}
+
+		return nodes, result.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query related nodes: %w", err)
+	}
+
+	return res.([]Node), nil
+}
@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mgorunuch/microb/app/core/postgres"
+)
+
+const postgresUpsertNodeQuery = `
+insert into graph_nodes (label, key, key_props, props)
+values ($1, $2, $3::jsonb, $4::jsonb)
+on conflict (label, key) do update set
+	props = graph_nodes.props || excluded.props || jsonb_strip_nulls(jsonb_build_object(
+		'first_seen', least((graph_nodes.props->>'first_seen')::bigint, (excluded.props->>'first_seen')::bigint),
+		'last_seen', greatest((graph_nodes.props->>'last_seen')::bigint, (excluded.props->>'last_seen')::bigint)
+	)),
+	updated_at = current_timestamp
+`
+
+const postgresUpsertRelationshipQuery = `
+insert into graph_relationships (type, from_label, from_key, to_label, to_key, props)
+values ($1, $2, $3, $4, $5, $6::jsonb)
+on conflict (type, from_label, from_key, to_label, to_key) do update set
+	props = graph_relationships.props || excluded.props || jsonb_strip_nulls(jsonb_build_object(
+		'first_seen', least((graph_relationships.props->>'first_seen')::bigint, (excluded.props->>'first_seen')::bigint),
+		'last_seen', greatest((graph_relationships.props->>'last_seen')::bigint, (excluded.props->>'last_seen')::bigint)
+	))
+`
+
+const postgresRelatedQuery = `
+select n.label, n.key_props, n.props
+from graph_relationships r
+join graph_nodes n on n.label = r.to_label and n.key = r.to_key
+where r.from_label = $1 and r.from_key = $2 and ($3 = '' or r.type = $3)
+union
+select n.label, n.key_props, n.props
+from graph_relationships r
+join graph_nodes n on n.label = r.from_label and n.key = r.from_key
+where r.to_label = $1 and r.to_key = $2 and ($3 = '' or r.type = $3)
+`
+
+// PostgresBackend stores the graph model in the graph_nodes and graph_relationships tables.
+type PostgresBackend struct{}
+
+// encodeKey returns a stable text form of the key, json.Marshal sorts map keys.
+func encodeKey(ref Ref) (string, error) {
+	data, err := json.Marshal(ref.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode key: %w", err)
+	}
+	return string(data), nil
+}
+
+func encodeProps(props map[string]any) (string, error) {
+	if props == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode props: %w", err)
+	}
+	return string(data), nil
+}
+
+func (b *PostgresBackend) Write(ctx context.Context, batch *Batch) error {
+	if err := batch.Validate(); err != nil {
+		return err
+	}
+
+	pgBatch := &pgx.Batch{}
+
+	for _, node := range batch.Nodes {
+		key, err := encodeKey(node.Ref)
+		if err != nil {
+			return err
+		}
+		props, err := encodeProps(node.Props)
+		if err != nil {
+			return err
+		}
+		pgBatch.Queue(postgresUpsertNodeQuery, node.Label, key, key, props)
+	}
+
+	for _, rel := range batch.Relationships {
+		fromKey, err := encodeKey(rel.From)
+		if err != nil {
+			return err
+		}
+		toKey, err := encodeKey(rel.To)
+		if err != nil {
+			return err
+		}
+		props, err := encodeProps(rel.Props)
+		if err != nil {
+			return err
+		}
+		pgBatch.Queue(postgresUpsertRelationshipQuery, rel.Type, rel.From.Label, fromKey, rel.To.Label, toKey, props)
+	}
+
+	tx, err := postgres.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, pgBatch).Close(); err != nil {
+		return fmt.Errorf("failed to write graph batch: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit graph batch: %w", err)
+	}
+
+	return nil
+}
+
+func (b *PostgresBackend) Related(ctx context.Context, ref Ref, relType string) ([]Node, error) {
+	if err := ref.Validate(); err != nil {
+		return nil, err
+	}
+
+	key, err := encodeKey(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := postgres.Pool.Query(ctx, postgresRelatedQuery, ref.Label, key, relType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query related nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []Node
+	for rows.Next() {
+		var node Node
+		if err := rows.Scan(&node.Label, &node.Key, &node.Props); err != nil {
+			return nil, fmt.Errorf("failed to scan related node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return nodes, nil
+}
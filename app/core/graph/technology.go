@@ -0,0 +1,50 @@
+package graph
+
+import "time"
+
+// Technology is a technology detected on a host
+type Technology struct {
+	Hostname   string
+	Name       string
+	Version    string
+	Categories []string
+	Confidence int
+	Source     string
+	FirstSeen  time.Time
+	LastSeen   time.Time
+}
+
+// AddTechnologies links the hosts to the technologies the fingerprint
+// engine detected on them, the version and confidence live on the relation.
+func (b *Batch) AddTechnologies(technologies []Technology) {
+	for _, technology := range technologies {
+		firstSeen := technology.FirstSeen.Unix()
+		lastSeen := technology.LastSeen.Unix()
+
+		h := b.Found(Node{
+			Ref: NewRef(LabelHostname, technology.Hostname),
+			Props: map[string]any{
+				"first_seen": firstSeen,
+				"last_seen":  lastSeen,
+			},
+		})
+
+		t := b.AddNode(Node{
+			Ref:   NewRef(LabelTechnology, technology.Name),
+			Props: map[string]any{"categories": technology.Categories},
+		})
+
+		b.Relationships = append(b.Relationships, Relationship{
+			Type: RelRuns,
+			From: h,
+			To:   t,
+			Props: map[string]any{
+				"version":    technology.Version,
+				"confidence": technology.Confidence,
+				"source":     technology.Source,
+				"first_seen": firstSeen,
+				"last_seen":  lastSeen,
+			},
+		})
+	}
+}
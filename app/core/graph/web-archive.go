@@ -0,0 +1,37 @@
+package graph
+
+import (
+	"github.com/mgorunuch/microb/app/core/neo4j"
+)
+
+// AddWebArchiveRecords mirrors neo4j.WebArchiveInsertQuery.
+func (b *Batch) AddWebArchiveRecords(urls []neo4j.WebArchiveURL) {
+	for _, u := range urls {
+		ts := u.Timestamp.Unix()
+
+		w := b.Found(Node{
+			Ref:   NewRef(LabelWebsite, u.Domain),
+			Props: map[string]any{"first_seen": ts, "last_seen": ts},
+		})
+
+		p := b.Found(Node{
+			Ref: Ref{
+				Label: LabelURLPath,
+				Key:   map[string]any{"website": u.Domain, "path": u.Path},
+			},
+			Props: map[string]any{"first_seen": ts, "last_seen": ts},
+		})
+
+		url := b.Found(Node{
+			Ref: NewRef(LabelURL, u.URL),
+			Props: map[string]any{
+				"scheme":     u.Scheme,
+				"first_seen": ts,
+				"last_seen":  ts,
+			},
+		})
+
+		b.Relate(w, RelHasPath, p)
+		b.Relate(p, RelHasURL, url)
+	}
+}
@@ -0,0 +1,176 @@
+// Package har writes HTTP Archive 1.2 files, see
+// http://www.softwareishard.com/blog/har-12-spec/
+package har
+
+import (
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const Version = "1.2"
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Pages   []Page  `json:"pages"`
+	Entries []Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Page struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Id              string      `json:"id"`
+	Title           string      `json:"title"`
+	PageTimings     PageTimings `json:"pageTimings"`
+}
+
+// PageTimings are unknown for recorded visits, -1 in the spec's terms
+type PageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type Entry struct {
+	Pageref         string    `json:"pageref,omitempty"`
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	Url         string      `json:"url"`
+	HttpVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HttpVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings only splits out wait, the recorder doesn't keep the phases
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// New returns an empty archive created by name
+func New(name, version string) *HAR {
+	return &HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: name, Version: version},
+		Pages:   []Page{},
+		Entries: []Entry{},
+	}}
+}
+
+// AddPage adds a page the entries refer to with its id
+func (h *HAR) AddPage(id, title string, startedAt time.Time) {
+	h.Log.Pages = append(h.Log.Pages, Page{
+		StartedDateTime: startedAt,
+		Id:              id,
+		Title:           title,
+		PageTimings:     PageTimings{OnContentLoad: -1, OnLoad: -1},
+	})
+}
+
+// Headers sorts the headers by name, HAR keeps them as a list
+func Headers(headers map[string]string) []NameValue {
+	result := make([]NameValue, 0, len(headers))
+	for name, value := range headers {
+		result = append(result, NameValue{Name: name, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// QueryString lists the query parameters of the url in their order
+func QueryString(rawUrl string) []NameValue {
+	result := []NameValue{}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return result
+	}
+
+	for _, pair := range strings.Split(parsed.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		result = append(result, NameValue{Name: name, Value: value})
+	}
+	return result
+}
+
+// SetBody stores the body as text, binary bodies are base64 encoded
+func (c *Content) SetBody(body []byte) {
+	c.Size = int64(len(body))
+	if utf8.Valid(body) {
+		c.Text = string(body)
+		return
+	}
+	c.Text = base64.StdEncoding.EncodeToString(body)
+	c.Encoding = "base64"
+}
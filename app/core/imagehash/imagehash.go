@@ -0,0 +1,128 @@
+// Package imagehash computes perceptual hashes, images that look alike get
+// hashes a small Hamming distance apart
+package imagehash
+
+import (
+	"image"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// 9 columns give 8 horizontal differences per row
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// Difference returns the dHash of the image: it is shrunk to 9x8 gray
+// cells and every bit tells whether a cell is brighter than its right
+// neighbour. It survives scaling, compression and small color shifts
+func Difference(img image.Image) uint64 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	var sums [hashHeight][hashWidth]uint64
+	var counts [hashHeight][hashWidth]uint64
+
+	for y := 0; y < height; y++ {
+		cellY := y * hashHeight / height
+		for x := 0; x < width; x++ {
+			cellX := x * hashWidth / width
+			sums[cellY][cellX] += luminance(img, bounds.Min.X+x, bounds.Min.Y+y)
+			counts[cellY][cellX]++
+		}
+	}
+
+	var cells [hashHeight][hashWidth]uint64
+	for y := range cells {
+		for x := range cells[y] {
+			// Images narrower than the grid leave cells empty
+			if counts[y][x] > 0 {
+				cells[y][x] = sums[y][x] / counts[y][x]
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func luminance(img image.Image, x, y int) uint64 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000
+}
+
+// Distance is the number of bits the hashes differ in, 0 for identical
+// looking images and around 32 for unrelated ones
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Cluster groups the hashes that are at most maxDistance apart, directly or
+// through other hashes. It returns clusters of indexes into hashes, largest
+// first. Equal hashes are merged before comparing, so pages sharing one
+// template stay cheap however many there are
+func Cluster(hashes []uint64, maxDistance int) [][]int {
+	var unique []uint64
+	members := map[uint64][]int{}
+	for i, hash := range hashes {
+		if _, seen := members[hash]; !seen {
+			unique = append(unique, hash)
+		}
+		members[hash] = append(members[hash], i)
+	}
+
+	parent := make([]int, len(unique))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range unique {
+		for j := i + 1; j < len(unique); j++ {
+			if Distance(unique[i], unique[j]) <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	byRoot := map[int][]int{}
+	var roots []int
+	for i, hash := range unique {
+		root := find(i)
+		if _, seen := byRoot[root]; !seen {
+			roots = append(roots, root)
+		}
+		byRoot[root] = append(byRoot[root], members[hash]...)
+	}
+
+	clusters := make([][]int, 0, len(roots))
+	for _, root := range roots {
+		cluster := byRoot[root]
+		sort.Ints(cluster)
+		clusters = append(clusters, cluster)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i]) > len(clusters[j])
+	})
+	return clusters
+}
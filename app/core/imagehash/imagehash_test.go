@@ -0,0 +1,55 @@
+package imagehash
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	tests := []struct {
+		name        string
+		hashes      []uint64
+		maxDistance int
+		want        [][]int
+	}{
+		{"empty", nil, 4, [][]int{}},
+		{"equal hashes", []uint64{0xff, 0xff, 0xff}, 0, [][]int{{0, 1, 2}}},
+		{"chained within distance", []uint64{0b0000, 0b0001, 0b0011}, 1, [][]int{{0, 1, 2}}},
+		{"apart", []uint64{0, ^uint64(0)}, 10, [][]int{{0}, {1}}},
+		{"largest first", []uint64{^uint64(0), 0, 1, 0}, 1, [][]int{{1, 2, 3}, {0}}},
+		{"separate groups", []uint64{0b000, 0b111, 0b011}, 1, [][]int{{1, 2}, {0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Cluster(tt.hashes, tt.maxDistance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Cluster(%v, %d) = %v, want %v", tt.hashes, tt.maxDistance, got, tt.want)
+			}
+		})
+	}
+}
+
+func gradient(width, height int, scale int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x * scale * 255 / width) % 256)})
+		}
+	}
+	return img
+}
+
+func TestDifferenceSurvivesScaling(t *testing.T) {
+	small := Difference(gradient(90, 80, 3))
+	large := Difference(gradient(900, 800, 3))
+	other := Difference(gradient(90, 80, 1))
+
+	if d := Distance(small, large); d > 4 {
+		t.Errorf("scaled image is %d bits apart", d)
+	}
+	if d := Distance(small, other); d == 0 {
+		t.Error("different images got the same hash")
+	}
+}
@@ -3,9 +3,11 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 )
 
 type Scannable interface {
@@ -33,12 +35,12 @@ func (r *BaseRepository[V]) Create(ctx context.Context, model *V) error {
 		ToSql()
 
 	if err != nil {
-		return fmt.Errorf("failed to build query: %v", err)
+		return fmt.Errorf("failed to build query: %w", err)
 	}
 
-	err = Pool.QueryRow(ctx, query, args...).Scan(vals...)
+	err = DB(ctx).QueryRow(ctx, query, args...).Scan(vals...)
 	if err != nil {
-		return fmt.Errorf("failed to create record: %v", err)
+		return fmt.Errorf("failed to create record: %w", err)
 	}
 
 	return nil
@@ -53,12 +55,12 @@ func (r *BaseRepository[V]) Select(ctx context.Context, buildFn func(builder sq.
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query: %v", err)
+		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
-	err = Pool.QueryRow(ctx, query, args...).Scan(vals...)
+	err = DB(ctx).QueryRow(ctx, query, args...).Scan(vals...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select record: %v", err)
+		return nil, fmt.Errorf("failed to select record: %w", err)
 	}
 
 	return &model, nil
@@ -66,38 +68,94 @@ func (r *BaseRepository[V]) Select(ctx context.Context, buildFn func(builder sq.
 
 func (r *BaseRepository[V]) SelectMultiple(ctx context.Context, buildFn func(builder sq.SelectBuilder) sq.SelectBuilder) ([]V, error) {
 	var models []V
+
+	err := r.Stream(ctx, buildFn, func(model *V) error {
+		models = append(models, *model)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// Stream calls fn for every selected record without loading the result set
+// into memory, an error from fn stops the iteration and is returned
+func (r *BaseRepository[V]) Stream(ctx context.Context, buildFn func(builder sq.SelectBuilder) sq.SelectBuilder, fn func(model *V) error) error {
 	var model V
-	cols, vals := r.ModelConfig.ScanMap(&model)
+	cols, _ := r.ModelConfig.ScanMap(&model)
 
 	builder := psql.Select(cols...).From(r.ModelConfig.Table)
 	builder = buildFn(builder)
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build query: %v", err)
+		return fmt.Errorf("failed to build query: %w", err)
 	}
 
-	rows, err := Pool.Query(ctx, query, args...)
+	rows, err := DB(ctx).Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to select records: %v", err)
+		return fmt.Errorf("failed to select records: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var model V
-		_, vals = r.ModelConfig.ScanMap(&model)
+		_, vals := r.ModelConfig.ScanMap(&model)
 		err = rows.Scan(vals...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan record: %v", err)
+			return fmt.Errorf("failed to scan record: %w", err)
+		}
+
+		if err = fn(&model); err != nil {
+			return err
 		}
-		models = append(models, model)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %v", err)
+		return fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return models, nil
+	return nil
+}
+
+// SelectPage returns up to limit records ordered by the unique column col
+// that come after the key, a nil key returns the first page. Pass the col
+// value of the last record as the key of the next page.
+func (r *BaseRepository[V]) SelectPage(ctx context.Context, col string, after any, limit uint64, buildFn func(builder sq.SelectBuilder) sq.SelectBuilder) ([]V, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		if after != nil {
+			builder = builder.Where(sq.Gt{col: after})
+		}
+		return buildFn(builder).OrderBy(col + " asc").Limit(limit)
+	})
+}
+
+// StreamPages calls fn with consecutive pages of up to limit records ordered
+// by the unique column col, key returns the col value of a record. Unlike
+// Stream no query is held open while fn runs.
+func (r *BaseRepository[V]) StreamPages(ctx context.Context, col string, key func(model *V) any, limit uint64, buildFn func(builder sq.SelectBuilder) sq.SelectBuilder, fn func(page []V) error) error {
+	var after any
+	for {
+		page, err := r.SelectPage(ctx, col, after, limit, buildFn)
+		if err != nil {
+			return err
+		}
+
+		if len(page) == 0 {
+			return nil
+		}
+
+		if err = fn(page); err != nil {
+			return err
+		}
+
+		if uint64(len(page)) < limit {
+			return nil
+		}
+		after = key(&page[len(page)-1])
+	}
 }
 
 func (r *BaseRepository[V]) Update(ctx context.Context, model *V, buildFn func(builder sq.UpdateBuilder) sq.UpdateBuilder) error {
@@ -110,12 +168,12 @@ func (r *BaseRepository[V]) Update(ctx context.Context, model *V, buildFn func(b
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return fmt.Errorf("failed to build query: %v", err)
+		return fmt.Errorf("failed to build query: %w", err)
 	}
 
-	err = Pool.QueryRow(ctx, query, args...).Scan(vals...)
+	err = DB(ctx).QueryRow(ctx, query, args...).Scan(vals...)
 	if err != nil {
-		return fmt.Errorf("failed to update record: %v", err)
+		return fmt.Errorf("failed to update record: %w", err)
 	}
 
 	return nil
@@ -127,13 +185,128 @@ func (r *BaseRepository[V]) Delete(ctx context.Context, buildFn func(builder sq.
 
 	query, args, err := builder.ToSql()
 	if err != nil {
-		return fmt.Errorf("failed to build query: %v", err)
+		return fmt.Errorf("failed to build query: %w", err)
 	}
 
-	_, err = Pool.Exec(ctx, query, args...)
+	_, err = DB(ctx).Exec(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to delete record: %v", err)
+		return fmt.Errorf("failed to delete record: %w", err)
 	}
 
 	return nil
 }
+
+// BulkUpsert copies the models into a temp table and merges them into the
+// table with a single insert ... on conflict. Models with the same conflict
+// columns are merged to the first one. onConflict is the action after
+// "on conflict (...)", an empty one touches existing rows so that they are
+// returned as well, "do nothing" only returns the inserted rows.
+func (r *BaseRepository[V]) BulkUpsert(ctx context.Context, models []V, conflictCols []string, onConflict string) ([]V, error) {
+	if len(models) == 0 {
+		return nil, nil
+	}
+
+	if onConflict == "" {
+		onConflict = fmt.Sprintf("do update set %s = excluded.%s", conflictCols[0], conflictCols[0])
+	}
+
+	copyCols := make([]string, 0, len(r.ModelConfig.Cols))
+	for col := range r.ModelConfig.BuildMap(&models[0]) {
+		copyCols = append(copyCols, col)
+	}
+	sort.Strings(copyCols)
+
+	// Duplicates are dropped here, distinct on in the merge would keep an
+	// arbitrary one of them
+	seen := make(map[string]bool, len(models))
+	rows := make([][]any, 0, len(models))
+	for i := range models {
+		values := r.ModelConfig.BuildMap(&models[i])
+
+		var key strings.Builder
+		for _, col := range conflictCols {
+			fmt.Fprintf(&key, "%v\x00", values[col])
+		}
+		if seen[key.String()] {
+			continue
+		}
+		seen[key.String()] = true
+
+		row := make([]any, len(copyCols))
+		for j, col := range copyCols {
+			row[j] = values[col]
+		}
+		rows = append(rows, row)
+	}
+
+	tx, err := DB(ctx).Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tmpTable := "bulk_" + r.ModelConfig.Table
+	_, err = tx.Exec(ctx, fmt.Sprintf(
+		"create temp table %s (like %s including defaults) on commit drop",
+		tmpTable, r.ModelConfig.Table,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp table: %w", err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{tmpTable}, copyCols, pgx.CopyFromRows(rows))
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy records: %w", err)
+	}
+
+	// Ordering by the conflict columns makes concurrent batches lock rows in
+	// the same order
+	var model V
+	returnCols, _ := r.ModelConfig.ScanMap(&model)
+	query := fmt.Sprintf(
+		`insert into %[1]s (%[2]s)
+		select %[2]s from %[4]s order by %[3]s
+		on conflict (%[3]s) %[5]s
+		returning %[6]s`,
+		r.ModelConfig.Table,
+		strings.Join(copyCols, ", "),
+		strings.Join(conflictCols, ", "),
+		tmpTable,
+		onConflict,
+		strings.Join(returnCols, ", "),
+	)
+
+	result, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert records: %w", err)
+	}
+
+	upserted := make([]V, 0, len(models))
+	for result.Next() {
+		var model V
+		_, vals := r.ModelConfig.ScanMap(&model)
+		if err = result.Scan(vals...); err != nil {
+			result.Close()
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		upserted = append(upserted, model)
+	}
+	result.Close()
+
+	if err = result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to upsert records: %w", err)
+	}
+
+	// Inside WithTx the commit only releases a savepoint, so on commit drop
+	// would keep the table until the outer commit and the next BulkUpsert
+	// on the table in that transaction would fail to create it
+	if _, err = tx.Exec(ctx, "drop table "+tmpTable); err != nil {
+		return nil, fmt.Errorf("failed to drop temp table: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return upserted, nil
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+)
+
+// Batcher buffers items and hands them to the flush function once Size
+// items are buffered or Interval has passed since the last flush. Flushes
+// run one at a time, the first failed interval flush is returned by Close.
+type Batcher[V any] struct {
+	Size     int
+	Interval time.Duration
+	FlushFn  func(ctx context.Context, batch []V) error
+
+	ctx     context.Context
+	mu      sync.Mutex
+	flushMu sync.Mutex
+	items   []V
+	err     error
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewBatcher[V any](ctx context.Context, size int, interval time.Duration, flushFn func(ctx context.Context, batch []V) error) *Batcher[V] {
+	b := &Batcher[V]{
+		Size:     size,
+		Interval: interval,
+		FlushFn:  flushFn,
+		ctx:      ctx,
+		items:    make([]V, 0, size),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go b.tick()
+
+	return b
+}
+
+func (b *Batcher[V]) tick() {
+	defer close(b.done)
+
+	if b.Interval <= 0 {
+		<-b.stop
+		return
+	}
+
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				core.Logger.Errorf("Failed to flush batch: %v", err)
+
+				b.mu.Lock()
+				if b.err == nil {
+					b.err = err
+				}
+				b.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Add buffers the item and flushes when the batch is full
+func (b *Batcher[V]) Add(item V) error {
+	b.mu.Lock()
+	b.items = append(b.items, item)
+	full := len(b.items) >= b.Size
+	b.mu.Unlock()
+
+	if full {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush hands the buffered items to the flush function
+func (b *Batcher[V]) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.items
+	b.items = make([]V, 0, b.Size)
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return b.FlushFn(b.ctx, batch)
+}
+
+// Close stops the interval flushes and flushes what is left, it fails when
+// any batch was lost
+func (b *Batcher[V]) Close() error {
+	close(b.stop)
+	<-b.done
+
+	err := b.Flush()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return errors.Join(b.err, err)
+}
@@ -32,9 +32,16 @@ func POSTGRES_PASSWORD() string {
 	return core.Env.Get("POSTGRES_PASSWORD", true)
 }
 
+// POSTGRES_AUTO_MIGRATE controls whether Init applies pending migrations,
+// set it to false to only run them with the migrate command
+func POSTGRES_AUTO_MIGRATE() bool {
+	return core.Env.GetDefault("POSTGRES_AUTO_MIGRATE", "true") != "false"
+}
+
 var Pool *pgxpool.Pool
 
-func Init(ctx context.Context) func() error {
+// Connect opens the pool without touching the schema or recording the run
+func Connect(ctx context.Context) func() error {
 	connString := fmt.Sprintf(
 		"postgres://%s:%s@%s:%s/%s",
 		POSTGRES_USER(),
@@ -59,13 +66,60 @@ func Init(ctx context.Context) func() error {
 		core.Logger.Fatalf("Unable to connect to database: %v\n", err)
 	}
 
+	return func() error {
+		Pool.Close()
+		return nil
+	}
+}
+
+func Init(ctx context.Context) func() error {
+	return initPool(ctx, POSTGRES_AUTO_MIGRATE())
+}
+
+func initPool(ctx context.Context, migrate bool) func() error {
+	closePool := Connect(ctx)
+
 	// Run migrations
-	if err := Migrate(ctx); err != nil {
-		core.Logger.Fatalf("Failed to run migrations: %v\n", err)
+	if migrate {
+		if err := Migrate(ctx); err != nil {
+			core.Logger.Fatalf("Failed to run migrations: %v\n", err)
+		}
+	} else {
+		warnPendingMigrations(ctx)
 	}
 
+	startCurrentRun(ctx)
+	loadIgnoredHostnamesScope(ctx)
+
 	return func() error {
-		Pool.Close()
-		return nil
+		finishCurrentRun(ctx)
+		return closePool()
+	}
+}
+
+func warnPendingMigrations(ctx context.Context) {
+	statuses, err := MigrationStatuses(ctx)
+	if err != nil {
+		core.Logger.Errorf("Failed to check migrations: %v", err)
+		return
+	}
+
+	if err := CheckDrift(statuses); err != nil {
+		core.Logger.Warn(err)
+	}
+
+	if pending := PendingMigrations(statuses); pending > 0 {
+		core.Logger.Warnf("%d migrations are pending, apply them with bin/migrate up", pending)
+	}
+}
+
+// InitIfConfigured connects only when a postgres password is configured,
+// so commands that don't need the database keep working without it. The
+// database is optional for these commands, so pending migrations are only
+// reported and never applied.
+func InitIfConfigured(ctx context.Context) func() error {
+	if core.Env.Get("POSTGRES_PASSWORD", false) == "" {
+		return func() error { return nil }
 	}
+	return initPool(ctx, false)
 }
@@ -2,38 +2,107 @@ package postgres
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/mgorunuch/microb/app/core"
 )
 
-var migrations = [][2]string{
+var ErrMigrationDrift = errors.New("applied migrations were changed since they ran")
+
+// Migration is a schema change, the version is its index in migrations.
+// Down is optional and makes the migration reversible. UpFunc and DownFunc
+// run after Up and Down in the same transaction for data changes that need
+// Go, use DB(ctx) in them.
+type Migration struct {
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(ctx context.Context) error
+	DownFunc func(ctx context.Context) error
+}
+
+// Checksum identifies the up SQL of the migration, UpFunc is not covered
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+type MigrationStatus struct {
+	Migration
+	Version        int
+	Applied        bool
+	AppliedAt      *time.Time
+	StoredChecksum string
+	// Drift is set when the up SQL changed after the migration was applied
+	Drift bool
+	// Unknown is set for applied versions missing from this build
+	Unknown bool
+}
+
+type MigrationStep struct {
+	Migration
+	Version  int
+	Rollback bool
+}
+
+func (s MigrationStep) SQL() string {
+	if s.Rollback {
+		return s.Down
+	}
+	return s.Up
+}
+
+func (s MigrationStep) Func() func(ctx context.Context) error {
+	if s.Rollback {
+		return s.DownFunc
+	}
+	return s.UpFunc
+}
+
+// migrationsTableColumns upgrades schema_migrations tables created before
+// names and checksums were recorded
+const migrationsTableColumns = `alter table schema_migrations
+	add column if not exists name text,
+	add column if not exists checksum text`
+
+var migrations = []Migration{
 	{
-		"Create schema_migrations table",
-		`create table if not exists schema_migrations (
+		Name: "Create schema_migrations table",
+		Up: `create table if not exists schema_migrations (
 			version integer primary key,
 			applied_at timestamp with time zone default current_timestamp
 		)`,
 	},
 	{
-		"Create domains table",
-		`create table if not exists domains (
+		Name: "Create domains table",
+		Up: `create table if not exists domains (
 			id serial primary key,
 			domain text not null,
 			reason text,
 			created_at timestamp with time zone default current_timestamp,
 			constraint domains_domain_unique unique (domain)
 		)`,
+		Down: `drop table if exists domains`,
 	},
 	{
-		"Update domains table to use text array for reasons",
-		`alter table domains
+		Name: "Update domains table to use text array for reasons",
+		Up: `alter table domains
 			drop column if exists reason,
 			add column if not exists reasons text[] default array[]::text[]`,
+		Down: `alter table domains
+			drop column if exists reasons,
+			add column if not exists reason text`,
 	},
 	{
-		"Create chrome_visits table",
-		`create table if not exists chrome_visits (
+		Name: "Create chrome_visits table",
+		Up: `create table if not exists chrome_visits (
 			id uuid primary key default gen_random_uuid(),
 			url text not null,
 			title text,
@@ -43,10 +112,11 @@ var migrations = [][2]string{
 			error_msg text,
 			reason text not null
 		)`,
+		Down: `drop table if exists chrome_visits`,
 	},
 	{
-		"Create urls table",
-		`create table if not exists urls (
+		Name: "Create urls table",
+		Up: `create table if not exists urls (
 			id uuid primary key default gen_random_uuid(),
 			raw text not null,
 			flags text[] default array[]::text[],
@@ -58,10 +128,11 @@ var migrations = [][2]string{
 			created_at timestamp with time zone default current_timestamp,
 			constraint urls_unique unique (hostname, path, scheme, query, fragment)
 		)`,
+		Down: `drop table if exists urls`,
 	},
 	{
-		"Add url_id to chrome_visits and migrate data",
-		`
+		Name: "Add url_id to chrome_visits and migrate data",
+		Up: `
 		-- Add url_id column
 		alter table chrome_visits
 		add column if not exists url_id uuid references urls(id);
@@ -103,20 +174,34 @@ var migrations = [][2]string{
 		alter table chrome_visits
 		drop column url;
 		`,
+		Down: `
+		alter table chrome_visits
+		add column if not exists url text;
+
+		update chrome_visits cv
+		set url = u.raw
+		from urls u
+		where cv.url_id = u.id;
+
+		alter table chrome_visits
+		alter column url set not null,
+		drop column url_id;
+		`,
 	},
 	{
-		"Create ignored_hostnames table",
-		`create table if not exists ignored_hostnames (
+		Name: "Create ignored_hostnames table",
+		Up: `create table if not exists ignored_hostnames (
 			id serial primary key,
 			hostname text not null,
 			reason text,
 			created_at timestamp with time zone default current_timestamp,
 			constraint ignored_hostnames_hostname_unique unique (hostname)
 		)`,
+		Down: `drop table if exists ignored_hostnames`,
 	},
 	{
-		"Convert to many-to-many relationship between urls and chrome_visits",
-		`
+		Name: "Convert to many-to-many relationship between urls and chrome_visits",
+		Up: `
 		-- Create the junction table
 		create table if not exists url_visits (
 			url_id uuid references urls(id),
@@ -131,60 +216,738 @@ var migrations = [][2]string{
 
 		-- Keep the url_id column in chrome_visits for the primary URL
 		`,
+		Down: `drop table if exists url_visits`,
+	},
+	{
+		Name: "Drop domains table",
+		Up:   `drop table if exists domains cascade;`,
+		Down: `create table if not exists domains (
+			id serial primary key,
+			domain text not null,
+			reasons text[] default array[]::text[],
+			created_at timestamp with time zone default current_timestamp,
+			constraint domains_domain_unique unique (domain)
+		)`,
+	},
+	{
+		Name: "Create graph_nodes and graph_relationships tables",
+		Up: `
+		create table if not exists graph_nodes (
+			label text not null,
+			key text not null,
+			key_props jsonb not null,
+			props jsonb not null default '{}'::jsonb,
+			created_at timestamp with time zone default current_timestamp,
+			updated_at timestamp with time zone default current_timestamp,
+			primary key (label, key)
+		);
+
+		create table if not exists graph_relationships (
+			type text not null,
+			from_label text not null,
+			from_key text not null,
+			to_label text not null,
+			to_key text not null,
+			props jsonb not null default '{}'::jsonb,
+			created_at timestamp with time zone default current_timestamp,
+			primary key (type, from_label, from_key, to_label, to_key),
+			foreign key (from_label, from_key) references graph_nodes(label, key) on delete cascade,
+			foreign key (to_label, to_key) references graph_nodes(label, key) on delete cascade
+		);
+
+		create index if not exists graph_relationships_from_idx on graph_relationships (from_label, from_key);
+		create index if not exists graph_relationships_to_idx on graph_relationships (to_label, to_key);
+		`,
+		Down: `
+		drop table if exists graph_relationships;
+		drop table if exists graph_nodes;
+		`,
+	},
+	{
+		Name: "Create command_runs table and reference runs from visits",
+		Up: `
+		create table if not exists command_runs (
+			id uuid primary key,
+			command text not null,
+			args text[] default array[]::text[],
+			host text,
+			started_at timestamp with time zone not null,
+			ended_at timestamp with time zone,
+			input_count bigint not null default 0,
+			success_count bigint not null default 0,
+			failure_count bigint not null default 0,
+			created_at timestamp with time zone default current_timestamp
+		);
+
+		alter table chrome_visits
+		add column if not exists run_id uuid references command_runs(id) on delete set null;
+
+		alter table url_visits
+		add column if not exists run_id uuid references command_runs(id) on delete set null;
+		`,
+		Down: `
+		alter table url_visits drop column if exists run_id;
+		alter table chrome_visits drop column if exists run_id;
+		drop table if exists command_runs;
+		`,
+	},
+	{
+		Name: "Create watchlist table",
+		Up: `create table if not exists watchlist (
+			id serial primary key,
+			domain text not null,
+			engines text[] default array[]::text[],
+			enabled boolean not null default true,
+			created_at timestamp with time zone default current_timestamp,
+			constraint watchlist_domain_unique unique (domain)
+		)`,
+		Down: `drop table if exists watchlist`,
+	},
+	{
+		Name: "Create cache_entries table",
+		Up: `
+		create table if not exists cache_entries (
+			id bigserial primary key,
+			service text not null,
+			key text not null,
+			data jsonb not null,
+			run_id text,
+			created_at timestamp with time zone default current_timestamp
+		);
+
+		create index if not exists cache_entries_lookup_idx on cache_entries (service, key, created_at desc);
+		`,
+		Down: `drop table if exists cache_entries`,
+	},
+	{
+		Name: "Record status and failures of cache entries",
+		Up: `
+		alter table cache_entries
+			alter column data drop not null,
+			add column if not exists status text not null default 'ok',
+			add column if not exists http_status integer,
+			add column if not exists error_class text,
+			add column if not exists error text,
+			add column if not exists attempts integer not null default 0;
+		`,
+		Down: `
+		delete from cache_entries where data is null;
+
+		alter table cache_entries
+			alter column data set not null,
+			drop column if exists status,
+			drop column if exists http_status,
+			drop column if exists error_class,
+			drop column if exists error,
+			drop column if exists attempts;
+		`,
+	},
+	{
+		Name: "Create hosts table",
+		Up: `
+		create table if not exists hosts (
+			id serial primary key,
+			hostname text not null,
+			registrable_domain text not null,
+			reasons text[] not null default array[]::text[],
+			first_seen timestamp with time zone not null default current_timestamp,
+			last_seen timestamp with time zone not null default current_timestamp,
+			resolved boolean,
+			alive boolean,
+			checked_at timestamp with time zone,
+			created_at timestamp with time zone default current_timestamp,
+			constraint hosts_hostname_unique unique (hostname)
+		);
+
+		create index if not exists hosts_registrable_domain_idx on hosts (registrable_domain);
+		create index if not exists hosts_first_seen_idx on hosts (first_seen);
+		create index if not exists hosts_reasons_idx on hosts using gin (reasons);
+		`,
+		Down: `drop table if exists hosts`,
+	},
+	{
+		Name: "Add canonical form to urls",
+		Up: `
+		alter table urls
+			drop constraint if exists urls_unique,
+			add column if not exists canonical text,
+			add column if not exists port text not null default '';
+		`,
+		Down: `
+		alter table urls
+			drop column if exists canonical,
+			drop column if exists port,
+			add constraint urls_unique unique (hostname, path, scheme, query, fragment);
+		`,
+		UpFunc: canonicalizeUrls,
 	},
 	{
-		"Drop domains table",
-		`drop table if exists domains cascade;`,
+		Name: "Merge urls with the same canonical form",
+		Up: `
+		create temp table url_merges on commit drop as
+		select id, first_value(id) over (partition by canonical order by created_at, id) as keep_id
+		from urls;
+
+		delete from url_merges where id = keep_id;
+
+		insert into url_visits (url_id, visit_id, run_id, created_at)
+		select m.keep_id, uv.visit_id, uv.run_id, uv.created_at
+		from url_visits uv
+		join url_merges m on m.id = uv.url_id
+		on conflict (url_id, visit_id) do nothing;
+
+		delete from url_visits uv using url_merges m where uv.url_id = m.id;
+
+		update chrome_visits cv set url_id = m.keep_id from url_merges m where cv.url_id = m.id;
+
+		delete from urls u using url_merges m where u.id = m.id;
+
+		alter table urls
+			alter column canonical set not null,
+			add constraint urls_canonical_unique unique (canonical);
+		`,
+		// Merged rows are not split again
+		Down: `
+		alter table urls
+			drop constraint if exists urls_canonical_unique,
+			alter column canonical drop not null;
+		`,
+	},
+	{
+		Name: "Create endpoints and endpoint_params tables",
+		Up: `
+		create table if not exists endpoints (
+			id serial primary key,
+			hostname text not null,
+			port text not null default '',
+			path_template text not null,
+			url_count integer not null default 0,
+			first_seen timestamp with time zone not null default current_timestamp,
+			last_seen timestamp with time zone not null default current_timestamp,
+			constraint endpoints_unique unique (hostname, port, path_template)
+		);
+
+		create table if not exists endpoint_params (
+			endpoint_id integer not null references endpoints(id) on delete cascade,
+			name text not null,
+			examples text[] not null default array[]::text[],
+			url_count integer not null default 0,
+			primary key (endpoint_id, name)
+		);
+
+		create index if not exists endpoint_params_name_idx on endpoint_params (name);
+
+		alter table urls
+		add column if not exists endpoint_id integer references endpoints(id) on delete set null;
+
+		create index if not exists urls_endpoint_id_idx on urls (endpoint_id);
+		create index if not exists urls_unindexed_idx on urls (id) where endpoint_id is null;
+		`,
+		Down: `
+		alter table urls drop column if exists endpoint_id;
+		drop table if exists endpoint_params;
+		drop table if exists endpoints;
+		`,
+	},
+	{
+		Name: "Index url flags",
+		Up: `
+		update urls set flags = array[]::text[] where flags is null;
+
+		alter table urls
+			alter column flags set not null;
+
+		create index if not exists urls_flags_idx on urls using gin (flags);
+		`,
+		Down: `
+		drop index if exists urls_flags_idx;
+
+		alter table urls
+			alter column flags drop not null;
+		`,
+	},
+	{
+		Name: "Add full-text search over chrome_visits",
+		// Generated columns can't reference each other, so search_vector
+		// repeats the visible_text expression. The first quantifier of the
+		// script pattern is non-greedy, which makes the whole regex non-greedy.
+		Up: `
+		create extension if not exists pg_trgm;
+
+		alter table chrome_visits
+		add column if not exists visible_text text generated always as (
+			btrim(regexp_replace(regexp_replace(regexp_replace(regexp_replace(coalesce(html, ''),
+				'<(script|style|noscript|template|svg).*?</(script|style|noscript|template|svg)>', ' ', 'gi'),
+				'<[^>]*>', ' ', 'g'),
+				'&(#[0-9]+|#x[0-9a-f]+|[a-z]+);', ' ', 'gi'),
+				'\s+', ' ', 'g'))
+		) stored;
+
+		alter table chrome_visits
+		add column if not exists search_vector tsvector generated always as (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', left(
+				regexp_replace(regexp_replace(regexp_replace(regexp_replace(coalesce(html, ''),
+					'<(script|style|noscript|template|svg).*?</(script|style|noscript|template|svg)>', ' ', 'gi'),
+					'<[^>]*>', ' ', 'g'),
+					'&(#[0-9]+|#x[0-9a-f]+|[a-z]+);', ' ', 'gi'),
+					'\s+', ' ', 'g'),
+				500000)), 'B')
+		) stored;
+
+		create index if not exists chrome_visits_search_vector_idx on chrome_visits using gin (search_vector);
+		create index if not exists chrome_visits_html_trgm_idx on chrome_visits using gin (html gin_trgm_ops);
+		`,
+		Down: `
+		drop index if exists chrome_visits_html_trgm_idx;
+		drop index if exists chrome_visits_search_vector_idx;
+
+		alter table chrome_visits
+			drop column if exists search_vector,
+			drop column if exists visible_text;
+		`,
+	},
+	{
+		Name: "Move visit HTML into content addressed blobs",
+		Up: `
+		create table if not exists blobs (
+			hash text primary key,
+			size bigint not null,
+			data bytea not null,
+			created_at timestamp with time zone default current_timestamp
+		);
+
+		alter table chrome_visits
+		add column if not exists html_hash text;
+
+		create index if not exists chrome_visits_html_hash_idx on chrome_visits (html_hash);
+		`,
+		Down: `
+		alter table chrome_visits drop column if exists html_hash;
+		drop table if exists blobs;
+		`,
+		UpFunc: moveVisitHtmlToBlobs,
+	},
+	{
+		Name: "Drop inline visit HTML",
+		// visible_text is written by the application from now on. Down brings
+		// back the html column and the generated columns computed from it, and
+		// DownFunc refills html from the blob store.
+		Up: `
+		drop index if exists chrome_visits_html_trgm_idx;
+		drop index if exists chrome_visits_search_vector_idx;
+
+		alter table chrome_visits
+			drop column if exists search_vector;
+
+		alter table chrome_visits
+			alter column visible_text drop expression;
+
+		alter table chrome_visits
+		add column search_vector tsvector generated always as (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', left(coalesce(visible_text, ''), 500000)), 'B')
+		) stored;
+
+		create index if not exists chrome_visits_search_vector_idx on chrome_visits using gin (search_vector);
+
+		alter table chrome_visits
+			drop column if exists html;
+		`,
+		Down: `
+		drop index if exists chrome_visits_search_vector_idx;
+
+		alter table chrome_visits
+			drop column if exists search_vector,
+			drop column if exists visible_text;
+
+		alter table chrome_visits
+			add column if not exists html text;
+
+		alter table chrome_visits
+		add column visible_text text generated always as (
+			btrim(regexp_replace(regexp_replace(regexp_replace(regexp_replace(coalesce(html, ''),
+				'<(script|style|noscript|template|svg).*?</(script|style|noscript|template|svg)>', ' ', 'gi'),
+				'<[^>]*>', ' ', 'g'),
+				'&(#[0-9]+|#x[0-9a-f]+|[a-z]+);', ' ', 'gi'),
+				'\s+', ' ', 'g'))
+		) stored;
+
+		alter table chrome_visits
+		add column search_vector tsvector generated always as (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', left(
+				regexp_replace(regexp_replace(regexp_replace(regexp_replace(coalesce(html, ''),
+					'<(script|style|noscript|template|svg).*?</(script|style|noscript|template|svg)>', ' ', 'gi'),
+					'<[^>]*>', ' ', 'g'),
+					'&(#[0-9]+|#x[0-9a-f]+|[a-z]+);', ' ', 'gi'),
+					'\s+', ' ', 'g'),
+				500000)), 'B')
+		) stored;
+
+		create index if not exists chrome_visits_search_vector_idx on chrome_visits using gin (search_vector);
+		create index if not exists chrome_visits_html_trgm_idx on chrome_visits using gin (html gin_trgm_ops);
+		`,
+		DownFunc: restoreVisitHtmlFromBlobs,
+	},
+	{
+		Name: "Add final URL and status to chrome_visits",
+		Up: `
+		alter table chrome_visits
+			add column if not exists final_url text,
+			add column if not exists status_code integer;
+		`,
+		Down: `
+		alter table chrome_visits
+			drop column if exists final_url,
+			drop column if exists status_code;
+		`,
+	},
+	{
+		Name: "Create visit_requests table",
+		Up: `
+		create table if not exists visit_requests (
+			id bigserial primary key,
+			visit_id uuid not null references chrome_visits(id) on delete cascade,
+			seq integer not null,
+			url_id uuid references urls(id),
+			url text not null,
+			method text not null,
+			resource_type text not null default '',
+			request_headers jsonb not null default '{}'::jsonb,
+			post_data text not null default '',
+			status integer not null default 0,
+			status_text text not null default '',
+			protocol text not null default '',
+			response_headers jsonb not null default '{}'::jsonb,
+			mime_type text not null default '',
+			remote_ip text not null default '',
+			redirect_url text not null default '',
+			encoded_size bigint not null default 0,
+			body_hash text,
+			error_text text not null default '',
+			started_at timestamp with time zone not null,
+			duration_ms double precision not null default 0,
+			created_at timestamp with time zone default current_timestamp,
+			unique (visit_id, seq)
+		);
+
+		create index if not exists visit_requests_url_id_idx on visit_requests (url_id);
+		`,
+		Down: `drop table if exists visit_requests`,
+	},
+	{
+		Name: "Create visit_screenshots table",
+		Up: `
+		create table if not exists visit_screenshots (
+			visit_id uuid not null references chrome_visits(id) on delete cascade,
+			kind text not null,
+			path text not null,
+			width integer not null,
+			height integer not null,
+			phash bigint not null,
+			created_at timestamp with time zone default current_timestamp,
+			primary key (visit_id, kind)
+		);
+
+		create index if not exists visit_screenshots_kind_phash_idx on visit_screenshots (kind, phash);
+		`,
+		Down: `drop table if exists visit_screenshots`,
+	},
+	{
+		Name: "Create technologies table",
+		Up: `
+		create table if not exists technologies (
+			id bigserial primary key,
+			hostname text not null,
+			name text not null,
+			version text not null default '',
+			categories text[] not null default array[]::text[],
+			confidence integer not null,
+			source text not null,
+			visit_id uuid references chrome_visits(id) on delete set null,
+			url text not null,
+			evidence text[] not null default array[]::text[],
+			first_seen timestamp with time zone not null default current_timestamp,
+			last_seen timestamp with time zone not null default current_timestamp,
+			constraint technologies_hostname_name_version_unique unique (hostname, name, version)
+		);
+
+		create index if not exists technologies_name_idx on technologies (name);
+		create index if not exists technologies_categories_idx on technologies using gin (categories);
+		`,
+		Down: `drop table if exists technologies`,
+	},
+	{
+		Name: "Make technologies unique per host and name",
+		Up: `
+		delete from technologies t
+		using technologies keep
+		where keep.hostname = t.hostname and keep.name = t.name and keep.id <> t.id
+			and (keep.version <> '', keep.last_seen, keep.id) > (t.version <> '', t.last_seen, t.id);
+
+		alter table technologies
+			drop constraint if exists technologies_hostname_name_version_unique,
+			add constraint technologies_hostname_name_unique unique (hostname, name);
+		`,
+		Down: `
+		alter table technologies
+			drop constraint if exists technologies_hostname_name_unique,
+			add constraint technologies_hostname_name_version_unique unique (hostname, name, version);
+		`,
+	},
+	{
+		Name: "Store visit request post data as bytes",
+		// Uploads, protobuf and gRPC-web bodies are not valid text
+		Up: `
+		alter table visit_requests
+			alter column post_data drop default,
+			alter column post_data type bytea using convert_to(post_data, 'UTF8'),
+			alter column post_data set default ''::bytea;
+		`,
+		Down: `
+		alter table visit_requests
+			alter column post_data drop default,
+			alter column post_data type text using convert_from(post_data, 'UTF8'),
+			alter column post_data set default '';
+		`,
 	},
 }
 
+// Migrate applies every pending migration, it refuses to run when an
+// applied migration was edited since
 func Migrate(ctx context.Context) error {
-	// Create migrations table if it doesn't exist
-	if err := Pool.QueryRow(ctx, migrations[0][1]).Scan(); err != nil {
-		// Ignore error as it's expected when creating table
-		core.Logger.Debug("Created schema_migrations table")
+	if err := PrepareMigrationsTable(ctx); err != nil {
+		return err
 	}
 
-	// Get the current migration version
-	var currentVersion int
-	err := Pool.QueryRow(ctx, "select coalesce(max(version), 0) from schema_migrations").Scan(&currentVersion)
+	statuses, err := MigrationStatuses(ctx)
 	if err != nil {
-		return fmt.Errorf("error getting current migration version: %w", err)
+		return err
 	}
 
-	// Apply any new migrations
+	if err := CheckDrift(statuses); err != nil {
+		return err
+	}
+
+	return ApplyMigrations(ctx, PlanUp(statuses, 0))
+}
+
+// MigrationStatuses lists every known migration with its applied state. It
+// only reads, run PrepareMigrationsTable first to upgrade schema_migrations
+func MigrationStatuses(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations)-1)
 	for version, migration := range migrations[1:] {
-		migrationVersion := version + 1
-		if migrationVersion <= currentVersion {
+		status := applied[version+1]
+		status.Version = version + 1
+		status.Migration = migration
+		status.Drift = status.Applied && status.StoredChecksum != "" && status.StoredChecksum != migration.Checksum()
+		statuses = append(statuses, status)
+		delete(applied, version+1)
+	}
+
+	// Versions recorded by a newer build of the code
+	for _, status := range applied {
+		status.Unknown = true
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// appliedMigrations reads schema_migrations by version. A missing table has
+// no applied migrations and one created before checksums has none stored
+func appliedMigrations(ctx context.Context) (map[int]MigrationStatus, error) {
+	var hasTable, hasChecksum bool
+	err := Pool.QueryRow(ctx, `
+		select to_regclass('schema_migrations') is not null, exists (
+			select 1 from information_schema.columns
+			where table_schema = current_schema() and table_name = 'schema_migrations' and column_name = 'checksum'
+		)
+	`).Scan(&hasTable, &hasChecksum)
+	if err != nil {
+		return nil, fmt.Errorf("error checking schema_migrations table: %w", err)
+	}
+
+	applied := make(map[int]MigrationStatus)
+	if !hasTable {
+		return applied, nil
+	}
+
+	query := "select version, applied_at, coalesce(checksum, '') from schema_migrations"
+	if !hasChecksum {
+		query = "select version, applied_at, '' from schema_migrations"
+	}
+
+	rows, err := Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error getting applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &appliedAt, &status.StoredChecksum); err != nil {
+			return nil, fmt.Errorf("error scanning applied migration: %w", err)
+		}
+		status.Applied = true
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting applied migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// CheckDrift fails when an applied migration no longer matches its checksum
+func CheckDrift(statuses []MigrationStatus) error {
+	var drifted []string
+	for _, status := range statuses {
+		if status.Drift {
+			drifted = append(drifted, fmt.Sprintf("%d (%s)", status.Version, status.Name))
+		}
+	}
+
+	if len(drifted) > 0 {
+		return fmt.Errorf("%w: %s", ErrMigrationDrift, strings.Join(drifted, ", "))
+	}
+
+	return nil
+}
+
+// PendingMigrations counts the migrations that are not applied yet
+func PendingMigrations(statuses []MigrationStatus) int {
+	return len(PlanUp(statuses, 0))
+}
+
+// PlanUp returns the pending migrations up to and including version to,
+// zero plans every pending migration
+func PlanUp(statuses []MigrationStatus, to int) []MigrationStep {
+	var steps []MigrationStep
+	for _, status := range statuses {
+		if status.Applied || status.Unknown || (to > 0 && status.Version > to) {
 			continue
 		}
+		steps = append(steps, MigrationStep{Version: status.Version, Migration: status.Migration})
+	}
+	return steps
+}
 
-		core.Logger.Info("Applying migration", "version", migrationVersion, "name", migration[0])
+// PlanDown returns the steps rolling back the latest n applied migrations,
+// newest first. It fails when one of them has no down SQL.
+func PlanDown(statuses []MigrationStatus, n int) ([]MigrationStep, error) {
+	var steps []MigrationStep
+	for i := len(statuses) - 1; i >= 0 && len(steps) < n; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
 
-		// Start transaction for each migration
-		tx, err := Pool.Begin(ctx)
-		if err != nil {
-			return fmt.Errorf("error starting transaction: %w", err)
+		if status.Unknown {
+			return nil, fmt.Errorf("migration %d is unknown to this build and can't be rolled back", status.Version)
 		}
 
-		// Execute migration
-		if _, err := tx.Exec(ctx, migration[1]); err != nil {
-			tx.Rollback(ctx)
-			return fmt.Errorf("error executing migration %d (%s): %w", migrationVersion, migration[0], err)
+		if status.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) is not reversible", status.Version, status.Name)
 		}
 
-		// Record migration
-		if _, err := tx.Exec(ctx, "insert into schema_migrations (version) values ($1)", migrationVersion); err != nil {
-			tx.Rollback(ctx)
-			return fmt.Errorf("error recording migration %d (%s): %w", migrationVersion, migration[0], err)
+		steps = append(steps, MigrationStep{Version: status.Version, Migration: status.Migration, Rollback: true})
+	}
+	return steps, nil
+}
+
+// ApplyMigrations runs each step in its own transaction together with the
+// change to schema_migrations
+func ApplyMigrations(ctx context.Context, steps []MigrationStep) error {
+	for _, step := range steps {
+		action := "Applying"
+		if step.Rollback {
+			action = "Rolling back"
 		}
+		core.Logger.Infof("%s migration %d: %s", action, step.Version, step.Name)
 
-		// Commit transaction
-		if err := tx.Commit(ctx); err != nil {
-			return fmt.Errorf("error committing migration %d (%s): %w", migrationVersion, migration[0], err)
+		err := WithTx(ctx, func(ctx context.Context) error {
+			if _, err := DB(ctx).Exec(ctx, step.SQL()); err != nil {
+				return fmt.Errorf("error executing migration %d (%s): %w", step.Version, step.Name, err)
+			}
+
+			if fn := step.Func(); fn != nil {
+				if err := fn(ctx); err != nil {
+					return fmt.Errorf("error executing migration %d (%s): %w", step.Version, step.Name, err)
+				}
+			}
+
+			var err error
+			if step.Rollback {
+				_, err = DB(ctx).Exec(ctx, "delete from schema_migrations where version = $1", step.Version)
+			} else {
+				_, err = DB(ctx).Exec(ctx,
+					"insert into schema_migrations (version, name, checksum) values ($1, $2, $3)",
+					step.Version, step.Name, step.Checksum(),
+				)
+			}
+			if err != nil {
+				return fmt.Errorf("error recording migration %d (%s): %w", step.Version, step.Name, err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
-		core.Logger.Info("Successfully applied migration", "version", migrationVersion, "name", migration[0])
+		core.Logger.Infof("Successfully %s migration %d: %s", strings.ToLower(action), step.Version, step.Name)
+	}
+	return nil
+}
+
+// PrepareMigrationsTable creates schema_migrations and records the checksums
+// of migrations applied before checksums were stored, run it before
+// applying migrations
+func PrepareMigrationsTable(ctx context.Context) error {
+	if _, err := Pool.Exec(ctx, migrations[0].Up); err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
 	}
+
+	if _, err := Pool.Exec(ctx, migrationsTableColumns); err != nil {
+		return fmt.Errorf("error updating schema_migrations table: %w", err)
+	}
+
+	rows, err := Pool.Query(ctx, "select version from schema_migrations where checksum is null")
+	if err != nil {
+		return fmt.Errorf("error getting migrations without checksum: %w", err)
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("error getting migrations without checksum: %w", err)
+	}
+
+	for _, version := range versions {
+		if version < 1 || version >= len(migrations) {
+			continue
+		}
+
+		migration := migrations[version]
+		_, err := Pool.Exec(ctx,
+			"update schema_migrations set name = $2, checksum = $3 where version = $1",
+			version, migration.Name, migration.Checksum(),
+		)
+		if err != nil {
+			return fmt.Errorf("error recording checksum of migration %d: %w", version, err)
+		}
+		core.Logger.Debugf("Recorded checksum of migration %d", version)
+	}
+
 	return nil
 }
@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// BlobModel is zstd compressed content addressed by the SHA-256 of the
+// uncompressed bytes, Size is the uncompressed size
+type BlobModel struct {
+	Hash      string
+	Size      int64
+	Data      []byte
+	CreatedAt time.Time
+}
+
+func (m *BlobModel) Create(ctx context.Context) error {
+	return BlobRepo.Create(ctx, m)
+}
+
+func (m *BlobModel) Delete(ctx context.Context) error {
+	return BlobRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("hash = ?", m.Hash)
+	})
+}
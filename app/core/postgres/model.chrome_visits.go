@@ -2,21 +2,57 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core"
 )
 
+// ChromeVisitModel references the captured HTML by its blob hash, set it
+// with SetHtml
 type ChromeVisitModel struct {
-	Id        string
-	UrlId     string
-	OpenedAt  time.Time
-	Success   bool
-	ErrorMsg  string
-	Title     string
-	Html      string
-	Reason    string
-	CreatedAt time.Time
+	Id          string
+	UrlId       string
+	OpenedAt    time.Time
+	Success     bool
+	ErrorMsg    string
+	Title       string
+	HtmlHash    *string
+	VisibleText string
+	// FinalUrl and StatusCode describe the document after redirects, nil
+	// for visits that didn't record them
+	FinalUrl   *string
+	StatusCode *int
+	Reason     string
+	RunId      *string
+	CreatedAt  time.Time
+}
+
+// SetHtml stores the HTML in the blob store and extracts its visible text
+// for full-text search
+func (m *ChromeVisitModel) SetHtml(ctx context.Context, html string) error {
+	hash, err := BlobStore().Put(ctx, []byte(html))
+	if err != nil {
+		return err
+	}
+
+	m.HtmlHash = &hash
+	m.VisibleText = core.VisibleText(html)
+	return nil
+}
+
+// LoadHtml reads the captured HTML from the blob store
+func (m *ChromeVisitModel) LoadHtml(ctx context.Context) (string, error) {
+	if m.HtmlHash == nil {
+		return "", fmt.Errorf("visit %s has no captured HTML", m.Id)
+	}
+
+	data, err := BlobStore().Get(ctx, *m.HtmlHash)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 func (m *ChromeVisitModel) Create(ctx context.Context) error {
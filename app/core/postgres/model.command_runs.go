@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type CommandRunModel struct {
+	Id           string
+	Command      string
+	Args         []string
+	Host         string
+	StartedAt    time.Time
+	EndedAt      *time.Time
+	InputCount   int64
+	SuccessCount int64
+	FailureCount int64
+	CreatedAt    time.Time
+}
+
+func (m *CommandRunModel) Create(ctx context.Context) error {
+	return CommandRunRepo.Create(ctx, m)
+}
+
+func (m *CommandRunModel) Update(ctx context.Context) error {
+	return CommandRunRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+func (m *CommandRunModel) Delete(ctx context.Context) error {
+	return CommandRunRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
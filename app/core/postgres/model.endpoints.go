@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// EndpointModel groups the urls of a host whose paths share a template
+type EndpointModel struct {
+	Id           int
+	Hostname     string
+	Port         string
+	PathTemplate string
+	UrlCount     int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+}
+
+func (m *EndpointModel) Create(ctx context.Context) error {
+	return EndpointRepo.Create(ctx, m)
+}
+
+func (m *EndpointModel) Update(ctx context.Context) error {
+	return EndpointRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+func (m *EndpointModel) Delete(ctx context.Context) error {
+	return EndpointRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+// EndpointParamModel is a query parameter seen on an endpoint, Examples
+// keeps the first few distinct values
+type EndpointParamModel struct {
+	EndpointId int
+	Name       string
+	Examples   []string
+	UrlCount   int
+}
+
+func (m *EndpointParamModel) Create(ctx context.Context) error {
+	return EndpointParamRepo.Create(ctx, m)
+}
+
+func (m *EndpointParamModel) Update(ctx context.Context) error {
+	return EndpointParamRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("endpoint_id = ? and name = ?", m.EndpointId, m.Name)
+	})
+}
+
+func (m *EndpointParamModel) Delete(ctx context.Context) error {
+	return EndpointParamRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("endpoint_id = ? and name = ?", m.EndpointId, m.Name)
+	})
+}
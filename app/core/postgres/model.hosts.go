@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// HostModel is a hostname of the inventory. Resolved and Alive stay nil
+// until the host has been checked.
+type HostModel struct {
+	Id                int
+	Hostname          string
+	RegistrableDomain string
+	Reasons           []string
+	FirstSeen         time.Time
+	LastSeen          time.Time
+	Resolved          *bool
+	Alive             *bool
+	CheckedAt         *time.Time
+	CreatedAt         time.Time
+}
+
+func (m *HostModel) Create(ctx context.Context) error {
+	return HostRepo.Create(ctx, m)
+}
+
+func (m *HostModel) Update(ctx context.Context) error {
+	return HostRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+func (m *HostModel) Delete(ctx context.Context) error {
+	return HostRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
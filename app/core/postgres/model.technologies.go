@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	TechnologySourceVisit = "visit"
+	TechnologySourceProbe = "probe"
+)
+
+// TechnologyModel is a technology the fingerprint engine detected on a
+// host, Version is the latest one seen and empty while unknown. Source
+// tells whether it came from a chrome visit or an HTTP probe and VisitId is
+// set for visits
+type TechnologyModel struct {
+	Id         int64
+	Hostname   string
+	Name       string
+	Version    string
+	Categories []string
+	Confidence int
+	Source     string
+	VisitId    *string
+	Url        string
+	Evidence   []string
+	FirstSeen  time.Time
+	LastSeen   time.Time
+}
+
+func (m *TechnologyModel) Create(ctx context.Context) error {
+	return TechnologyRepo.Create(ctx, m)
+}
+
+func (m *TechnologyModel) Update(ctx context.Context) error {
+	return TechnologyRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+func (m *TechnologyModel) Delete(ctx context.Context) error {
+	return TechnologyRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
@@ -10,6 +10,7 @@ import (
 type URLVisitModel struct {
 	UrlId     string
 	VisitId   string
+	RunId     *string
 	CreatedAt time.Time
 }
 
@@ -2,17 +2,23 @@ package postgres
 
 import (
 	"context"
-	"net/url"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core/canonical"
+	"github.com/mgorunuch/microb/app/core/urlflags"
 )
 
+// UrlModel keeps the URL as it was found in Raw, the other columns are
+// derived from its canonical form which is unique. Flags are set by the
+// url flags classifier.
 type UrlModel struct {
 	Id        string
 	Raw       string
+	Canonical string
 	Flags     []string
 	Hostname  string
+	Port      string
 	Path      string
 	Scheme    string
 	Query     string
@@ -21,15 +27,18 @@ type UrlModel struct {
 }
 
 func (m *UrlModel) CalcFromRaw(ctx context.Context) error {
-	u, err := url.Parse(m.Raw)
+	u, err := canonical.Parse(m.Raw, canonical.DefaultOptions())
 	if err != nil {
 		return err
 	}
 
-	m.Hostname = u.Hostname()
+	m.Canonical = u.String()
+	m.Flags = urlflags.Default().Classify(u)
+	m.Hostname = u.Host
+	m.Port = u.Port
 	m.Path = u.Path
 	m.Scheme = u.Scheme
-	m.Query = u.RawQuery
+	m.Query = u.Query
 	m.Fragment = u.Fragment
 
 	return nil
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// VisitRequestModel is a request the page made during a chrome visit, Seq
+// orders the requests of a visit. Status is 0 when no response arrived
+type VisitRequestModel struct {
+	Id              int64
+	VisitId         string
+	Seq             int
+	UrlId           *string
+	Url             string
+	Method          string
+	ResourceType    string
+	RequestHeaders  map[string]string
+	PostData        []byte
+	Status          int
+	StatusText      string
+	Protocol        string
+	ResponseHeaders map[string]string
+	MimeType        string
+	RemoteIp        string
+	RedirectUrl     string
+	EncodedSize     int64
+	BodyHash        *string
+	ErrorText       string
+	StartedAt       time.Time
+	DurationMs      float64
+	CreatedAt       time.Time
+	// Body is not a column, StoreVisitRequests moves it to the blob store
+	// and sets BodyHash
+	Body []byte
+}
+
+// LoadBody reads the response body from the blob store, nil when it wasn't
+// captured
+func (m *VisitRequestModel) LoadBody(ctx context.Context) ([]byte, error) {
+	if m.BodyHash == nil {
+		return nil, nil
+	}
+	return BlobStore().Get(ctx, *m.BodyHash)
+}
+
+func (m *VisitRequestModel) Create(ctx context.Context) error {
+	return VisitRequestRepo.Create(ctx, m)
+}
+
+func (m *VisitRequestModel) Update(ctx context.Context) error {
+	return VisitRequestRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+func (m *VisitRequestModel) Delete(ctx context.Context) error {
+	return VisitRequestRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
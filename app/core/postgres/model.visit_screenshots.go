@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	ScreenshotViewport = "viewport"
+	ScreenshotFullPage = "full"
+)
+
+// VisitScreenshotModel is a PNG on disk at Path, Phash is the imagehash
+// difference hash of it
+type VisitScreenshotModel struct {
+	VisitId   string
+	Kind      string
+	Path      string
+	Width     int
+	Height    int
+	Phash     int64
+	CreatedAt time.Time
+}
+
+func (m *VisitScreenshotModel) Create(ctx context.Context) error {
+	return VisitScreenshotRepo.Create(ctx, m)
+}
+
+func (m *VisitScreenshotModel) Update(ctx context.Context) error {
+	return VisitScreenshotRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("visit_id = ? and kind = ?", m.VisitId, m.Kind)
+	})
+}
+
+func (m *VisitScreenshotModel) Delete(ctx context.Context) error {
+	return VisitScreenshotRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("visit_id = ? and kind = ?", m.VisitId, m.Kind)
+	})
+}
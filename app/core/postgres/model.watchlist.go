@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type WatchlistModel struct {
+	Id        int
+	Domain    string
+	Engines   []string
+	Enabled   bool
+	CreatedAt time.Time
+}
+
+func (m *WatchlistModel) Create(ctx context.Context) error {
+	return WatchlistRepo.Create(ctx, m)
+}
+
+func (m *WatchlistModel) Update(ctx context.Context) error {
+	return WatchlistRepo.Update(ctx, m, func(builder sq.UpdateBuilder) sq.UpdateBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
+
+func (m *WatchlistModel) Delete(ctx context.Context) error {
+	return WatchlistRepo.Delete(ctx, func(builder sq.DeleteBuilder) sq.DeleteBuilder {
+		return builder.Where("id = ?", m.Id)
+	})
+}
@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/blob"
+)
+
+const (
+	BlobBackendPostgres = "postgres"
+	BlobBackendDir      = "dir"
+)
+
+type BlobRepository struct {
+	BaseRepository[BlobModel]
+}
+
+var BlobRepo = &BlobRepository{
+	BaseRepository: BaseRepository[BlobModel]{
+		ModelConfig: ModelConfig[BlobModel]{
+			Table: "blobs",
+			Cols:  []string{"hash", "size", "data", "created_at"},
+			BuildMap: func(model *BlobModel) map[string]interface{} {
+				return map[string]interface{}{
+					"hash":       model.Hash,
+					"size":       model.Size,
+					"data":       model.Data,
+					"created_at": model.CreatedAt,
+				}
+			},
+			ScanMap: func(model *BlobModel) ([]string, []interface{}) {
+				return []string{"hash", "size", "data", "created_at"},
+					[]interface{}{
+						&model.Hash,
+						&model.Size,
+						&model.Data,
+						&model.CreatedAt,
+					}
+			},
+		},
+	},
+}
+
+// Put implements blob.Store
+func (r *BlobRepository) Put(ctx context.Context, data []byte) (string, error) {
+	hash := blob.Hash(data)
+
+	exists, err := r.Has(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return hash, nil
+	}
+
+	_, err = DB(ctx).Exec(ctx,
+		"insert into blobs (hash, size, data, created_at) values ($1, $2, $3, $4) on conflict (hash) do nothing",
+		hash, len(data), blob.Compress(data), time.Now(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to store blob %s: %v", hash, err)
+	}
+
+	return hash, nil
+}
+
+// Get implements blob.Store
+func (r *BlobRepository) Get(ctx context.Context, hash string) ([]byte, error) {
+	model, err := r.Select(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("hash = ?", hash)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", blob.ErrNotFound, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.Decompress(hash, model.Data)
+}
+
+// Has implements blob.Store
+func (r *BlobRepository) Has(ctx context.Context, hash string) (bool, error) {
+	var exists bool
+	err := DB(ctx).QueryRow(ctx, "select exists(select 1 from blobs where hash = $1)", hash).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check blob %s: %v", hash, err)
+	}
+	return exists, nil
+}
+
+var (
+	blobStore     blob.Store
+	blobStoreOnce sync.Once
+)
+
+// BlobStore returns the store selected by BLOB_BACKEND, the blobs table by
+// default or the BLOB_DIR directory
+func BlobStore() blob.Store {
+	blobStoreOnce.Do(func() {
+		switch backend := core.Env.GetDefault("BLOB_BACKEND", BlobBackendPostgres); backend {
+		case BlobBackendPostgres:
+			blobStore = BlobRepo
+		case BlobBackendDir:
+			blobStore = blob.NewDirStore(core.Env.GetDefault("BLOB_DIR", "blobs"))
+		default:
+			core.Logger.Fatalf("Unknown blob backend %q, expected %s or %s", backend, BlobBackendPostgres, BlobBackendDir)
+		}
+	})
+	return blobStore
+}
@@ -2,9 +2,12 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/blob"
 )
 
 type ChromeVisitRepository struct {
@@ -15,21 +18,25 @@ var ChromeVisitRepo = &ChromeVisitRepository{
 	BaseRepository: BaseRepository[ChromeVisitModel]{
 		ModelConfig: ModelConfig[ChromeVisitModel]{
 			Table: "chrome_visits",
-			Cols:  []string{"id", "url_id", "opened_at", "success", "error_msg", "title", "html", "reason", "created_at"},
+			Cols:  []string{"id", "url_id", "opened_at", "success", "error_msg", "title", "html_hash", "visible_text", "final_url", "status_code", "reason", "run_id", "created_at"},
 			BuildMap: func(model *ChromeVisitModel) map[string]interface{} {
 				return map[string]interface{}{
-					"url_id":     model.UrlId,
-					"opened_at":  model.OpenedAt,
-					"success":    model.Success,
-					"error_msg":  model.ErrorMsg,
-					"title":      model.Title,
-					"html":       model.Html,
-					"reason":     model.Reason,
-					"created_at": model.CreatedAt,
+					"url_id":       model.UrlId,
+					"opened_at":    model.OpenedAt,
+					"success":      model.Success,
+					"error_msg":    model.ErrorMsg,
+					"title":        model.Title,
+					"html_hash":    model.HtmlHash,
+					"visible_text": model.VisibleText,
+					"final_url":    model.FinalUrl,
+					"status_code":  model.StatusCode,
+					"reason":       model.Reason,
+					"run_id":       model.RunId,
+					"created_at":   model.CreatedAt,
 				}
 			},
 			ScanMap: func(model *ChromeVisitModel) ([]string, []interface{}) {
-				return []string{"id", "url_id", "opened_at", "success", "error_msg", "title", "html", "reason", "created_at"},
+				return []string{"id", "url_id", "opened_at", "success", "error_msg", "title", "html_hash", "coalesce(visible_text, '') as visible_text", "final_url", "status_code", "reason", "run_id", "created_at"},
 					[]interface{}{
 						&model.Id,
 						&model.UrlId,
@@ -37,8 +44,12 @@ var ChromeVisitRepo = &ChromeVisitRepository{
 						&model.Success,
 						&model.ErrorMsg,
 						&model.Title,
-						&model.Html,
+						&model.HtmlHash,
+						&model.VisibleText,
+						&model.FinalUrl,
+						&model.StatusCode,
 						&model.Reason,
+						&model.RunId,
 						&model.CreatedAt,
 					}
 			},
@@ -81,3 +92,130 @@ func (r *ChromeVisitRepository) GetLastVisitByURL(ctx context.Context, url strin
 			Limit(1)
 	})
 }
+
+// ListLastVisits returns the latest n visits of the url with captured HTML,
+// newest first
+func (r *ChromeVisitRepository) ListLastVisits(ctx context.Context, urlId string, n uint64) ([]ChromeVisitModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("url_id = ? and html_hash is not null", urlId).
+			OrderBy("opened_at desc").
+			Limit(n)
+	})
+}
+
+// moveVisitHtmlToBlobs stores the inline HTML of visits in the blob store
+// and references it by hash, in batches. The blobs are written once the rows
+// are updated, a failed update leaves no files behind in a dir store
+func moveVisitHtmlToBlobs(ctx context.Context) error {
+	const batchSize = 500
+
+	store := BlobStore()
+	for {
+		rows, err := DB(ctx).Query(ctx,
+			"select id, html from chrome_visits where html is not null and html_hash is null limit $1",
+			batchSize,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to select visits: %w", err)
+		}
+
+		// The transaction connection is busy until the rows are read
+		var ids, htmls []string
+		for rows.Next() {
+			var id, html string
+			if err := rows.Scan(&id, &html); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan visit: %w", err)
+			}
+			ids = append(ids, id)
+			htmls = append(htmls, html)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to select visits: %w", err)
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		hashes := make([]string, len(htmls))
+		for i, html := range htmls {
+			hashes[i] = blob.Hash([]byte(html))
+		}
+
+		_, err = DB(ctx).Exec(ctx, `
+			update chrome_visits cv set html_hash = v.hash
+			from unnest($1::uuid[], $2::text[]) as v(id, hash)
+			where cv.id = v.id
+		`, ids, hashes)
+		if err != nil {
+			return fmt.Errorf("failed to reference blobs: %w", err)
+		}
+
+		for _, html := range htmls {
+			if _, err := store.Put(ctx, []byte(html)); err != nil {
+				return err
+			}
+		}
+
+		core.Logger.Debugf("Moved HTML of %d visits into blobs", len(ids))
+	}
+}
+
+// restoreVisitHtmlFromBlobs fills the html column back from the blob store,
+// in batches. A missing blob fails the rollback instead of losing the page
+func restoreVisitHtmlFromBlobs(ctx context.Context) error {
+	const batchSize = 500
+
+	store := BlobStore()
+	for {
+		rows, err := DB(ctx).Query(ctx,
+			"select id, html_hash from chrome_visits where html is null and html_hash is not null limit $1",
+			batchSize,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to select visits: %w", err)
+		}
+
+		// The transaction connection is busy until the rows are read
+		var ids, hashes []string
+		for rows.Next() {
+			var id, hash string
+			if err := rows.Scan(&id, &hash); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan visit: %w", err)
+			}
+			ids = append(ids, id)
+			hashes = append(hashes, hash)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to select visits: %w", err)
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		htmls := make([]string, len(hashes))
+		for i, hash := range hashes {
+			data, err := store.Get(ctx, hash)
+			if err != nil {
+				return fmt.Errorf("failed to restore html of visit %s: %w", ids[i], err)
+			}
+			htmls[i] = string(data)
+		}
+
+		_, err = DB(ctx).Exec(ctx, `
+			update chrome_visits cv set html = v.html
+			from unnest($1::uuid[], $2::text[]) as v(id, html)
+			where cv.id = v.id
+		`, ids, htmls)
+		if err != nil {
+			return fmt.Errorf("failed to restore html: %w", err)
+		}
+
+		core.Logger.Debugf("Restored HTML of %d visits from blobs", len(ids))
+	}
+}
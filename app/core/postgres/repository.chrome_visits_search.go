@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// VisitTextMatch is a visit matching a full-text query, Snippet highlights
+// the matched words of the visible text
+type VisitTextMatch struct {
+	VisitId  string
+	Url      string
+	Title    string
+	OpenedAt time.Time
+	Rank     float32
+	Snippet  string
+}
+
+// VisitBody references the captured HTML of a visit with its url
+type VisitBody struct {
+	VisitId  string
+	Url      string
+	Title    string
+	OpenedAt time.Time
+	HtmlHash string
+}
+
+// VisitSearchFilter narrows searches to a hostname, hosts running a
+// technology and a time range
+type VisitSearchFilter struct {
+	Hostname   string
+	Technology string
+	Since      time.Time
+	Limit      uint64
+}
+
+func (f VisitSearchFilter) apply(builder sq.SelectBuilder) sq.SelectBuilder {
+	if f.Hostname != "" {
+		builder = builder.Where("u.hostname = ?", f.Hostname)
+	}
+	if f.Technology != "" {
+		builder = builder.Where(technologyExists("u", f.Technology))
+	}
+	if !f.Since.IsZero() {
+		builder = builder.Where("cv.opened_at >= ?", f.Since)
+	}
+	if f.Limit > 0 {
+		builder = builder.Limit(f.Limit)
+	}
+	return builder
+}
+
+// SearchText runs a web search style query (quoted phrases, or, -exclusion)
+// over the titles and visible text of successful visits, best matches first
+func (r *ChromeVisitRepository) SearchText(ctx context.Context, query string, filter VisitSearchFilter) ([]VisitTextMatch, error) {
+	builder := psql.
+		Select(
+			"cv.id", "u.canonical", "coalesce(cv.title, '')", "cv.opened_at",
+			"ts_rank(cv.search_vector, q.query)",
+			"ts_headline('simple', coalesce(cv.visible_text, ''), q.query, 'StartSel=>>>, StopSel=<<<, MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter= ... ')",
+		).
+		From("chrome_visits cv").
+		JoinClause("cross join websearch_to_tsquery('simple', ?) q(query)", query).
+		Join("urls u on u.id = cv.url_id").
+		Where("cv.search_vector @@ q.query").
+		OrderBy("5 desc", "cv.opened_at desc")
+	builder = filter.apply(builder)
+
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search visits: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []VisitTextMatch
+	for rows.Next() {
+		var match VisitTextMatch
+		err := rows.Scan(&match.VisitId, &match.Url, &match.Title, &match.OpenedAt, &match.Rank, &match.Snippet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan visit: %w", err)
+		}
+		matches = append(matches, match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search visits: %w", err)
+	}
+
+	return matches, nil
+}
+
+// StreamVisitBodies calls fn for the visits with captured HTML, newest
+// first. The HTML is compressed in the blob store, so matching it is left
+// to the caller.
+func (r *ChromeVisitRepository) StreamVisitBodies(ctx context.Context, filter VisitSearchFilter, fn func(visit *VisitBody) error) error {
+	builder := psql.
+		Select("cv.id", "u.canonical", "coalesce(cv.title, '')", "cv.opened_at", "cv.html_hash").
+		From("chrome_visits cv").
+		Join("urls u on u.id = cv.url_id").
+		Where("cv.html_hash is not null").
+		OrderBy("cv.opened_at desc")
+	builder = filter.apply(builder)
+
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := DB(ctx).Query(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed to select visits: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var visit VisitBody
+		err := rows.Scan(&visit.VisitId, &visit.Url, &visit.Title, &visit.OpenedAt, &visit.HtmlHash)
+		if err != nil {
+			return fmt.Errorf("failed to scan visit: %w", err)
+		}
+
+		if err := fn(&visit); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to select visits: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core"
+)
+
+type CommandRunRepository struct {
+	BaseRepository[CommandRunModel]
+}
+
+var CommandRunRepo = &CommandRunRepository{
+	BaseRepository: BaseRepository[CommandRunModel]{
+		ModelConfig: ModelConfig[CommandRunModel]{
+			Table: "command_runs",
+			Cols:  []string{"id", "command", "args", "host", "started_at", "ended_at", "input_count", "success_count", "failure_count", "created_at"},
+			BuildMap: func(model *CommandRunModel) map[string]interface{} {
+				return map[string]interface{}{
+					"id":            model.Id,
+					"command":       model.Command,
+					"args":          model.Args,
+					"host":          model.Host,
+					"started_at":    model.StartedAt,
+					"ended_at":      model.EndedAt,
+					"input_count":   model.InputCount,
+					"success_count": model.SuccessCount,
+					"failure_count": model.FailureCount,
+					"created_at":    model.CreatedAt,
+				}
+			},
+			ScanMap: func(model *CommandRunModel) ([]string, []interface{}) {
+				return []string{"id", "command", "args", "host", "started_at", "ended_at", "input_count", "success_count", "failure_count", "created_at"},
+					[]interface{}{
+						&model.Id,
+						&model.Command,
+						&model.Args,
+						&model.Host,
+						&model.StartedAt,
+						&model.EndedAt,
+						&model.InputCount,
+						&model.SuccessCount,
+						&model.FailureCount,
+						&model.CreatedAt,
+					}
+			},
+		},
+	},
+}
+
+// currentRun is the record of core.Run, it is nil until the run is persisted
+var currentRun *CommandRunModel
+
+func newCommandRunModel(run *core.CommandRun) *CommandRunModel {
+	model := &CommandRunModel{
+		Id:           run.Id,
+		Command:      run.Command,
+		Args:         run.Args,
+		Host:         run.Host,
+		StartedAt:    run.StartedAt,
+		InputCount:   run.InputCount.Load(),
+		SuccessCount: run.SuccessCount.Load(),
+		FailureCount: run.FailureCount.Load(),
+		CreatedAt:    time.Now(),
+	}
+
+	if !run.EndedAt.IsZero() {
+		model.EndedAt = &run.EndedAt
+	}
+
+	return model
+}
+
+func startCurrentRun(ctx context.Context) {
+	model := newCommandRunModel(core.Run)
+	if err := CommandRunRepo.Create(ctx, model); err != nil {
+		core.Logger.Errorf("Failed to record command run: %v", err)
+		return
+	}
+	currentRun = model
+}
+
+func finishCurrentRun(ctx context.Context) {
+	if currentRun == nil {
+		return
+	}
+
+	core.Run.Finish()
+
+	model := newCommandRunModel(core.Run)
+	model.CreatedAt = currentRun.CreatedAt
+	if err := model.Update(ctx); err != nil {
+		core.Logger.Errorf("Failed to finish command run: %v", err)
+	}
+}
+
+// CurrentRunId returns the id of the persisted command run, or nil if it was not recorded
+func CurrentRunId() *string {
+	if currentRun == nil {
+		return nil
+	}
+	return &currentRun.Id
+}
+
+func (r *CommandRunRepository) GetById(ctx context.Context, id string) (*CommandRunModel, error) {
+	return r.Select(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("id = ?", id)
+	})
+}
+
+func (r *CommandRunRepository) ListByCommand(ctx context.Context, command string) ([]CommandRunModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("command = ?", command).OrderBy("started_at desc")
+	})
+}
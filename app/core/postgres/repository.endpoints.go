@@ -0,0 +1,315 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/mgorunuch/microb/app/core/canonical"
+)
+
+// Parameter values are only kept as examples, long ones are cut
+const (
+	maxParamExamples    = 5
+	maxParamExampleSize = 200
+)
+
+type EndpointRepository struct {
+	BaseRepository[EndpointModel]
+}
+
+var EndpointRepo = &EndpointRepository{
+	BaseRepository: BaseRepository[EndpointModel]{
+		ModelConfig: ModelConfig[EndpointModel]{
+			Table: "endpoints",
+			Cols:  []string{"id", "hostname", "port", "path_template", "url_count", "first_seen", "last_seen"},
+			BuildMap: func(model *EndpointModel) map[string]interface{} {
+				return map[string]interface{}{
+					"hostname":      model.Hostname,
+					"port":          model.Port,
+					"path_template": model.PathTemplate,
+					"url_count":     model.UrlCount,
+					"first_seen":    model.FirstSeen,
+					"last_seen":     model.LastSeen,
+				}
+			},
+			ScanMap: func(model *EndpointModel) ([]string, []interface{}) {
+				return []string{"id", "hostname", "port", "path_template", "url_count", "first_seen", "last_seen"},
+					[]interface{}{
+						&model.Id,
+						&model.Hostname,
+						&model.Port,
+						&model.PathTemplate,
+						&model.UrlCount,
+						&model.FirstSeen,
+						&model.LastSeen,
+					}
+			},
+		},
+	},
+}
+
+type EndpointParamRepository struct {
+	BaseRepository[EndpointParamModel]
+}
+
+var EndpointParamRepo = &EndpointParamRepository{
+	BaseRepository: BaseRepository[EndpointParamModel]{
+		ModelConfig: ModelConfig[EndpointParamModel]{
+			Table: "endpoint_params",
+			Cols:  []string{"endpoint_id", "name", "examples", "url_count"},
+			BuildMap: func(model *EndpointParamModel) map[string]interface{} {
+				return map[string]interface{}{
+					"endpoint_id": model.EndpointId,
+					"name":        model.Name,
+					"examples":    model.Examples,
+					"url_count":   model.UrlCount,
+				}
+			},
+			ScanMap: func(model *EndpointParamModel) ([]string, []interface{}) {
+				return []string{"endpoint_id", "name", "examples", "url_count"},
+					[]interface{}{
+						&model.EndpointId,
+						&model.Name,
+						&model.Examples,
+						&model.UrlCount,
+					}
+			},
+		},
+	},
+}
+
+// StreamByHost calls fn for the endpoints ordered by host and path template,
+// an empty hostname streams every host and a technology limits them to the
+// hosts running it
+func (r *EndpointRepository) StreamByHost(ctx context.Context, hostname, technology string, minUrls int, fn func(model *EndpointModel) error) error {
+	return r.Stream(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		if hostname != "" {
+			builder = builder.Where("hostname = ?", hostname)
+		}
+		if technology != "" {
+			builder = builder.Where(technologyExists("endpoints", technology))
+		}
+		if minUrls > 0 {
+			builder = builder.Where("url_count >= ?", minUrls)
+		}
+		return builder.OrderBy("hostname asc", "port asc", "path_template asc")
+	}, fn)
+}
+
+func (r *EndpointParamRepository) ListByEndpointIds(ctx context.Context, endpointIds []int) ([]EndpointParamModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("endpoint_id = any(?)", endpointIds).OrderBy("endpoint_id asc", "name asc")
+	})
+}
+
+const upsertEndpointQuery = `
+	insert into endpoints (hostname, port, path_template, url_count)
+	values ($1, $2, $3, $4)
+	on conflict (hostname, port, path_template) do update set
+		url_count = endpoints.url_count + excluded.url_count,
+		last_seen = current_timestamp
+`
+
+const upsertEndpointParamQuery = `
+	insert into endpoint_params (endpoint_id, name, examples, url_count)
+	select id, $4, $5, $6 from endpoints
+	where hostname = $1 and port = $2 and path_template = $3
+	on conflict (endpoint_id, name) do update set
+		url_count = endpoint_params.url_count + excluded.url_count,
+		examples = (array(
+			select distinct example from unnest(endpoint_params.examples || excluded.examples) example
+		))[1:5]
+`
+
+const linkEndpointUrlsQuery = `
+	update urls set endpoint_id = (
+		select id from endpoints
+		where hostname = $1 and port = $2 and path_template = $3
+	)
+	where id = any($4)
+`
+
+type endpointKey struct {
+	hostname     string
+	port         string
+	pathTemplate string
+}
+
+type endpointStats struct {
+	urlIds []string
+	params map[string]*EndpointParamModel
+}
+
+// IndexUrls adds the urls that aren't part of an endpoint yet to the
+// endpoint and parameter inventory, it returns how many were added
+func IndexUrls(ctx context.Context, urlIds []string) (int, error) {
+	if len(urlIds) == 0 {
+		return 0, nil
+	}
+
+	indexed := 0
+	err := WithTx(ctx, func(ctx context.Context) error {
+		// Locked rows are being indexed by another run
+		rows, err := DB(ctx).Query(ctx, `
+			select id, hostname, port, path, coalesce(query, '') from urls
+			where id = any($1) and endpoint_id is null
+			for update skip locked
+		`, urlIds)
+		if err != nil {
+			return fmt.Errorf("failed to select urls: %v", err)
+		}
+
+		endpoints := make(map[endpointKey]*endpointStats)
+		for rows.Next() {
+			var id, hostname, port, path, query string
+			if err := rows.Scan(&id, &hostname, &port, &path, &query); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan url: %v", err)
+			}
+
+			key := endpointKey{hostname: hostname, port: port, pathTemplate: canonical.PathTemplate(path)}
+			stats, ok := endpoints[key]
+			if !ok {
+				stats = &endpointStats{params: make(map[string]*EndpointParamModel)}
+				endpoints[key] = stats
+			}
+			stats.urlIds = append(stats.urlIds, id)
+			addParams(stats.params, query)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to select urls: %v", err)
+		}
+
+		// Sorted keys make concurrent runs lock endpoints in the same order
+		keys := make([]endpointKey, 0, len(endpoints))
+		for key := range endpoints {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].hostname != keys[j].hostname {
+				return keys[i].hostname < keys[j].hostname
+			}
+			if keys[i].port != keys[j].port {
+				return keys[i].port < keys[j].port
+			}
+			return keys[i].pathTemplate < keys[j].pathTemplate
+		})
+
+		batch := &pgx.Batch{}
+		for _, key := range keys {
+			stats := endpoints[key]
+			batch.Queue(upsertEndpointQuery, key.hostname, key.port, key.pathTemplate, len(stats.urlIds))
+
+			names := make([]string, 0, len(stats.params))
+			for name := range stats.params {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				param := stats.params[name]
+				batch.Queue(upsertEndpointParamQuery, key.hostname, key.port, key.pathTemplate, name, param.Examples, param.UrlCount)
+			}
+
+			batch.Queue(linkEndpointUrlsQuery, key.hostname, key.port, key.pathTemplate, stats.urlIds)
+			indexed += len(stats.urlIds)
+		}
+
+		if err := DB(ctx).SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to index endpoints: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return indexed, nil
+}
+
+// addParams counts the parameter names of a canonical query once per url
+func addParams(params map[string]*EndpointParamModel, query string) {
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(query, "&") {
+		if part == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(part, "=")
+		name = unescapeParam(name)
+		value = truncateParam(unescapeParam(value), maxParamExampleSize)
+
+		param, ok := params[name]
+		if !ok {
+			param = &EndpointParamModel{Name: name, Examples: []string{}}
+			params[name] = param
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			param.UrlCount++
+		}
+
+		if value != "" && len(param.Examples) < maxParamExamples && !slices.Contains(param.Examples, value) {
+			param.Examples = append(param.Examples, value)
+		}
+	}
+}
+
+// unescapeParam decodes a query name or value, keeping the escaped form when
+// the decoded one is not valid text for postgres
+func unescapeParam(s string) string {
+	decoded, err := url.QueryUnescape(s)
+	if err != nil || !utf8.ValidString(decoded) || strings.ContainsRune(decoded, 0) {
+		decoded = s
+	}
+	return strings.ToValidUTF8(decoded, "\uFFFD")
+}
+
+// truncateParam cuts s to at most size bytes without splitting a character
+func truncateParam(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+
+	s = s[:size]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// ListUnindexedUrlIds returns up to limit ids of urls that aren't part of an
+// endpoint yet ordered by id after the given one, an empty id starts over
+func ListUnindexedUrlIds(ctx context.Context, afterId string, limit int) ([]string, error) {
+	builder := psql.Select("id").From("urls").Where("endpoint_id is null").OrderBy("id asc").Limit(uint64(limit))
+	if afterId != "" {
+		builder = builder.Where("id > ?", afterId)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %v", err)
+	}
+
+	rows, err := DB(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select urls: %v", err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to select urls: %v", err)
+	}
+
+	return ids, nil
+}
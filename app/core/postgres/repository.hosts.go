@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type HostRepository struct {
+	BaseRepository[HostModel]
+}
+
+var HostRepo = &HostRepository{
+	BaseRepository: BaseRepository[HostModel]{
+		ModelConfig: ModelConfig[HostModel]{
+			Table: "hosts",
+			Cols:  []string{"id", "hostname", "registrable_domain", "reasons", "first_seen", "last_seen", "resolved", "alive", "checked_at", "created_at"},
+			BuildMap: func(model *HostModel) map[string]interface{} {
+				return map[string]interface{}{
+					"hostname":           model.Hostname,
+					"registrable_domain": model.RegistrableDomain,
+					"reasons":            model.Reasons,
+					"first_seen":         model.FirstSeen,
+					"last_seen":          model.LastSeen,
+					"resolved":           model.Resolved,
+					"alive":              model.Alive,
+					"checked_at":         model.CheckedAt,
+					"created_at":         model.CreatedAt,
+				}
+			},
+			ScanMap: func(model *HostModel) ([]string, []interface{}) {
+				return []string{"id", "hostname", "registrable_domain", "reasons", "first_seen", "last_seen", "resolved", "alive", "checked_at", "created_at"},
+					[]interface{}{
+						&model.Id,
+						&model.Hostname,
+						&model.RegistrableDomain,
+						&model.Reasons,
+						&model.FirstSeen,
+						&model.LastSeen,
+						&model.Resolved,
+						&model.Alive,
+						&model.CheckedAt,
+						&model.CreatedAt,
+					}
+			},
+		},
+	},
+}
+
+// hostUpsertSuffix merges a sighting into an existing host: the seen range is
+// widened, reasons are unioned and a missing check result keeps the old one
+const hostUpsertSuffix = `on conflict (hostname) do update set
+	first_seen = least(hosts.first_seen, excluded.first_seen),
+	last_seen = greatest(hosts.last_seen, excluded.last_seen),
+	reasons = array(select distinct unnest(hosts.reasons || excluded.reasons) order by 1),
+	resolved = coalesce(excluded.resolved, hosts.resolved),
+	alive = coalesce(excluded.alive, hosts.alive),
+	checked_at = coalesce(excluded.checked_at, hosts.checked_at)
+returning `
+
+// Upsert records a sighting of the host and reports whether it is new to the inventory
+func (r *HostRepository) Upsert(ctx context.Context, model *HostModel) (bool, error) {
+	now := time.Now()
+	if model.FirstSeen.IsZero() {
+		model.FirstSeen = now
+	}
+	if model.LastSeen.IsZero() {
+		model.LastSeen = model.FirstSeen
+	}
+	if model.CreatedAt.IsZero() {
+		model.CreatedAt = now
+	}
+	if model.Reasons == nil {
+		model.Reasons = []string{}
+	}
+
+	cols, vals := r.ModelConfig.ScanMap(model)
+
+	// xmax is zero only for rows inserted by this statement
+	var inserted bool
+	query, args, err := psql.
+		Insert(r.ModelConfig.Table).
+		SetMap(r.ModelConfig.BuildMap(model)).
+		Suffix(hostUpsertSuffix + strings.Join(cols, ", ") + ", (xmax = 0) as inserted").
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %v", err)
+	}
+
+	err = DB(ctx).QueryRow(ctx, query, args...).Scan(append(vals, &inserted)...)
+	if err != nil {
+		return false, fmt.Errorf("failed to upsert host: %v", err)
+	}
+
+	return inserted, nil
+}
+
+func (r *HostRepository) GetByHostname(ctx context.Context, hostname string) (*HostModel, error) {
+	return r.Select(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("hostname = ?", hostname)
+	})
+}
+
+// ListNewSince returns the hosts first seen after the given time, oldest first
+func (r *HostRepository) ListNewSince(ctx context.Context, since time.Time) ([]HostModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("first_seen > ?", since).OrderBy("first_seen asc", "hostname asc")
+	})
+}
+
+// ListBySource returns the hosts that were stored with the reason
+func (r *HostRepository) ListBySource(ctx context.Context, reason string) ([]HostModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("reasons @> array[?]::text[]", reason).OrderBy("hostname asc")
+	})
+}
+
+func (r *HostRepository) ListByRegistrableDomain(ctx context.Context, registrableDomain string) ([]HostModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("registrable_domain = ?", registrableDomain).OrderBy("hostname asc")
+	})
+}
@@ -2,6 +2,11 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
 
 	sq "github.com/Masterminds/squirrel"
 )
@@ -23,7 +28,7 @@ var IgnoredHostnameRepo = &IgnoredHostnameRepository{
 				}
 			},
 			ScanMap: func(model *IgnoredHostnameModel) ([]string, []interface{}) {
-				return []string{"id", "hostname", "reason", "created_at"},
+				return []string{"id", "hostname", "coalesce(reason, '') as reason", "created_at"},
 					[]interface{}{
 						&model.Id,
 						&model.Hostname,
@@ -52,3 +57,71 @@ func (r *IgnoredHostnameRepository) ListAll(ctx context.Context) ([]IgnoredHostn
 		return builder.OrderBy("hostname asc")
 	})
 }
+
+// Upsert adds the hostname or replaces the reason it is ignored for
+func (r *IgnoredHostnameRepository) Upsert(ctx context.Context, hostname string, reason string) (*IgnoredHostnameModel, error) {
+	model := &IgnoredHostnameModel{
+		Hostname:  hostname,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	cols, vals := r.ModelConfig.ScanMap(model)
+
+	query, args, err := psql.
+		Insert(r.ModelConfig.Table).
+		SetMap(r.ModelConfig.BuildMap(model)).
+		Suffix("on conflict (hostname) do update set reason = excluded.reason returning " + strings.Join(cols, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %v", err)
+	}
+
+	if err := DB(ctx).QueryRow(ctx, query, args...).Scan(vals...); err != nil {
+		return nil, fmt.Errorf("failed to upsert ignored hostname: %v", err)
+	}
+
+	return model, nil
+}
+
+// DeleteByHostname removes the hostname and reports whether it was ignored
+func (r *IgnoredHostnameRepository) DeleteByHostname(ctx context.Context, hostname string) (bool, error) {
+	tag, err := DB(ctx).Exec(ctx, "delete from ignored_hostnames where hostname = $1", hostname)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete ignored hostname: %v", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// loadIgnoredHostnamesScope adds every ignored hostname to core.Scope as an exclude rule
+// matching the hostname and its subdomains
+func loadIgnoredHostnamesScope(ctx context.Context) {
+	hostnames, err := IgnoredHostnameRepo.ListAll(ctx)
+	if err != nil {
+		core.Logger.Errorf("Failed to load ignored hostnames: %v", err)
+		return
+	}
+
+	var rules []core.ScopeRule
+	for _, hostname := range hostnames {
+		rule, err := core.ParseScopeRule(hostname.Hostname, "ignored_hostnames")
+		if err != nil {
+			core.Logger.Warnf("Skipping ignored hostname %q: %v", hostname.Hostname, err)
+			continue
+		}
+
+		// Ignoring a hostname also ignores its subdomains
+		if rule.Kind == core.ScopeRuleDomain {
+			rule, err = core.ParseScopeRule("."+rule.Raw, "ignored_hostnames")
+			if err != nil {
+				core.Logger.Warnf("Skipping ignored hostname %q: %v", hostname.Hostname, err)
+				continue
+			}
+		}
+		rule.Exclude = true
+		rule.Reason = hostname.Reason
+		rules = append(rules, rule)
+	}
+
+	core.Scope.Add(rules...)
+	core.Logger.Debugf("Loaded %d ignored hostnames into scope", len(rules))
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core/fingerprint"
+)
+
+type TechnologyRepository struct {
+	BaseRepository[TechnologyModel]
+}
+
+var technologyCols = []string{
+	"id", "hostname", "name", "version", "categories", "confidence", "source", "visit_id", "url", "evidence",
+	"first_seen", "last_seen",
+}
+
+var TechnologyRepo = &TechnologyRepository{
+	BaseRepository: BaseRepository[TechnologyModel]{
+		ModelConfig: ModelConfig[TechnologyModel]{
+			Table: "technologies",
+			Cols:  technologyCols,
+			BuildMap: func(model *TechnologyModel) map[string]interface{} {
+				return map[string]interface{}{
+					"hostname":   model.Hostname,
+					"name":       model.Name,
+					"version":    model.Version,
+					"categories": model.Categories,
+					"confidence": model.Confidence,
+					"source":     model.Source,
+					"visit_id":   model.VisitId,
+					"url":        model.Url,
+					"evidence":   model.Evidence,
+					"first_seen": model.FirstSeen,
+					"last_seen":  model.LastSeen,
+				}
+			},
+			ScanMap: func(model *TechnologyModel) ([]string, []interface{}) {
+				return technologyCols,
+					[]interface{}{
+						&model.Id,
+						&model.Hostname,
+						&model.Name,
+						&model.Version,
+						&model.Categories,
+						&model.Confidence,
+						&model.Source,
+						&model.VisitId,
+						&model.Url,
+						&model.Evidence,
+						&model.FirstSeen,
+						&model.LastSeen,
+					}
+			},
+		},
+	},
+}
+
+// TechnologyFilter narrows the technologies listed, zero values don't
+// filter
+type TechnologyFilter struct {
+	Name          string
+	Category      string
+	Hostname      string
+	MinConfidence int
+}
+
+func (f TechnologyFilter) apply(builder sq.SelectBuilder) sq.SelectBuilder {
+	if f.Name != "" {
+		builder = builder.Where("lower(name) = lower(?)", f.Name)
+	}
+	if f.Category != "" {
+		builder = builder.Where("categories @> array[?]::text[]", f.Category)
+	}
+	if f.Hostname != "" {
+		builder = builder.Where("hostname = ?", f.Hostname)
+	}
+	if f.MinConfidence > 0 {
+		builder = builder.Where("confidence >= ?", f.MinConfidence)
+	}
+	return builder
+}
+
+// StreamByFilter calls fn for the matching technologies ordered by host and
+// name
+func (r *TechnologyRepository) StreamByFilter(ctx context.Context, filter TechnologyFilter, fn func(model *TechnologyModel) error) error {
+	return r.Stream(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return filter.apply(builder).OrderBy("hostname asc", "name asc")
+	}, fn)
+}
+
+// technologyExists is the condition of a host running the technology, alias
+// is the table alias of the row with the hostname column
+func technologyExists(alias, name string) sq.Sqlizer {
+	return sq.Expr(fmt.Sprintf(
+		"exists (select 1 from technologies t where t.hostname = %s.hostname and lower(t.name) = lower(?))", alias,
+	), name)
+}
+
+// StoreTechnologies records the detections on a page of the host, one row
+// per technology. Hosts seen again keep the highest confidence, the latest
+// evidence and the latest known version
+func StoreTechnologies(ctx context.Context, hostname, url, source string, visitId *string, detections []fingerprint.Detection) error {
+	if len(detections) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	models := make([]TechnologyModel, len(detections))
+	for i, detection := range detections {
+		models[i] = TechnologyModel{
+			Hostname:   hostname,
+			Name:       detection.Name,
+			Version:    detection.Version,
+			Categories: detection.Categories,
+			Confidence: detection.Confidence,
+			Source:     source,
+			VisitId:    visitId,
+			Url:        url,
+			Evidence:   detection.Evidence,
+			FirstSeen:  now,
+			LastSeen:   now,
+		}
+		if models[i].Categories == nil {
+			models[i].Categories = []string{}
+		}
+		if models[i].Evidence == nil {
+			models[i].Evidence = []string{}
+		}
+	}
+
+	_, err := TechnologyRepo.BulkUpsert(ctx, models, []string{"hostname", "name"},
+		`do update set
+			version = coalesce(nullif(excluded.version, ''), technologies.version),
+			categories = excluded.categories,
+			confidence = greatest(technologies.confidence, excluded.confidence),
+			source = excluded.source,
+			visit_id = coalesce(excluded.visit_id, technologies.visit_id),
+			url = excluded.url,
+			evidence = excluded.evidence,
+			last_seen = excluded.last_seen`)
+	if err != nil {
+		return fmt.Errorf("failed to store technologies of %s: %w", hostname, err)
+	}
+	return nil
+}
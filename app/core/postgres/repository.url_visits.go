@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 )
@@ -14,19 +15,21 @@ var URLVisitRepo = &URLVisitRepository{
 	BaseRepository: BaseRepository[URLVisitModel]{
 		ModelConfig: ModelConfig[URLVisitModel]{
 			Table: "url_visits",
-			Cols:  []string{"url_id", "visit_id", "created_at"},
+			Cols:  []string{"url_id", "visit_id", "run_id", "created_at"},
 			BuildMap: func(model *URLVisitModel) map[string]interface{} {
 				return map[string]interface{}{
 					"url_id":     model.UrlId,
 					"visit_id":   model.VisitId,
+					"run_id":     model.RunId,
 					"created_at": model.CreatedAt,
 				}
 			},
 			ScanMap: func(model *URLVisitModel) ([]string, []interface{}) {
-				return []string{"url_id", "visit_id", "created_at"},
+				return []string{"url_id", "visit_id", "run_id", "created_at"},
 					[]interface{}{
 						&model.UrlId,
 						&model.VisitId,
+						&model.RunId,
 						&model.CreatedAt,
 					}
 			},
@@ -48,10 +51,27 @@ func (r *URLVisitRepository) GetByVisitId(ctx context.Context, visitId string) (
 
 func (r *URLVisitRepository) UpsertRaw(ctx context.Context, urlId string, visitId string) error {
 	query := `
-		insert into url_visits (url_id, visit_id, created_at)
-		values ($1, $2, now())
+		insert into url_visits (url_id, visit_id, run_id, created_at)
+		values ($1, $2, $3, now())
 		on conflict (url_id, visit_id) do nothing
 	`
-	_, err := Pool.Exec(ctx, query, urlId, visitId)
+	_, err := DB(ctx).Exec(ctx, query, urlId, visitId, CurrentRunId())
+	return err
+}
+
+// BulkLink links the urls to the visit, existing links are kept
+func (r *URLVisitRepository) BulkLink(ctx context.Context, urlIds []string, visitId string) error {
+	now := time.Now()
+	models := make([]URLVisitModel, 0, len(urlIds))
+	for _, urlId := range urlIds {
+		models = append(models, URLVisitModel{
+			UrlId:     urlId,
+			VisitId:   visitId,
+			RunId:     CurrentRunId(),
+			CreatedAt: now,
+		})
+	}
+
+	_, err := r.BulkUpsert(ctx, models, []string{"url_id", "visit_id"}, "do nothing")
 	return err
 }
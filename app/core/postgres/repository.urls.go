@@ -2,8 +2,13 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/mgorunuch/microb/app/core"
 )
 
 type UrlRepository struct {
@@ -14,12 +19,14 @@ var UrlRepo = &UrlRepository{
 	BaseRepository: BaseRepository[UrlModel]{
 		ModelConfig: ModelConfig[UrlModel]{
 			Table: "urls",
-			Cols:  []string{"id", "raw", "flags", "hostname", "path", "scheme", "query", "fragment", "created_at"},
+			Cols:  []string{"id", "raw", "canonical", "flags", "hostname", "port", "path", "scheme", "query", "fragment", "created_at"},
 			BuildMap: func(model *UrlModel) map[string]interface{} {
 				return map[string]interface{}{
 					"raw":        model.Raw,
+					"canonical":  model.Canonical,
 					"flags":      model.Flags,
 					"hostname":   model.Hostname,
+					"port":       model.Port,
 					"path":       model.Path,
 					"scheme":     model.Scheme,
 					"query":      model.Query,
@@ -28,12 +35,14 @@ var UrlRepo = &UrlRepository{
 				}
 			},
 			ScanMap: func(model *UrlModel) ([]string, []interface{}) {
-				return []string{"id", "raw", "flags", "hostname", "path", "scheme", "query", "fragment", "created_at"},
+				return []string{"id", "raw", "canonical", "flags", "hostname", "port", "path", "scheme", "query", "fragment", "created_at"},
 					[]interface{}{
 						&model.Id,
 						&model.Raw,
+						&model.Canonical,
 						&model.Flags,
 						&model.Hostname,
+						&model.Port,
 						&model.Path,
 						&model.Scheme,
 						&model.Query,
@@ -45,19 +54,65 @@ var UrlRepo = &UrlRepository{
 	},
 }
 
+// UpsertByRaw returns the stored url with the canonical form of raw or
+// creates it, in one statement so concurrent callers don't race on the
+// canonical constraint
 func (r *UrlRepository) UpsertByRaw(ctx context.Context, raw string) (*UrlModel, error) {
-	model, err := r.GetByRaw(ctx, raw)
-	if err == nil {
+	model := &UrlModel{Raw: raw, Flags: []string{}, CreatedAt: time.Now()}
+	err := model.CalcFromRaw(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	model = &UrlModel{Raw: raw}
-	err = model.CalcFromRaw(ctx)
+	cols, vals := r.ModelConfig.ScanMap(model)
+	query, args, err := psql.
+		Insert(r.ModelConfig.Table).
+		SetMap(r.ModelConfig.BuildMap(model)).
+		Suffix("on conflict (canonical) do update set flags = excluded.flags returning " + strings.Join(cols, ", ")).
+		ToSql()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if err := DB(ctx).QueryRow(ctx, query, args...).Scan(vals...); err != nil {
+		return nil, fmt.Errorf("failed to upsert url %s: %w", raw, err)
 	}
 
-	return model, model.Create(ctx)
+	return model, nil
+}
+
+// BulkUpsert stores the urls and returns them with their ids, including the
+// ones that already existed whose flags are reclassified
+func (r *UrlRepository) BulkUpsert(ctx context.Context, models []UrlModel) ([]UrlModel, error) {
+	return r.BaseRepository.BulkUpsert(ctx, models, []string{"canonical"}, "do update set flags = excluded.flags")
+}
+
+// StoreUrls upserts the urls, indexes their endpoints and links them to the
+// visit when visitId is set. Failing to index is logged, not returned
+func StoreUrls(ctx context.Context, models []UrlModel, visitId string) ([]UrlModel, error) {
+	urls, err := UrlRepo.BulkUpsert(ctx, models)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert %d URLs: %w", len(models), err)
+	}
+
+	urlIds := make([]string, 0, len(urls))
+	for _, url := range urls {
+		urlIds = append(urlIds, url.Id)
+	}
+
+	if _, err = IndexUrls(ctx, urlIds); err != nil {
+		core.Logger.Errorf("Failed to index endpoints of %d URLs: %v", len(urlIds), err)
+	}
+
+	if visitId == "" {
+		return urls, nil
+	}
+
+	if err = URLVisitRepo.BulkLink(ctx, urlIds, visitId); err != nil {
+		return nil, fmt.Errorf("failed to link %d URLs to visit %s: %w", len(urlIds), visitId, err)
+	}
+
+	return urls, nil
 }
 
 func (r *UrlRepository) GetById(ctx context.Context, id string) (*UrlModel, error) {
@@ -72,14 +127,140 @@ func (r *UrlRepository) GetByRaw(ctx context.Context, raw string) (*UrlModel, er
 	})
 }
 
+func (r *UrlRepository) GetByCanonical(ctx context.Context, canonical string) (*UrlModel, error) {
+	return r.Select(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("canonical = ?", canonical)
+	})
+}
+
 func (r *UrlRepository) GetByHostname(ctx context.Context, hostname string) ([]UrlModel, error) {
 	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
 		return builder.Where("hostname = ?", hostname)
 	})
 }
 
-func (r *UrlRepository) ListAll(ctx context.Context) ([]UrlModel, error) {
-	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+// StreamByFlags calls fn for the urls carrying every one of the flags, an
+// empty hostname streams the urls of every host
+func (r *UrlRepository) StreamByFlags(ctx context.Context, flags []string, hostname string, fn func(model *UrlModel) error) error {
+	return r.Stream(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		if len(flags) > 0 {
+			builder = builder.Where("flags @> ?", flags)
+		}
+		if hostname != "" {
+			builder = builder.Where("hostname = ?", hostname)
+		}
+		return builder.OrderBy("hostname asc", "canonical asc")
+	}, fn)
+}
+
+// UpdateFlags sets the flags of the urls, ids and flags are parallel
+func (r *UrlRepository) UpdateFlags(ctx context.Context, ids []string, flags [][]string) error {
+	// Urls sharing a flag set are updated together
+	groups := make(map[string][]string)
+	groupFlags := make(map[string][]string)
+	for i, id := range ids {
+		key := strings.Join(flags[i], ",")
+		groups[key] = append(groups[key], id)
+		groupFlags[key] = flags[i]
+	}
+
+	batch := &pgx.Batch{}
+	for key, groupIds := range groups {
+		batch.Queue("update urls set flags = $1 where id = any($2)", groupFlags[key], groupIds)
+	}
+
+	if err := DB(ctx).SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to update url flags: %v", err)
+	}
+	return nil
+}
+
+// StreamAll calls fn for every url, newest first
+func (r *UrlRepository) StreamAll(ctx context.Context, fn func(model *UrlModel) error) error {
+	return r.Stream(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
 		return builder.OrderBy("created_at desc")
+	}, fn)
+}
+
+// ListPage returns up to limit urls ordered by id after the given one, an
+// empty id returns the first page
+func (r *UrlRepository) ListPage(ctx context.Context, afterId string, limit uint64) ([]UrlModel, error) {
+	var after any
+	if afterId != "" {
+		after = afterId
+	}
+	return r.SelectPage(ctx, "id", after, limit, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder
 	})
 }
+
+// canonicalizeUrls fills the canonical form and the columns derived from it
+// for urls stored before canonicalization, in batches ordered by id. URLs
+// that can't be canonicalized keep their raw form.
+func canonicalizeUrls(ctx context.Context) error {
+	const batchSize = 5000
+
+	after := "00000000-0000-0000-0000-000000000000"
+	for {
+		rows, err := DB(ctx).Query(ctx,
+			"select id, raw from urls where id > $1 order by id limit $2",
+			after, batchSize,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to select urls: %v", err)
+		}
+
+		var batch []UrlModel
+		for rows.Next() {
+			var model UrlModel
+			if err := rows.Scan(&model.Id, &model.Raw); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan url: %v", err)
+			}
+			batch = append(batch, model)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to select urls: %v", err)
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		var ids, canonicals, hostnames, ports, paths, schemes, queries, fragments []string
+		for _, model := range batch {
+			if err := model.CalcFromRaw(ctx); err != nil {
+				core.Logger.Warnf("Keeping raw form of url %s: %v", model.Raw, err)
+				model.Canonical = model.Raw
+			}
+			ids = append(ids, model.Id)
+			canonicals = append(canonicals, model.Canonical)
+			hostnames = append(hostnames, model.Hostname)
+			ports = append(ports, model.Port)
+			paths = append(paths, model.Path)
+			schemes = append(schemes, model.Scheme)
+			queries = append(queries, model.Query)
+			fragments = append(fragments, model.Fragment)
+		}
+
+		_, err = DB(ctx).Exec(ctx, `
+			update urls u set
+				canonical = v.canonical,
+				hostname = case when v.hostname = '' then u.hostname else v.hostname end,
+				port = v.port,
+				path = case when v.hostname = '' then u.path else v.path end,
+				scheme = case when v.hostname = '' then u.scheme else v.scheme end,
+				query = case when v.hostname = '' then u.query else v.query end,
+				fragment = case when v.hostname = '' then u.fragment else v.fragment end
+			from unnest($1::uuid[], $2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[], $8::text[])
+				as v(id, canonical, hostname, port, path, scheme, query, fragment)
+			where u.id = v.id
+		`, ids, canonicals, hostnames, ports, paths, schemes, queries, fragments)
+		if err != nil {
+			return fmt.Errorf("failed to update urls: %v", err)
+		}
+
+		after = batch[len(batch)-1].Id
+	}
+}
@@ -0,0 +1,184 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/mgorunuch/microb/app/core"
+)
+
+type VisitRequestRepository struct {
+	BaseRepository[VisitRequestModel]
+}
+
+var visitRequestCols = []string{
+	"id", "visit_id", "seq", "url_id", "url", "method", "resource_type", "request_headers", "post_data",
+	"status", "status_text", "protocol", "response_headers", "mime_type", "remote_ip", "redirect_url",
+	"encoded_size", "body_hash", "error_text", "started_at", "duration_ms", "created_at",
+}
+
+var VisitRequestRepo = &VisitRequestRepository{
+	BaseRepository: BaseRepository[VisitRequestModel]{
+		ModelConfig: ModelConfig[VisitRequestModel]{
+			Table: "visit_requests",
+			Cols:  visitRequestCols,
+			BuildMap: func(model *VisitRequestModel) map[string]interface{} {
+				return map[string]interface{}{
+					"visit_id":         model.VisitId,
+					"seq":              model.Seq,
+					"url_id":           model.UrlId,
+					"url":              model.Url,
+					"method":           model.Method,
+					"resource_type":    model.ResourceType,
+					"request_headers":  model.RequestHeaders,
+					"post_data":        model.PostData,
+					"status":           model.Status,
+					"status_text":      model.StatusText,
+					"protocol":         model.Protocol,
+					"response_headers": model.ResponseHeaders,
+					"mime_type":        model.MimeType,
+					"remote_ip":        model.RemoteIp,
+					"redirect_url":     model.RedirectUrl,
+					"encoded_size":     model.EncodedSize,
+					"body_hash":        model.BodyHash,
+					"error_text":       model.ErrorText,
+					"started_at":       model.StartedAt,
+					"duration_ms":      model.DurationMs,
+					"created_at":       model.CreatedAt,
+				}
+			},
+			ScanMap: func(model *VisitRequestModel) ([]string, []interface{}) {
+				return visitRequestCols,
+					[]interface{}{
+						&model.Id,
+						&model.VisitId,
+						&model.Seq,
+						&model.UrlId,
+						&model.Url,
+						&model.Method,
+						&model.ResourceType,
+						&model.RequestHeaders,
+						&model.PostData,
+						&model.Status,
+						&model.StatusText,
+						&model.Protocol,
+						&model.ResponseHeaders,
+						&model.MimeType,
+						&model.RemoteIp,
+						&model.RedirectUrl,
+						&model.EncodedSize,
+						&model.BodyHash,
+						&model.ErrorText,
+						&model.StartedAt,
+						&model.DurationMs,
+						&model.CreatedAt,
+					}
+			},
+		},
+	},
+}
+
+func (r *VisitRequestRepository) ListByVisitId(ctx context.Context, visitId string) ([]VisitRequestModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("visit_id = ?", visitId).OrderBy("seq")
+	})
+}
+
+// StoreVisitRequests stores the requests recorded during the visit with
+// their bodies and links every requested URL in scope to the visit
+func StoreVisitRequests(ctx context.Context, visitId string, models []VisitRequestModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+
+	for i := range models {
+		models[i].VisitId = visitId
+		if models[i].RequestHeaders == nil {
+			models[i].RequestHeaders = map[string]string{}
+		}
+		if models[i].ResponseHeaders == nil {
+			models[i].ResponseHeaders = map[string]string{}
+		}
+		if models[i].PostData == nil {
+			models[i].PostData = []byte{}
+		}
+
+		if models[i].Body != nil {
+			hash, err := BlobStore().Put(ctx, models[i].Body)
+			if err != nil {
+				return fmt.Errorf("failed to store body of %s: %w", models[i].Url, err)
+			}
+			models[i].BodyHash = &hash
+		}
+	}
+
+	urlIds, err := storeRequestedUrls(ctx, visitId, models)
+	if err != nil {
+		return err
+	}
+
+	for i := range models {
+		if urlId, ok := urlIds[models[i].Url]; ok {
+			models[i].UrlId = &urlId
+		}
+	}
+
+	_, err = VisitRequestRepo.BulkUpsert(ctx, models, []string{"visit_id", "seq"}, "do nothing")
+	if err != nil {
+		return fmt.Errorf("failed to store %d requests of visit %s: %w", len(models), visitId, err)
+	}
+
+	return nil
+}
+
+// storeRequestedUrls links the http urls in scope to the visit and returns
+// their ids by the requested url
+func storeRequestedUrls(ctx context.Context, visitId string, requests []VisitRequestModel) (map[string]string, error) {
+	canonicals := map[string]string{}
+	var models []UrlModel
+	for _, entry := range requests {
+		if _, seen := canonicals[entry.Url]; seen {
+			continue
+		}
+		if !strings.HasPrefix(entry.Url, "http://") && !strings.HasPrefix(entry.Url, "https://") {
+			continue
+		}
+		if ok, _ := core.Scope.Check(entry.Url); !ok {
+			continue
+		}
+
+		model := UrlModel{Raw: entry.Url, Flags: []string{}, CreatedAt: time.Now()}
+		if err := model.CalcFromRaw(ctx); err != nil {
+			core.Logger.Debugf("Skipping requested URL %s: %v", entry.Url, err)
+			continue
+		}
+
+		canonicals[entry.Url] = model.Canonical
+		models = append(models, model)
+	}
+
+	if len(models) == 0 {
+		return nil, nil
+	}
+
+	urls, err := StoreUrls(ctx, models, visitId)
+	if err != nil {
+		return nil, err
+	}
+
+	idsByCanonical := make(map[string]string, len(urls))
+	for _, url := range urls {
+		idsByCanonical[url.Canonical] = url.Id
+	}
+
+	ids := make(map[string]string, len(canonicals))
+	for raw, canonical := range canonicals {
+		if id, ok := idsByCanonical[canonical]; ok {
+			ids[raw] = id
+		}
+	}
+	return ids, nil
+}
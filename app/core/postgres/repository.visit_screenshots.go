@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type VisitScreenshotRepository struct {
+	BaseRepository[VisitScreenshotModel]
+}
+
+var VisitScreenshotRepo = &VisitScreenshotRepository{
+	BaseRepository: BaseRepository[VisitScreenshotModel]{
+		ModelConfig: ModelConfig[VisitScreenshotModel]{
+			Table: "visit_screenshots",
+			Cols:  []string{"visit_id", "kind", "path", "width", "height", "phash", "created_at"},
+			BuildMap: func(model *VisitScreenshotModel) map[string]interface{} {
+				return map[string]interface{}{
+					"visit_id":   model.VisitId,
+					"kind":       model.Kind,
+					"path":       model.Path,
+					"width":      model.Width,
+					"height":     model.Height,
+					"phash":      model.Phash,
+					"created_at": model.CreatedAt,
+				}
+			},
+			ScanMap: func(model *VisitScreenshotModel) ([]string, []interface{}) {
+				return []string{"visit_id", "kind", "path", "width", "height", "phash", "created_at"},
+					[]interface{}{
+						&model.VisitId,
+						&model.Kind,
+						&model.Path,
+						&model.Width,
+						&model.Height,
+						&model.Phash,
+						&model.CreatedAt,
+					}
+			},
+		},
+	},
+}
+
+func (r *VisitScreenshotRepository) ListByVisitId(ctx context.Context, visitId string) ([]VisitScreenshotModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("visit_id = ?", visitId).OrderBy("kind")
+	})
+}
+
+// StoreVisitScreenshot records the screenshot of the visit, a newer one of
+// the same kind replaces it
+func StoreVisitScreenshot(ctx context.Context, model *VisitScreenshotModel) error {
+	_, err := VisitScreenshotRepo.BulkUpsert(ctx, []VisitScreenshotModel{*model}, []string{"visit_id", "kind"},
+		"do update set path = excluded.path, width = excluded.width, height = excluded.height, phash = excluded.phash")
+	if err != nil {
+		return fmt.Errorf("failed to record %s screenshot of visit %s: %w", model.Kind, model.VisitId, err)
+	}
+	return nil
+}
+
+// ScreenshotSummary is the latest screenshot of a url with what the report
+// prints about its visit
+type ScreenshotSummary struct {
+	VisitId  string
+	Url      string
+	Hostname string
+	Title    string
+	OpenedAt time.Time
+	Path     string
+	Phash    uint64
+}
+
+// ScreenshotFilter narrows the screenshots considered, zero values don't
+// filter
+type ScreenshotFilter struct {
+	Kind     string
+	Hostname string
+	Since    time.Time
+}
+
+// ListLatestScreenshots returns the latest screenshot of each url, older
+// visits of the same url would only cluster with themselves
+func ListLatestScreenshots(ctx context.Context, filter ScreenshotFilter) ([]ScreenshotSummary, error) {
+	builder := psql.
+		Select("distinct on (cv.url_id) cv.id", "u.raw", "u.hostname", "coalesce(cv.title, '')", "cv.opened_at", "vs.path", "vs.phash").
+		From("visit_screenshots vs").
+		Join("chrome_visits cv on cv.id = vs.visit_id").
+		Join("urls u on u.id = cv.url_id").
+		Where("vs.kind = ?", filter.Kind).
+		OrderBy("cv.url_id", "cv.opened_at desc")
+
+	if filter.Hostname != "" {
+		builder = builder.Where("u.hostname = ?", filter.Hostname)
+	}
+	if !filter.Since.IsZero() {
+		builder = builder.Where("cv.opened_at >= ?", filter.Since)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := DB(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list screenshots: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ScreenshotSummary
+	for rows.Next() {
+		var summary ScreenshotSummary
+		var phash int64
+		err := rows.Scan(&summary.VisitId, &summary.Url, &summary.Hostname, &summary.Title, &summary.OpenedAt, &summary.Path, &phash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan screenshot: %w", err)
+		}
+		summary.Phash = uint64(phash)
+		result = append(result, summary)
+	}
+
+	return result, rows.Err()
+}
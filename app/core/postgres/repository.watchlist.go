@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type WatchlistRepository struct {
+	BaseRepository[WatchlistModel]
+}
+
+var WatchlistRepo = &WatchlistRepository{
+	BaseRepository: BaseRepository[WatchlistModel]{
+		ModelConfig: ModelConfig[WatchlistModel]{
+			Table: "watchlist",
+			Cols:  []string{"id", "domain", "engines", "enabled", "created_at"},
+			BuildMap: func(model *WatchlistModel) map[string]interface{} {
+				return map[string]interface{}{
+					"domain":     model.Domain,
+					"engines":    model.Engines,
+					"enabled":    model.Enabled,
+					"created_at": model.CreatedAt,
+				}
+			},
+			ScanMap: func(model *WatchlistModel) ([]string, []interface{}) {
+				return []string{"id", "domain", "engines", "enabled", "created_at"},
+					[]interface{}{
+						&model.Id,
+						&model.Domain,
+						&model.Engines,
+						&model.Enabled,
+						&model.CreatedAt,
+					}
+			},
+		},
+	},
+}
+
+func (r *WatchlistRepository) GetByDomain(ctx context.Context, domain string) (*WatchlistModel, error) {
+	return r.Select(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("domain = ?", domain)
+	})
+}
+
+func (r *WatchlistRepository) ListEnabled(ctx context.Context) ([]WatchlistModel, error) {
+	return r.SelectMultiple(ctx, func(builder sq.SelectBuilder) sq.SelectBuilder {
+		return builder.Where("enabled").OrderBy("domain asc")
+	})
+}
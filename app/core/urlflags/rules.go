@@ -0,0 +1,95 @@
+package urlflags
+
+const (
+	FlagStatic     = "static"
+	FlagJS         = "js"
+	FlagSourceMap  = "sourcemap"
+	FlagAPI        = "api"
+	FlagAuth       = "auth"
+	FlagAdmin      = "admin"
+	FlagUpload     = "upload"
+	FlagRedirect   = "redirect"
+	FlagDownload   = "download"
+	FlagBucket     = "bucket"
+	FlagThirdParty = "third_party"
+)
+
+// DefaultRules are the built-in rules, the rules file adds to them
+var DefaultRules = []Rule{
+	{
+		Flag:       FlagStatic,
+		Extensions: []string{"css", "png", "jpg", "jpeg", "gif", "svg", "ico", "webp", "bmp", "avif", "woff", "woff2", "ttf", "otf", "eot", "mp3", "mp4", "webm", "ogg"},
+	},
+	{
+		Flag:       FlagJS,
+		Extensions: []string{"js", "mjs", "cjs", "jsx"},
+	},
+	{
+		Flag:       FlagSourceMap,
+		Extensions: []string{"map"},
+	},
+	{
+		Flag: FlagAPI,
+		Path: `(?i)(^|/)(api|apis|graphql|gql|rest|rpc|jsonrpc|v[0-9]+)(/|$)`,
+	},
+	{
+		Flag: FlagAPI,
+		Host: `(?i)^(api|apis|gateway|graphql)[.-]`,
+	},
+	{
+		Flag: FlagAPI,
+		Path: `(?i)(swagger|openapi|api-docs)`,
+	},
+	{
+		Flag: FlagAuth,
+		Path: `(?i)(^|/)(login|logout|log-in|signin|sign-in|signup|sign-up|register|oauth|oauth2|oidc|saml|sso|auth|authorize|authenticate|password|passwd|forgot|reset|2fa|mfa)(/|$|[._-])`,
+	},
+	{
+		Flag: FlagAdmin,
+		Path: `(?i)(^|/)(admin|administrator|wp-admin|backend|dashboard|manage|manager|management|console|cpanel|phpmyadmin|internal)(/|$|\.)`,
+	},
+	{
+		Flag: FlagUpload,
+		Path: `(?i)upload`,
+	},
+	{
+		Flag:   FlagUpload,
+		Params: []string{"upload", "file", "filename", "attachment"},
+	},
+	{
+		Flag:   FlagRedirect,
+		Params: []string{"redirect", "redirect_uri", "redirect_url", "redirecturl", "redirect_to", "return", "return_to", "returnto", "returnurl", "return_url", "next", "continue", "dest", "destination", "goto", "rurl", "target", "forward", "callback", "success_url"},
+	},
+	{
+		Flag:       FlagRedirect,
+		ParamValue: `(?i)^(https?:)?//`,
+	},
+	{
+		Flag:       FlagDownload,
+		Extensions: []string{"pdf", "zip", "tar", "gz", "tgz", "bz2", "xz", "rar", "7z", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "csv", "sql", "bak", "backup", "old", "log", "exe", "msi", "dmg", "apk", "ipa", "iso", "jar", "war"},
+	},
+	{
+		Flag: FlagDownload,
+		Path: `(?i)(^|/)(download|downloads|export|attachment|attachments)(/|$)`,
+	},
+	{
+		Flag: FlagBucket,
+		Host: `(?i)(^|\.)s3([.-][a-z0-9-]+)*\.amazonaws\.com$`,
+	},
+	{
+		Flag:    FlagBucket,
+		Domains: []string{"storage.googleapis.com", "blob.core.windows.net", "digitaloceanspaces.com", "r2.cloudflarestorage.com", "r2.dev", "backblazeb2.com", "firebasestorage.googleapis.com", "aliyuncs.com"},
+	},
+	{
+		Flag: FlagThirdParty,
+		Domains: []string{
+			"google-analytics.com", "googletagmanager.com", "googlesyndication.com", "doubleclick.net", "googleadservices.com",
+			"gstatic.com", "googleapis.com", "recaptcha.net", "youtube.com", "ytimg.com",
+			"facebook.com", "facebook.net", "fbcdn.net", "twitter.com", "twimg.com", "x.com", "linkedin.com", "licdn.com",
+			"instagram.com", "pinterest.com", "tiktok.com",
+			"cloudflare.com", "cloudflareinsights.com", "jsdelivr.net", "unpkg.com", "cdnjs.com", "bootstrapcdn.com", "jquery.com", "fontawesome.com", "typekit.net",
+			"hotjar.com", "segment.com", "segment.io", "mixpanel.com", "amplitude.com", "newrelic.com", "nr-data.net", "sentry.io", "bugsnag.com", "datadoghq.com",
+			"intercom.io", "intercomcdn.com", "zendesk.com", "hubspot.com", "hs-scripts.com", "stripe.com", "paypal.com", "gravatar.com", "wp.com",
+		},
+	},
+}
@@ -0,0 +1,251 @@
+package urlflags
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/canonical"
+)
+
+// Rule tags URLs with Flag when every condition it sets matches. A list
+// condition matches when any of its entries does, regexes are Go syntax.
+type Rule struct {
+	Flag string `json:"flag"`
+	// Extensions of the last path segment, without the dot
+	Extensions []string `json:"extensions,omitempty"`
+	// Path is matched against the escaped path
+	Path string `json:"path,omitempty"`
+	// Host is matched against the lowercase hostname
+	Host string `json:"host,omitempty"`
+	// Domains match the hostname and its subdomains
+	Domains []string `json:"domains,omitempty"`
+	// Params are query parameter names, compared case-insensitively
+	Params []string `json:"params,omitempty"`
+	// ParamValue is matched against every decoded query parameter value
+	ParamValue string `json:"param_value,omitempty"`
+	// Disabled in the rules file removes the built-in rules of Flag
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	extensions map[string]bool
+	params     map[string]bool
+	path       *regexp.Regexp
+	host       *regexp.Regexp
+	paramValue *regexp.Regexp
+}
+
+func (r compiledRule) match(u canonical.URL, params url.Values) bool {
+	if r.extensions != nil {
+		ext := strings.TrimPrefix(path.Ext(u.Path), ".")
+		if !r.extensions[strings.ToLower(ext)] {
+			return false
+		}
+	}
+
+	if r.path != nil && !r.path.MatchString(u.Path) {
+		return false
+	}
+
+	if r.host != nil && !r.host.MatchString(u.Host) {
+		return false
+	}
+
+	if len(r.Domains) > 0 && !matchDomains(u.Host, r.Domains) {
+		return false
+	}
+
+	if r.params != nil {
+		found := false
+		for name := range params {
+			if r.params[strings.ToLower(name)] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.paramValue != nil {
+		found := false
+		for _, values := range params {
+			for _, value := range values {
+				if r.paramValue.MatchString(value) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchDomains(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+type Classifier struct {
+	rules []compiledRule
+}
+
+// NewClassifier compiles the rules, rules without a condition are rejected
+// because they would tag every URL
+func NewClassifier(rules []Rule) (*Classifier, error) {
+	c := &Classifier{}
+	for i, rule := range rules {
+		if rule.Flag == "" {
+			return nil, fmt.Errorf("rule %d has no flag", i)
+		}
+
+		compiled := compiledRule{Rule: rule}
+		conditions := 0
+
+		if len(rule.Extensions) > 0 {
+			compiled.extensions = make(map[string]bool)
+			for _, ext := range rule.Extensions {
+				compiled.extensions[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+			}
+			conditions++
+		}
+
+		if len(rule.Params) > 0 {
+			compiled.params = make(map[string]bool)
+			for _, name := range rule.Params {
+				compiled.params[strings.ToLower(name)] = true
+			}
+			conditions++
+		}
+
+		if len(rule.Domains) > 0 {
+			conditions++
+		}
+
+		for _, re := range []struct {
+			expr string
+			dest **regexp.Regexp
+		}{
+			{rule.Path, &compiled.path},
+			{rule.Host, &compiled.host},
+			{rule.ParamValue, &compiled.paramValue},
+		} {
+			if re.expr == "" {
+				continue
+			}
+			compiledRe, err := regexp.Compile(re.expr)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d (%s): %w", i, rule.Flag, err)
+			}
+			*re.dest = compiledRe
+			conditions++
+		}
+
+		if conditions == 0 {
+			return nil, fmt.Errorf("rule %d (%s) has no condition", i, rule.Flag)
+		}
+
+		c.rules = append(c.rules, compiled)
+	}
+	return c, nil
+}
+
+// Classify returns the sorted flags of the URL
+func (c *Classifier) Classify(u canonical.URL) []string {
+	params, _ := url.ParseQuery(u.Query)
+
+	matched := make(map[string]bool)
+	for _, rule := range c.rules {
+		if !matched[rule.Flag] && rule.match(u, params) {
+			matched[rule.Flag] = true
+		}
+	}
+
+	flags := make([]string, 0, len(matched))
+	for flag := range matched {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// Flags lists every flag the classifier can set
+func (c *Classifier) Flags() []string {
+	seen := make(map[string]bool)
+	var flags []string
+	for _, rule := range c.rules {
+		if !seen[rule.Flag] {
+			seen[rule.Flag] = true
+			flags = append(flags, rule.Flag)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// MergeRules adds the rules of the rules file to the base rules, a disabled
+// rule removes every base rule of its flag
+func MergeRules(base, fileRules []Rule) []Rule {
+	disabled := make(map[string]bool)
+	for _, rule := range fileRules {
+		if rule.Disabled {
+			disabled[rule.Flag] = true
+		}
+	}
+
+	var rules []Rule
+	for _, rule := range base {
+		if !disabled[rule.Flag] {
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range fileRules {
+		if !rule.Disabled {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+var (
+	defaultRules          []Rule
+	defaultClassifier     *Classifier
+	defaultClassifierOnce sync.Once
+)
+
+// Default is the classifier of the built-in rules merged with the rules
+// file from URL_FLAGS_FILE, or url_flags.json when present
+func Default() *Classifier {
+	defaultClassifierOnce.Do(func() {
+		fileRules, file, err := core.LoadOverrides[Rule]("URL_FLAGS_FILE", "url_flags.json")
+		core.FatalErr(err)
+		if file != "" {
+			core.Logger.Debugf("Loaded url flag rules from %s", file)
+		}
+
+		defaultRules = MergeRules(DefaultRules, fileRules)
+		defaultClassifier = core.Fatal1Err(NewClassifier(defaultRules))
+	})
+	return defaultClassifier
+}
+
+// Rules returns the rules of the Default classifier
+func Rules() []Rule {
+	Default()
+	return defaultRules
+}
@@ -0,0 +1,84 @@
+package urlflags
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mgorunuch/microb/app/core/canonical"
+)
+
+func TestClassify(t *testing.T) {
+	classifier, err := NewClassifier(DefaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{"https://example.com/assets/site.css", []string{FlagStatic}},
+		{"https://example.com/static/app.js", []string{FlagJS}},
+		{"https://example.com/static/app.js.map", []string{FlagSourceMap}},
+		{"https://example.com/video/segment0.ts", []string{}},
+		{"https://example.com/api/v1/users", []string{FlagAPI}},
+		{"https://api.example.com/users", []string{FlagAPI}},
+		{"https://example.com/swagger-ui/index.html", []string{FlagAPI}},
+		{"https://example.com/login", []string{FlagAuth}},
+		{"https://example.com/account/reset-password", []string{FlagAuth}},
+		{"https://example.com/oauth2/authorize", []string{FlagAuth}},
+		{"https://example.com/signin.php", []string{FlagAuth}},
+		{"https://example.com/author/jane", []string{}},
+		{"https://example.com/presets", []string{}},
+		{"https://example.com/menu/espresso", []string{}},
+		{"https://example.com/wp-admin/", []string{FlagAdmin}},
+		{"https://example.com/administration-guide", []string{}},
+		{"https://example.com/media/upload", []string{FlagUpload}},
+		{"https://example.com/form?filename=a.txt", []string{FlagUpload}},
+		{"https://example.com/out?next=/home", []string{FlagRedirect}},
+		{"https://example.com/out?u=https://evil.example", []string{FlagRedirect}},
+		{"https://example.com/reports/q1.pdf", []string{FlagDownload}},
+		{"https://bucket.s3.us-east-1.amazonaws.com/key", []string{FlagBucket}},
+		{"https://storage.googleapis.com/bucket/key", []string{FlagBucket, FlagThirdParty}},
+		{"https://www.google-analytics.com/analytics.js", []string{FlagJS, FlagThirdParty}},
+		{"https://example.com/login?redirect_uri=https://example.com/", []string{FlagAuth, FlagRedirect}},
+		{"https://example.com/about", []string{}},
+	}
+
+	for _, tt := range tests {
+		u, err := canonical.Parse(tt.raw, canonical.Options{})
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.raw, err)
+		}
+		if got := classifier.Classify(u); !slices.Equal(got, tt.want) {
+			t.Errorf("Classify(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestMergeRules(t *testing.T) {
+	base := []Rule{
+		{Flag: FlagJS, Extensions: []string{"js"}},
+		{Flag: FlagAuth, Path: "login"},
+	}
+	file := []Rule{
+		{Flag: FlagAuth, Disabled: true},
+		{Flag: "internal", Host: `\.corp$`},
+	}
+
+	rules := MergeRules(base, file)
+
+	var flags []string
+	for _, rule := range rules {
+		flags = append(flags, rule.Flag)
+	}
+	if want := []string{FlagJS, "internal"}; !slices.Equal(flags, want) {
+		t.Errorf("MergeRules flags = %v, want %v", flags, want)
+	}
+}
+
+func TestNewClassifierRejectsRulesWithoutCondition(t *testing.T) {
+	if _, err := NewClassifier([]Rule{{Flag: "everything"}}); err == nil {
+		t.Error("NewClassifier accepted a rule without a condition")
+	}
+}
@@ -1,6 +1,10 @@
 package core
 
-import "time"
+import (
+	"flag"
+	"reflect"
+	"time"
+)
 
 type CacheProvider[T any] interface {
 	HasCached(key string) (bool, error)
@@ -11,3 +15,92 @@ type CacheProvider[T any] interface {
 var YEAR = time.Hour * 24 * 365
 var MONTH = time.Hour * 24 * 30
 var WEEK = time.Hour * 24 * 7
+
+const (
+	CacheStatusOk    = "ok"
+	CacheStatusEmpty = "empty"
+	CacheStatusError = "error"
+)
+
+var retryErrorsFlag = flag.Bool("retry-errors", false, "Refetch keys whose last attempt failed, ignoring the negative cache TTL")
+
+// CacheFailure records the last failed attempt to fetch a key
+type CacheFailure struct {
+	HTTPStatus int       `json:"http_status,omitempty"`
+	ErrorClass string    `json:"error_class"`
+	Error      string    `json:"error"`
+	Attempts   int       `json:"attempts"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// NegativeCacheProvider is implemented by caches that remember failed
+// lookups, a successful AddToCache clears the failure of the key
+type NegativeCacheProvider interface {
+	GetFailure(key string) (CacheFailure, bool, error)
+	AddFailureToCache(key string, failure CacheFailure) error
+}
+
+// LockingCacheProvider is implemented by caches shared between processes,
+// the lock is held while a key is checked, fetched and stored
+type LockingCacheProvider interface {
+	LockKey(key string) (unlock func(), err error)
+}
+
+// NegativeTTLPolicy decides when a failed key may be fetched again. The
+// delay doubles with every consecutive failure up to MaxTTL.
+type NegativeTTLPolicy struct {
+	TTL    time.Duration
+	MaxTTL time.Duration
+}
+
+func DefaultNegativeTTLPolicy() NegativeTTLPolicy {
+	return NegativeTTLPolicy{
+		TTL:    Fatal1Err(time.ParseDuration(Env.GetDefault("CACHE_NEGATIVE_TTL", "1h"))),
+		MaxTTL: Fatal1Err(time.ParseDuration(Env.GetDefault("CACHE_NEGATIVE_MAX_TTL", "168h"))),
+	}
+}
+
+func (p NegativeTTLPolicy) RetryAfter(failure CacheFailure) time.Duration {
+	ttl := p.TTL
+	for i := 1; i < failure.Attempts && ttl < p.MaxTTL; i++ {
+		ttl *= 2
+	}
+	if p.MaxTTL != 0 && ttl > p.MaxTTL {
+		ttl = p.MaxTTL
+	}
+	return ttl
+}
+
+func (p NegativeTTLPolicy) ShouldRetry(failure CacheFailure) bool {
+	return *retryErrorsFlag || time.Since(failure.FailedAt) >= p.RetryAfter(failure)
+}
+
+// ResultStatus reports whether a fetched value carries data. Values can
+// implement IsEmpty() when emptiness is not their zero length.
+func ResultStatus(v any) string {
+	if IsEmptyResult(v) {
+		return CacheStatusEmpty
+	}
+	return CacheStatusOk
+}
+
+func IsEmptyResult(v any) bool {
+	if e, ok := v.(interface{ IsEmpty() bool }); ok {
+		return e.IsEmpty()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return true
+		}
+		return IsEmptyResult(rv.Elem().Interface())
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDiffTooLarge is returned when two inputs differ in more lines than
+// the diff is allowed to trace
+var ErrDiffTooLarge = errors.New("inputs differ too much to diff")
+
+const (
+	DiffEqual  = ' '
+	DiffDelete = '-'
+	DiffInsert = '+'
+)
+
+type DiffLine struct {
+	Op   byte
+	Line string
+}
+
+// DiffLines returns a shortest edit script turning a into b (Myers). It
+// gives up after maxEdits differing lines since memory grows with them.
+func DiffLines(a, b []string, maxEdits int) ([]DiffLine, error) {
+	n, m := len(a), len(b)
+	max := n + m
+	if maxEdits > 0 && maxEdits < max {
+		max = maxEdits
+	}
+
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset, d), nil
+			}
+		}
+	}
+
+	return nil, ErrDiffTooLarge
+}
+
+func backtrack(a, b []string, trace [][]int, offset int, d int) []DiffLine {
+	var script []DiffLine
+	x, y := len(a), len(b)
+
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, DiffLine{Op: DiffEqual, Line: a[x]})
+		}
+
+		if x == prevX {
+			y--
+			script = append(script, DiffLine{Op: DiffInsert, Line: b[y]})
+		} else {
+			x--
+			script = append(script, DiffLine{Op: DiffDelete, Line: a[x]})
+		}
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		script = append(script, DiffLine{Op: DiffEqual, Line: a[x]})
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// UnifiedDiff formats an edit script as hunks with context lines around
+// the changes, it is empty when nothing changed
+func UnifiedDiff(script []DiffLine, context int) string {
+	var b strings.Builder
+
+	aLine, bLine := 1, 1
+	for i := 0; i < len(script); {
+		if script[i].Op == DiffEqual {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are closer than twice the context
+		start := max(i-context, 0)
+		end := i
+		for end < len(script) {
+			if script[end].Op != DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].Op == DiffEqual {
+				run++
+			}
+			if run == len(script) || run-end > 2*context {
+				end = min(end+context, len(script))
+				break
+			}
+			end = run
+		}
+
+		hunkA, hunkB := aLine-(i-start), bLine-(i-start)
+		countA, countB := 0, 0
+		for _, line := range script[start:end] {
+			if line.Op != DiffInsert {
+				countA++
+			}
+			if line.Op != DiffDelete {
+				countB++
+			}
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", hunkA, countA, hunkB, countB)
+		for _, line := range script[start:end] {
+			b.WriteByte(line.Op)
+			b.WriteString(line.Line)
+			b.WriteByte('\n')
+		}
+
+		for _, line := range script[i:end] {
+			if line.Op != DiffInsert {
+				aLine++
+			}
+			if line.Op != DiffDelete {
+				bLine++
+			}
+		}
+		i = end
+	}
+
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const (
+	ErrorClassHTTPClient  = "http_4xx"
+	ErrorClassHTTPServer  = "http_5xx"
+	ErrorClassRateLimited = "rate_limited"
+	ErrorClassTimeout     = "timeout"
+	ErrorClassCanceled    = "canceled"
+	ErrorClassNetwork     = "network"
+	ErrorClassDecode      = "decode"
+	ErrorClassOther       = "other"
+)
+
+// HTTPError is returned by engines when an API answers with an unexpected status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func NewHTTPError(resp *http.Response, message string) *HTTPError {
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Message:    message,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.Status)
+}
+
+// ClassifyError returns the error class and, for HTTP errors, the status code
+func ClassifyError(err error) (string, int) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorClassRateLimited, httpErr.StatusCode
+		case httpErr.StatusCode >= 500:
+			return ErrorClassHTTPServer, httpErr.StatusCode
+		default:
+			return ErrorClassHTTPClient, httpErr.StatusCode
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCanceled, 0
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout, 0
+		}
+		return ErrorClassNetwork, 0
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return ErrorClassDecode, 0
+	}
+
+	return ErrorClassOther, 0
+}
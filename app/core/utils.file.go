@@ -0,0 +1,70 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TmpFilePrefix starts the names of files WriteFileAtomic has not renamed
+// into place yet, directory scans skip them
+const TmpFilePrefix = ".tmp-"
+
+// WriteFileAtomic writes data next to path and renames it into place, so
+// readers either see the previous content or the complete new one. The
+// directory must exist
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+
+	tmp, err := os.CreateTemp(dir, TmpFilePrefix+name+"-*")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmp.Name()
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpPath)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// LoadOverrides reads the JSON array of items from the file named by the env
+// variable, or from fallback when it is unset. A missing fallback file is not
+// an error, file is then empty
+func LoadOverrides[T any](env, fallback string) (items []T, file string, err error) {
+	file = Env.GetDefault(env, fallback)
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) && Env.Get(env, false) == "" {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, file, err
+	}
+
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, file, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return items, file, nil
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/mgorunuch/microb/app/core/domain"
+)
+
+const (
+	FindingSubdomain   = "subdomain"
+	FindingCertificate = "certificate"
+	FindingURL         = "url"
+)
+
+// Findings is the normalized view of an engine response
+type Findings struct {
+	Subdomains   []string `json:"subdomains,omitempty"`
+	Certificates []string `json:"certificates,omitempty"`
+	URLs         []string `json:"urls,omitempty"`
+}
+
+func (f Findings) ByKind() map[string][]string {
+	return map[string][]string{
+		FindingSubdomain:   f.Subdomains,
+		FindingCertificate: f.Certificates,
+		FindingURL:         f.URLs,
+	}
+}
+
+type FindingChange struct {
+	Kind    string `json:"kind"`
+	Value   string `json:"value"`
+	Added   bool   `json:"added"`
+	Removed bool   `json:"removed"`
+}
+
+// DiffFindings returns the values that appear only in current (added)
+// or only in previous (removed)
+func DiffFindings(previous, current Findings) []FindingChange {
+	var changes []FindingChange
+
+	prevByKind := previous.ByKind()
+	for _, kind := range []string{FindingSubdomain, FindingCertificate, FindingURL} {
+		prev := toSet(prevByKind[kind])
+		curr := toSet(current.ByKind()[kind])
+
+		for _, value := range sortedKeys(curr) {
+			if !prev[value] {
+				changes = append(changes, FindingChange{Kind: kind, Value: value, Added: true})
+			}
+		}
+
+		for _, value := range sortedKeys(prev) {
+			if !curr[value] {
+				changes = append(changes, FindingChange{Kind: kind, Value: value, Removed: true})
+			}
+		}
+	}
+
+	return changes
+}
+
+// NormalizeHostname returns the ASCII form of the hostname without wildcard
+// and trailing dot, invalid hostnames are returned empty and dropped
+func NormalizeHostname(hostname string) string {
+	normalized, err := domain.Normalize(hostname)
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value != "" {
+			set[value] = true
+		}
+	}
+	return set
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
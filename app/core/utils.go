@@ -1,6 +1,9 @@
 package core
 
-import "fmt"
+import (
+	"crypto/rand"
+	"fmt"
+)
 
 // Helper function to parse int64 from string
 func ParseInt64(s string) (int64, error) {
@@ -8,3 +11,16 @@ func ParseInt64(s string) (int64, error) {
 	_, err := fmt.Sscanf(s, "%d", &n)
 	return n, err
 }
+
+// NewUUID returns a random (version 4) UUID
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
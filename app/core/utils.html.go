@@ -0,0 +1,56 @@
+package core
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// invisibleElements hold no text a visitor would read
+var invisibleElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+}
+
+// VisibleText returns the text content of an HTML document with
+// whitespace collapsed, skipping scripts, styles and similar elements
+func VisibleText(document string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(document))
+
+	var b strings.Builder
+	// Only the skipped element is tracked, other tags inside it may be
+	// left unclosed
+	skipTag := ""
+	skipDepth := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			switch {
+			case skipTag == "" && invisibleElements[string(name)]:
+				skipTag = string(name)
+				skipDepth = 1
+			case skipTag == string(name):
+				skipDepth++
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if skipTag == string(name) {
+				skipDepth--
+				if skipDepth == 0 {
+					skipTag = ""
+				}
+			}
+		case html.TextToken:
+			if skipTag == "" {
+				b.Write(tokenizer.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
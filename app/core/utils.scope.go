@@ -0,0 +1,268 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mgorunuch/microb/app/core/domain"
+)
+
+const (
+	ScopeRuleDomain   = "domain"
+	ScopeRuleWildcard = "wildcard"
+	ScopeRuleSuffix   = "suffix"
+	ScopeRuleRegex    = "regex"
+	ScopeRuleCIDR     = "cidr"
+	ScopeRuleURL      = "url_prefix"
+)
+
+// ScopeRule matches targets by hostname, address or URL. The kind is derived
+// from the rule text:
+//
+//	example.com           the hostname itself
+//	*.example.com         any subdomain of example.com
+//	.example.com          example.com and any of its subdomains
+//	re:^https?://api\.    a regular expression over the raw target
+//	10.0.0.0/8, 1.2.3.4   addresses inside the network
+//	https://example.com/a URLs starting with the prefix
+type ScopeRule struct {
+	Raw     string
+	Kind    string
+	Exclude bool
+	Source  string
+	Reason  string
+
+	regex   *regexp.Regexp
+	network *net.IPNet
+}
+
+// ParseScopeRule parses a single rule, a leading "!" makes it an exclusion
+func ParseScopeRule(text string, source string) (ScopeRule, error) {
+	rule := ScopeRule{Source: source}
+
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "!") {
+		rule.Exclude = true
+		text = strings.TrimSpace(text[1:])
+	}
+	rule.Raw = text
+
+	switch {
+	case text == "":
+		return rule, fmt.Errorf("empty scope rule")
+	case strings.HasPrefix(text, "re:"):
+		re, err := regexp.Compile(text[3:])
+		if err != nil {
+			return rule, fmt.Errorf("invalid scope regex %q: %w", text, err)
+		}
+		rule.Kind = ScopeRuleRegex
+		rule.regex = re
+	case strings.Contains(text, "://"):
+		rule.Kind = ScopeRuleURL
+	case strings.Contains(text, "/"):
+		_, network, err := net.ParseCIDR(text)
+		if err != nil {
+			return rule, fmt.Errorf("invalid scope network %q: %w", text, err)
+		}
+		rule.Kind = ScopeRuleCIDR
+		rule.network = network
+	case net.ParseIP(text) != nil:
+		ip := net.ParseIP(text)
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		rule.Kind = ScopeRuleCIDR
+		rule.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	case strings.HasPrefix(text, "."):
+		name, err := domain.Normalize(text[1:])
+		if err != nil {
+			return rule, fmt.Errorf("invalid scope domain %q: %w", text, err)
+		}
+		rule.Kind = ScopeRuleSuffix
+		rule.Raw = "." + name
+	case strings.HasPrefix(text, "*."):
+		name, err := domain.Normalize(text[2:])
+		if err != nil {
+			return rule, fmt.Errorf("invalid scope domain %q: %w", text, err)
+		}
+		rule.Kind = ScopeRuleWildcard
+		rule.Raw = "*." + name
+	default:
+		name, err := domain.Normalize(text)
+		if err != nil {
+			return rule, fmt.Errorf("invalid scope domain %q: %w", text, err)
+		}
+		rule.Kind = ScopeRuleDomain
+		rule.Raw = name
+	}
+
+	return rule, nil
+}
+
+func (r ScopeRule) String() string {
+	s := r.Raw
+	if r.Exclude {
+		s = "!" + s
+	}
+	if r.Source != "" {
+		s += " (" + r.Source
+		if r.Reason != "" {
+			s += ": " + r.Reason
+		}
+		s += ")"
+	}
+	return s
+}
+
+// scopeTarget is the parsed form of a line checked against the rules
+type scopeTarget struct {
+	raw  string
+	host string
+	ip   net.IP
+	url  bool
+}
+
+func parseScopeTarget(raw string) scopeTarget {
+	target := scopeTarget{raw: strings.TrimSpace(raw)}
+
+	// Free text such as search queries has no host
+	if target.raw == "" || strings.ContainsAny(target.raw, " \t") {
+		return target
+	}
+
+	toParse := target.raw
+	if strings.Contains(toParse, "://") {
+		target.url = true
+	} else {
+		toParse = "http://" + toParse
+	}
+
+	u, err := url.Parse(toParse)
+	if err != nil {
+		return target
+	}
+
+	target.host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	target.ip = net.ParseIP(target.host)
+	if name, err := domain.Normalize(target.host); err == nil && target.ip == nil {
+		target.host = name
+	}
+
+	return target
+}
+
+func (r ScopeRule) Match(target scopeTarget) bool {
+	switch r.Kind {
+	case ScopeRuleRegex:
+		return r.regex.MatchString(target.raw)
+	case ScopeRuleURL:
+		return target.url && strings.HasPrefix(target.raw, r.Raw)
+	case ScopeRuleCIDR:
+		return target.ip != nil && r.network.Contains(target.ip)
+	case ScopeRuleWildcard:
+		return target.host != "" && strings.HasSuffix(target.host, r.Raw[1:])
+	case ScopeRuleSuffix:
+		return target.host != "" && (target.host == r.Raw[1:] || strings.HasSuffix(target.host, r.Raw))
+	case ScopeRuleDomain:
+		return target.host == r.Raw
+	}
+	return false
+}
+
+// ScopeRules holds the include and exclude lists. A target is in scope when
+// no exclude rule matches it and, if there are include rules, one of them does.
+type ScopeRules struct {
+	mu      sync.RWMutex
+	Include []ScopeRule
+	Exclude []ScopeRule
+}
+
+func (s *ScopeRules) Add(rules ...ScopeRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rule := range rules {
+		if rule.Exclude {
+			s.Exclude = append(s.Exclude, rule)
+		} else {
+			s.Include = append(s.Include, rule)
+		}
+	}
+}
+
+// LoadFile adds the rules of a file, one per line. Empty lines and lines
+// starting with "#" are ignored, text after " #" is kept as the rule reason.
+func (s *ScopeRules) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var rules []ScopeRule
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		text, reason, _ := strings.Cut(line, " #")
+		rule, err := ParseScopeRule(text, path)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		rule.Reason = strings.TrimSpace(reason)
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	s.Add(rules...)
+	return nil
+}
+
+// Check reports whether the target is in scope and, when it is not, why
+func (s *ScopeRules) Check(raw string) (bool, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.Include) == 0 && len(s.Exclude) == 0 {
+		return true, ""
+	}
+
+	target := parseScopeTarget(raw)
+
+	for _, rule := range s.Exclude {
+		if rule.Match(target) {
+			return false, "excluded by " + rule.String()
+		}
+	}
+
+	// Include rules only restrict targets that have a host, free text
+	// inputs like search queries cannot be matched against them
+	if len(s.Include) == 0 || target.host == "" {
+		return true, ""
+	}
+
+	for _, rule := range s.Include {
+		if rule.Match(target) {
+			return true, ""
+		}
+	}
+
+	return false, "not matched by any include rule"
+}
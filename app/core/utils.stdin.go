@@ -3,11 +3,17 @@ package core
 import (
 	"bufio"
 	"context"
+	"errors"
 	"os"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrSkip is wrapped by key functions to drop an input without counting it as a failure
+var ErrSkip = errors.New("skipped")
+
 func ReadAllLines(processor func(string)) {
 	reader := bufio.NewReader(os.Stdin)
 
@@ -47,47 +53,123 @@ type Config[T any] struct {
 	OutputFunc    func(T)
 	SleepTime     time.Duration
 	Ctx           context.Context
+	// NegativeTTL governs retries of failed keys when the cache provider
+	// implements NegativeCacheProvider, defaults to DefaultNegativeTTLPolicy
+	NegativeTTL NegativeTTLPolicy
 }
 
 func ProcessLinesWithCache[T any](config Config[T]) {
 	var wg sync.WaitGroup
+	var flights singleflight.Group
+
+	negativeCache, _ := config.CacheProvider.(NegativeCacheProvider)
+	if negativeCache != nil && config.NegativeTTL == (NegativeTTLPolicy{}) {
+		config.NegativeTTL = DefaultNegativeTTLPolicy()
+	}
+
 	SpawnAllLines(RunParallel(&wg, config.ThreadsCount, func(v string) {
 		defer func() {
 			time.Sleep(config.SleepTime)
 		}()
 
-		key, err := config.KeyFunc(config.Ctx, v)
-		if err != nil {
-			Logger.Errorf("Error parsing key: %s", err.Error())
+		Run.InputCount.Add(1)
+
+		if !InScope(v) {
 			return
 		}
 
-		isCached, err := config.CacheProvider.HasCached(key)
+		key, err := config.KeyFunc(config.Ctx, v)
+		if errors.Is(err, ErrSkip) {
+			Logger.Debugf("Skipping input: %s", err.Error())
+			return
+		}
 		if err != nil {
-			Logger.Errorf("Error checking cache: %s", err.Error())
+			Run.FailureCount.Add(1)
+			Logger.Errorf("Error parsing key: %s", err.Error())
 			return
 		}
 
-		if isCached {
-			Logger.Debugf("Already processed: %s", key)
-			return
+		// Duplicates of a key that is being fetched wait for that fetch
+		// instead of calling the API again
+		_, _, shared := flights.Do(key, func() (any, error) {
+			processCachedKey(config, negativeCache, key)
+			return nil, nil
+		})
+		if shared {
+			Logger.Debugf("Deduplicated in-flight key: %s", key)
 		}
+	}))
+	wg.Wait()
+}
 
-		response, err := config.RunFunc(config.Ctx, key)
+func processCachedKey[T any](config Config[T], negativeCache NegativeCacheProvider, key string) {
+	// Other processes sharing the cache wait here and then find the key cached
+	if locker, ok := config.CacheProvider.(LockingCacheProvider); ok {
+		unlock, err := locker.LockKey(key)
 		if err != nil {
-			Logger.Errorf("Error running: %s", err.Error())
+			Run.FailureCount.Add(1)
+			Logger.Errorf("Error locking cache key: %s", err.Error())
 			return
 		}
+		defer unlock()
+	}
+
+	isCached, err := config.CacheProvider.HasCached(key)
+	if err != nil {
+		Run.FailureCount.Add(1)
+		Logger.Errorf("Error checking cache: %s", err.Error())
+		return
+	}
+
+	if isCached {
+		Logger.Debugf("Already processed: %s", key)
+		return
+	}
 
-		err = config.CacheProvider.AddToCache(key, response)
+	var lastFailure CacheFailure
+	if negativeCache != nil {
+		failure, found, err := negativeCache.GetFailure(key)
 		if err != nil {
-			Logger.Errorf("Error adding to cache: %s", err.Error())
-			return
+			Logger.Warnf("Error checking negative cache: %s", err.Error())
+		} else if found {
+			if !config.NegativeTTL.ShouldRetry(failure) {
+				Logger.Debugf("Skipping recently failed key: %s (%s)", key, failure.ErrorClass)
+				return
+			}
+			lastFailure = failure
 		}
+	}
 
-		Logger.Debugf("Successfully processed: %s", key)
-	}))
-	wg.Wait()
+	response, err := config.RunFunc(config.Ctx, key)
+	if err != nil {
+		Run.FailureCount.Add(1)
+		Logger.Errorf("Error running: %s", err.Error())
+
+		errorClass, httpStatus := ClassifyError(err)
+		if negativeCache != nil && errorClass != ErrorClassCanceled {
+			err = negativeCache.AddFailureToCache(key, CacheFailure{
+				HTTPStatus: httpStatus,
+				ErrorClass: errorClass,
+				Error:      err.Error(),
+				Attempts:   lastFailure.Attempts + 1,
+				FailedAt:   time.Now(),
+			})
+			if err != nil {
+				Logger.Errorf("Error adding failure to cache: %s", err.Error())
+			}
+		}
+		return
+	}
+
+	err = config.CacheProvider.AddToCache(key, response)
+	if err != nil {
+		Run.FailureCount.Add(1)
+		Logger.Errorf("Error adding to cache: %s", err.Error())
+		return
+	}
+
+	Run.SuccessCount.Add(1)
+	Logger.Debugf("Successfully processed: %s", key)
 }
 
 type SimpleConfig[T any] struct {
@@ -123,8 +205,19 @@ func ProcessLines[T any](config SimpleConfig[T]) {
 			time.Sleep(config.SleepTime)
 		}()
 
+		Run.InputCount.Add(1)
+
+		if !InScope(v) {
+			return
+		}
+
 		key, err := config.KeyFunc(config.Ctx, v)
+		if errors.Is(err, ErrSkip) {
+			Logger.Debugf("Skipping input: %s", err.Error())
+			return
+		}
 		if err != nil {
+			Run.FailureCount.Add(1)
 			Logger.Errorf("Error parsing key: %s", err.Error())
 			return
 		}
@@ -138,14 +231,20 @@ func ProcessLines[T any](config SimpleConfig[T]) {
 
 		response, err := config.RunFunc(config.Ctx, key)
 		if err != nil {
+			Run.FailureCount.Add(1)
 			Logger.Errorf("Error running: %s", err.Error())
 			return
 		}
 
+		if !outputInScope(response) {
+			return
+		}
+
 		if config.OutputFunc != nil {
 			config.OutputFunc(response)
 		}
 
+		Run.SuccessCount.Add(1)
 		Logger.Debugf("Successfully processed: %s", key)
 	}))
 	wg.Wait()
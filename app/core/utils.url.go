@@ -2,20 +2,16 @@ package core
 
 import (
 	"context"
-	"fmt"
-	"net/url"
-	"strings"
+
+	"github.com/mgorunuch/microb/app/core/domain"
 )
 
+// ParseUrlHostName returns the normalized hostname of a URL or bare host
+// without its "www." prefix, it is the cache key of most engines
 func ParseUrlHostName(_ context.Context, urlStr string) (string, error) {
-	urlStr = strings.Trim(urlStr, "\n \t")
-	urlStr = strings.TrimPrefix(urlStr, "http://")
-	urlStr = strings.TrimPrefix(urlStr, "https://")
-	urlStr = strings.TrimPrefix(urlStr, "www.")
-	urlStr = strings.Trim(urlStr, "\n \t/")
-	u, err := url.Parse(fmt.Sprintf("http://%s", urlStr))
+	hostname, err := domain.Normalize(urlStr)
 	if err != nil {
 		return "", err
 	}
-	return u.Hostname(), nil
+	return domain.StripWWW(hostname), nil
 }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/mgorunuch/microb/app/core"
 )
 
 type PassiveDns struct {
@@ -19,6 +21,10 @@ type PassiveDnsResp struct {
 	PassiveDns []PassiveDns `json:"passive_dns"`
 }
 
+func (r PassiveDnsResp) IsEmpty() bool {
+	return len(r.PassiveDns) == 0
+}
+
 // Get retrieves passive DNS information for a hostname using the cache provider
 // If the data is not in cache, it will fetch from the AlienVault API
 func Get(_ context.Context, hostname string) (res PassiveDnsResp, err error) {
@@ -31,7 +37,7 @@ func Get(_ context.Context, hostname string) (res PassiveDnsResp, err error) {
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return res, fmt.Errorf("API request failed with status: %d", response.StatusCode)
+		return res, core.NewHTTPError(response, "API request failed with status")
 	}
 
 	body, err := io.ReadAll(response.Body)
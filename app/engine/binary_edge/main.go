@@ -22,6 +22,10 @@ type BinaryEdgeResponse struct {
 	Events   []string `json:"events"`
 }
 
+func (r BinaryEdgeResponse) IsEmpty() bool {
+	return len(r.Events) == 0
+}
+
 func Run(_ context.Context, domain string) (res BinaryEdgeResponse, err error) {
 	baseURL := "https://api.binaryedge.io/v2/query/domains/subdomain"
 	requestURL := fmt.Sprintf("%s/%s", baseURL, url.PathEscape(domain))
@@ -39,7 +43,7 @@ func Run(_ context.Context, domain string) (res BinaryEdgeResponse, err error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return res, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return res, core.NewHTTPError(resp, "unexpected status code")
 	}
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
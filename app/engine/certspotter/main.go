@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"time"
+
+	"github.com/mgorunuch/microb/app/core"
 )
 
 type Issuance struct {
@@ -29,7 +31,7 @@ func Get(_ context.Context, domain string) ([]Issuance, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get issuances: %s", resp.Status)
+		return nil, core.NewHTTPError(resp, "failed to get issuances")
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -47,7 +47,7 @@ func Get(_ context.Context, domain string) ([]CrawlData, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, core.NewHTTPError(resp, "unexpected status code")
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -100,7 +100,7 @@ func crawlLibData(domain string, lib LibList, allCrawlData []CrawlData) ([]Crawl
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code from CDX API: %d, %s", resp.StatusCode, apiURL)
+		return nil, fmt.Errorf("%w, %s", core.NewHTTPError(resp, "unexpected status code from CDX API"), apiURL)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
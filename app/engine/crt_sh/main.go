@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/mgorunuch/microb/app/core"
 )
 
 // CertData represents the structure of the certificate data returned by crt.sh
@@ -32,7 +34,7 @@ func Get(_ context.Context, domain string) ([]CertData, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch data: %s", resp.Status)
+		return nil, core.NewHTTPError(resp, "failed to fetch data")
 	}
 
 	var certs []CertData
@@ -27,6 +27,10 @@ type GoogleCustomSearchResponse struct {
 	} `json:"items"`
 }
 
+func (r GoogleCustomSearchResponse) IsEmpty() bool {
+	return len(r.Items) == 0
+}
+
 func Run(_ context.Context, query string) (GoogleCustomSearchResponse, error) {
 	googleCustomSearchApiKey := GOOGLE_CUSTOM_SEARCH_API()
 	googleCustomSearchEngineId := GOOGLE_CUSTOM_SEARCH_ENGINE_ID()
@@ -46,7 +50,7 @@ func Run(_ context.Context, query string) (GoogleCustomSearchResponse, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return GoogleCustomSearchResponse{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return GoogleCustomSearchResponse{}, core.NewHTTPError(resp, "unexpected status code")
 	}
 
 	var searchResponse GoogleCustomSearchResponse
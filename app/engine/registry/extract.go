@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/engine/alienvault_passivedns"
+	"github.com/mgorunuch/microb/app/engine/binary_edge"
+	"github.com/mgorunuch/microb/app/engine/certspotter"
+	"github.com/mgorunuch/microb/app/engine/commoncrawl"
+	"github.com/mgorunuch/microb/app/engine/crt_sh"
+	"github.com/mgorunuch/microb/app/engine/google_custom_search"
+	"github.com/mgorunuch/microb/app/engine/web_archive"
+)
+
+func init() {
+	register(core.CommandAlienvaultPassivedns, registration[alienvault_passivedns.PassiveDnsResp]{
+		interval: core.MONTH,
+		run:      alienvault_passivedns.Get,
+		extract:  extractAlienvaultPassivedns,
+	})
+	register(core.CommandBinaryEdge, registration[binary_edge.BinaryEdgeResponse]{
+		interval: core.MONTH,
+		run:      binary_edge.Run,
+		extract:  extractBinaryEdge,
+	})
+	register(core.CommandCertspotter, registration[[]certspotter.Issuance]{
+		interval: core.WEEK,
+		run:      certspotter.Get,
+		extract:  extractCertspotter,
+	})
+	register(core.CommandCommonCrawl, registration[[]commoncrawl.CrawlData]{
+		interval: core.MONTH,
+		run:      commoncrawl.Get,
+		extract:  extractCommonCrawl,
+	})
+	register(core.CommandCrtSh, registration[[]crt_sh.CertData]{
+		interval: core.WEEK,
+		run:      crt_sh.Get,
+		extract:  extractCrtSh,
+	})
+	register(core.CommandGoogleSearch, registration[google_custom_search.GoogleCustomSearchResponse]{
+		interval: core.WEEK,
+		keyFunc: func(_ context.Context, s string) (string, error) {
+			return s, nil
+		},
+		run:     google_custom_search.Run,
+		extract: extractGoogleSearch,
+	})
+	register(core.CommandWebArchive, registration[[]string]{
+		interval: core.MONTH,
+		run:      web_archive.Get,
+		extract:  extractURLs,
+	})
+}
+
+func urlHostname(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return core.NormalizeHostname(u.Hostname())
+}
+
+func extractURLs(urls []string) core.Findings {
+	var findings core.Findings
+	for _, raw := range urls {
+		findings.URLs = append(findings.URLs, strings.TrimSpace(raw))
+		findings.Subdomains = append(findings.Subdomains, urlHostname(raw))
+	}
+	return findings
+}
+
+func extractAlienvaultPassivedns(resp alienvault_passivedns.PassiveDnsResp) core.Findings {
+	var findings core.Findings
+	for _, record := range resp.PassiveDns {
+		findings.Subdomains = append(findings.Subdomains, core.NormalizeHostname(record.Hostname))
+	}
+	return findings
+}
+
+func extractBinaryEdge(resp binary_edge.BinaryEdgeResponse) core.Findings {
+	var findings core.Findings
+	for _, event := range resp.Events {
+		findings.Subdomains = append(findings.Subdomains, core.NormalizeHostname(event))
+	}
+	return findings
+}
+
+func extractCertspotter(issuances []certspotter.Issuance) core.Findings {
+	var findings core.Findings
+	for _, issuance := range issuances {
+		findings.Certificates = append(findings.Certificates, issuance.CertSHA256)
+		for _, name := range issuance.DNSNames {
+			findings.Subdomains = append(findings.Subdomains, core.NormalizeHostname(name))
+		}
+	}
+	return findings
+}
+
+func extractCommonCrawl(data []commoncrawl.CrawlData) core.Findings {
+	urls := make([]string, len(data))
+	for i, page := range data {
+		urls[i] = page.Url
+	}
+	return extractURLs(urls)
+}
+
+func extractCrtSh(certs []crt_sh.CertData) core.Findings {
+	var findings core.Findings
+	for _, cert := range certs {
+		findings.Certificates = append(findings.Certificates, strconv.FormatInt(cert.ID, 10))
+		findings.Subdomains = append(findings.Subdomains, core.NormalizeHostname(cert.CommonName))
+		for _, name := range strings.Split(cert.NameValue, "\n") {
+			findings.Subdomains = append(findings.Subdomains, core.NormalizeHostname(name))
+		}
+	}
+	return findings
+}
+
+func extractGoogleSearch(resp google_custom_search.GoogleCustomSearchResponse) core.Findings {
+	urls := make([]string, len(resp.Items))
+	for i, item := range resp.Items {
+		urls[i] = item.Link
+	}
+	return extractURLs(urls)
+}
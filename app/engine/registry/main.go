@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mgorunuch/microb/app/core"
+	"github.com/mgorunuch/microb/app/core/cache"
+)
+
+// Snapshot is a single cached response of an engine
+type Snapshot struct {
+	Key      string
+	Ts       time.Time
+	Findings func() (core.Findings, error)
+}
+
+// Engine gives untyped access to the cached results of an engine
+type Engine interface {
+	Name() string
+	// Interval is how often the results of a key are expected to change
+	Interval() time.Duration
+	// Key normalizes an input to the key its results are cached under
+	Key(ctx context.Context, input string) (string, error)
+	Keys() ([]string, error)
+	// Snapshots returns the cached responses for key, newest first
+	Snapshots(key string) ([]Snapshot, error)
+	// Collect fetches a fresh response for the input and stores it in the cache
+	Collect(ctx context.Context, input string) (key string, err error)
+}
+
+type engine[T any] struct {
+	name     string
+	interval time.Duration
+	keyFunc  func(ctx context.Context, val string) (string, error)
+	run      func(ctx context.Context, val string) (T, error)
+	extract  func(T) core.Findings
+
+	cacheOnce sync.Once
+	provider  core.CacheProvider[T]
+}
+
+// cache is built on first use, the backend is only known once flags are
+// parsed and postgres is connected
+func (e *engine[T]) cache() core.CacheProvider[T] {
+	e.cacheOnce.Do(func() {
+		e.provider = cache.NewProvider[T](context.Background(), e.name, 0)
+	})
+	return e.provider
+}
+
+func (e *engine[T]) history() (cache.HistoryProvider[T], error) {
+	history, ok := e.cache().(cache.HistoryProvider[T])
+	if !ok {
+		return nil, fmt.Errorf("cache backend %s does not keep a history", cache.CACHE_BACKEND())
+	}
+	return history, nil
+}
+
+func (e *engine[T]) Name() string {
+	return e.name
+}
+
+func (e *engine[T]) Interval() time.Duration {
+	return e.interval
+}
+
+func (e *engine[T]) Key(ctx context.Context, input string) (string, error) {
+	key, err := e.keyFunc(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("error parsing key: %w", err)
+	}
+	return key, nil
+}
+
+func (e *engine[T]) Collect(ctx context.Context, input string) (string, error) {
+	key, err := e.Key(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := e.run(ctx, key)
+	if err != nil {
+		return key, err
+	}
+
+	if err := e.cache().AddToCache(key, response); err != nil {
+		return key, fmt.Errorf("error adding to cache: %w", err)
+	}
+
+	return key, nil
+}
+
+func (e *engine[T]) Keys() ([]string, error) {
+	history, err := e.history()
+	if err != nil {
+		return nil, err
+	}
+	return history.Keys()
+}
+
+func (e *engine[T]) Snapshots(key string) ([]Snapshot, error) {
+	history, err := e.history()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := history.Snapshots(key)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, len(records))
+	for i, record := range records {
+		snapshots[i] = Snapshot{
+			Key: key,
+			Ts:  record.Ts,
+			Findings: func() (core.Findings, error) {
+				data, err := record.Read()
+				if err != nil {
+					return core.Findings{}, err
+				}
+				return e.extract(data), nil
+			},
+		}
+	}
+
+	return snapshots, nil
+}
+
+var engines = map[string]Engine{}
+
+type registration[T any] struct {
+	interval time.Duration
+	keyFunc  func(ctx context.Context, val string) (string, error)
+	run      func(ctx context.Context, val string) (T, error)
+	extract  func(T) core.Findings
+}
+
+func register[T any](name string, r registration[T]) {
+	if r.keyFunc == nil {
+		r.keyFunc = core.ParseUrlHostName
+	}
+
+	engines[name] = &engine[T]{
+		name:     name,
+		interval: r.interval,
+		keyFunc:  r.keyFunc,
+		run:      r.run,
+		extract:  r.extract,
+	}
+}
+
+func Get(name string) (Engine, error) {
+	e, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine: %s", name)
+	}
+	return e, nil
+}
+
+// History returns the typed cache history of the engine, T must be the
+// response type it was registered with
+func History[T any](name string) (cache.HistoryProvider[T], error) {
+	e, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	typed, ok := e.(*engine[T])
+	if !ok {
+		return nil, fmt.Errorf("engine %s does not return %T", name, *new(T))
+	}
+	return typed.history()
+}
+
+func Names() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+
+	"github.com/mgorunuch/microb/app/core"
 )
 
 // Get fetches the list of URLs from the web archive for the given domain
@@ -19,7 +21,7 @@ func Get(_ context.Context, domain string) ([]string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch data: %s", resp.Status)
+		return nil, core.NewHTTPError(resp, "failed to fetch data")
 	}
 
 	scanner := bufio.NewScanner(resp.Body)